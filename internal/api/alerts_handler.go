@@ -0,0 +1,199 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/Hajdudev/ecoDatabase/internal/realtime"
+	"github.com/Hajdudev/ecoDatabase/models"
+)
+
+// maxAlertBody bounds the size of alerts written through the admin API.
+const maxAlertBody = 1 << 20
+
+// RequireAdmin only lets requests through that carry token as a bearer
+// token. With an empty token the admin API is disabled.
+func RequireAdmin(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token == "" {
+				http.Error(w, "The admin API is disabled", http.StatusForbidden)
+				return
+			}
+			given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Alerts serves /alerts?stop=&route=&trip=, the alerts active now.
+func (wh *DatabaseHandler) Alerts(w http.ResponseWriter, r *http.Request) {
+	if allowCORS(w, r) {
+		return
+	}
+
+	query := r.URL.Query()
+	var scope *realtime.Scope
+	if query.Has("stop") || query.Has("route") || query.Has("trip") {
+		scope = &realtime.Scope{
+			RouteID:   query.Get("route"),
+			RouteType: -1,
+			TripID:    query.Get("trip"),
+		}
+		if stop := query.Get("stop"); stop != "" {
+			scope.StopIDs = []string{stop}
+		}
+	}
+
+	now := time.Now()
+	alerts := wh.alerts.Matching(scope, now, now)
+	if alerts == nil {
+		alerts = []models.Alert{}
+	}
+	writeJSON(w, alerts)
+}
+
+// ManualAlerts serves GET /admin/alerts, every alert written by hand.
+func (wh *DatabaseHandler) ManualAlerts(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, wh.alerts.Manual())
+}
+
+// CreateAlert serves POST /admin/alerts.
+func (wh *DatabaseHandler) CreateAlert(w http.ResponseWriter, r *http.Request) {
+	alert, err := decodeAlert(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	alert, err = wh.alerts.Put(r.Context(), alert)
+	if err != nil {
+		http.Error(w, "There was an error saving the alert", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Location", "/admin/alerts/"+alert.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(alert)
+}
+
+// UpdateAlert serves PUT /admin/alerts/{id}, creating the alert if it does
+// not exist yet.
+func (wh *DatabaseHandler) UpdateAlert(w http.ResponseWriter, r *http.Request) {
+	alert, err := decodeAlert(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	alert.ID = chi.URLParam(r, "id")
+	alert, err = wh.alerts.Put(r.Context(), alert)
+	if err != nil {
+		http.Error(w, "There was an error saving the alert", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, alert)
+}
+
+// DeleteAlert serves DELETE /admin/alerts/{id}.
+func (wh *DatabaseHandler) DeleteAlert(w http.ResponseWriter, r *http.Request) {
+	err := wh.alerts.Delete(r.Context(), chi.URLParam(r, "id"))
+	if errors.Is(err, realtime.ErrAlertNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "There was an error deleting the alert", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeAlert reads and validates an alert from the request body.
+func decodeAlert(w http.ResponseWriter, r *http.Request) (models.Alert, error) {
+	var alert models.Alert
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAlertBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&alert); err != nil {
+		return alert, fmt.Errorf("Invalid alert: %v", err)
+	}
+
+	if len(alert.HeaderText) == 0 {
+		return alert, errors.New("Invalid alert: 'header_text' is required")
+	}
+	if len(alert.InformedEntities) == 0 {
+		return alert, errors.New("Invalid alert: 'informed_entities' is required")
+	}
+	for _, e := range alert.InformedEntities {
+		if e.AgencyID == "" && e.RouteID == "" && e.RouteType == nil && e.TripID == "" && e.StopID == "" {
+			return alert, errors.New("Invalid alert: every informed entity needs at least one field")
+		}
+	}
+	for _, p := range alert.ActivePeriods {
+		if p.Start != nil && p.End != nil && p.End.Before(*p.Start) {
+			return alert, errors.New("Invalid alert: active period ends before it starts")
+		}
+	}
+	return alert, nil
+}
+
+// stopAlerts returns the alerts active now at any of stopIDs.
+func (wh *DatabaseHandler) stopAlerts(stopIDs ...string) []models.Alert {
+	now := time.Now()
+	return wh.alerts.Matching(&realtime.Scope{RouteType: -1, StopIDs: stopIDs}, now, now)
+}
+
+// attachLegAlerts fills the alerts of every leg of journeys with those
+// affecting its trip, route or stops while it runs.
+func (wh *DatabaseHandler) attachLegAlerts(ctx context.Context, journeys []models.Journey) {
+	var routeIDs []string
+	for _, j := range journeys {
+		for _, leg := range j.Legs {
+			routeIDs = append(routeIDs, leg.RouteId)
+		}
+	}
+	if len(routeIDs) == 0 {
+		return
+	}
+
+	routes := make(map[string]models.Route)
+	found, err := wh.databaseStore.GetRoutesByID(ctx, routeIDs)
+	if err != nil {
+		// Alerts on the route as a whole still match by route_id.
+		wh.logger.Printf("alerts: loading routes: %v", err)
+	}
+	for _, route := range found {
+		routes[route.RouteID] = route
+	}
+
+	for i := range journeys {
+		for l := range journeys[i].Legs {
+			leg := &journeys[i].Legs[l]
+			scope := realtime.Scope{
+				RouteID:   leg.RouteId,
+				RouteType: -1,
+				TripID:    leg.TripId,
+				StopIDs:   make([]string, len(leg.Stops)),
+			}
+			if route, ok := routes[leg.RouteId]; ok {
+				scope.AgencyID = route.AgencyID
+				scope.RouteType = route.RouteType
+			}
+			for s, stop := range leg.Stops {
+				scope.StopIDs[s] = stop.StopId
+			}
+			leg.Alerts = wh.alerts.Matching(&scope, leg.DepartureTimestamp, leg.ArrivalTimestamp)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/Hajdudev/ecoDatabase/internal/store"
+)
+
+type cacheStatsResponse struct {
+	Entries int                         `json:"entries"`
+	Hits    uint64                      `json:"hits"`
+	Misses  uint64                      `json:"misses"`
+	Methods map[string]store.CacheStats `json:"methods"`
+}
+
+// CacheStats serves /admin/cache, the size of the store cache and its hit
+// and miss counts per method. cache may be nil when caching is disabled.
+func CacheStats(cache *store.CachedStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cache == nil {
+			http.Error(w, "The store cache is disabled", http.StatusNotFound)
+			return
+		}
+		resp := cacheStatsResponse{Entries: cache.Len(), Methods: cache.Stats()}
+		for _, s := range resp.Methods {
+			resp.Hits += s.Hits
+			resp.Misses += s.Misses
+		}
+		writeJSON(w, resp)
+	}
+}
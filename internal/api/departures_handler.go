@@ -0,0 +1,165 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/Hajdudev/ecoDatabase/internal/gtfs"
+	"github.com/Hajdudev/ecoDatabase/internal/planner"
+	"github.com/Hajdudev/ecoDatabase/internal/realtime"
+	"github.com/Hajdudev/ecoDatabase/models"
+)
+
+const (
+	defaultBoardLimit  = 20
+	maxBoardLimit      = 100
+	defaultBoardWindow = 60
+	maxBoardWindow     = 24 * 60
+)
+
+type departureBoard struct {
+	StopID     string             `json:"stop_id"`
+	Date       string             `json:"date"`
+	Time       string             `json:"time"`
+	Departures []models.Departure `json:"departures"`
+	Alerts     []models.Alert     `json:"alerts,omitempty"`
+}
+
+// StopDepartures serves /stops/{id}/departures?time=&date=&limit=&window=,
+// the next departures from a stop or from every platform of a station.
+// time and date default to now; window is in minutes.
+func (wh *DatabaseHandler) StopDepartures(w http.ResponseWriter, r *http.Request) {
+	if allowCORS(w, r) {
+		return
+	}
+	ctx := r.Context()
+
+	stopID := chi.URLParam(r, "id")
+	query := r.URL.Query()
+
+	now := time.Now().In(wh.planner.Location())
+	date := query.Get("date")
+	if date == "" {
+		date = now.Format("2006-01-02")
+	}
+	day, err := gtfs.ParseDate(date)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var from int
+	if v := query.Get("time"); v != "" {
+		if from, err = gtfs.ParseTime(v); err != nil {
+			http.Error(w, "Invalid 'time' parameter, expected HH:MM", http.StatusBadRequest)
+			return
+		}
+	} else if query.Get("date") == "" {
+		from = int(now.Sub(gtfs.ServiceDayStart(day, wh.planner.Location())) / time.Second)
+	}
+
+	limit, err := intParam(r, "limit", defaultBoardLimit, 1, maxBoardLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	window, err := intParam(r, "window", defaultBoardWindow, 1, maxBoardWindow)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	deps, err := wh.planner.Departures(ctx, date, stopID, from, from+window*60)
+	if errors.Is(err, planner.ErrStopNotFound) {
+		http.Error(w, fmt.Sprintf("Stop %q not found", stopID), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to load departures: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if len(deps) > limit {
+		deps = deps[:limit]
+	}
+	// Alerts on any platform of a station show on the station's board.
+	stopIDs, err := wh.planner.StopIDs(ctx, date, stopID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to load departures: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	routeIDs := make([]string, len(deps))
+	for i, d := range deps {
+		routeIDs[i] = d.RouteID
+	}
+	routes, err := wh.databaseStore.GetRoutesByID(ctx, routeIDs)
+	if err != nil {
+		http.Error(w, "There was an error loading the routes", http.StatusInternalServerError)
+		return
+	}
+	routeByID := make(map[string]models.Route, len(routes))
+	for _, route := range routes {
+		routeByID[route.RouteID] = route
+	}
+
+	board := departureBoard{
+		StopID:     stopID,
+		Date:       date,
+		Time:       gtfs.FormatTime(from),
+		Departures: make([]models.Departure, len(deps)),
+		Alerts:     wh.stopAlerts(stopIDs...),
+	}
+	for i, d := range deps {
+		route := routeByID[d.RouteID]
+		board.Departures[i] = models.Departure{
+			TripID:             d.TripID,
+			RouteID:            d.RouteID,
+			RouteShortName:     route.RouteShortName,
+			RouteColor:         route.RouteColor,
+			RouteTextColor:     route.RouteTextColor,
+			RouteType:          route.RouteType,
+			Headsign:           d.Headsign,
+			StopID:             d.StopID,
+			StopName:           d.StopName,
+			PlatformCode:       d.PlatformCode,
+			PickupType:         d.PickupType,
+			ServiceDate:        d.ServiceDate,
+			DepartureTime:      normalizeTime(d.DepartureTime),
+			DepartureTimestamp: d.DepartureTimestamp,
+		}
+		applyDepartureUpdate(wh.tripUpdates, &board.Departures[i], d)
+	}
+	writeJSON(w, board)
+}
+
+// applyDepartureUpdate fills the realtime fields of a board row.
+func applyDepartureUpdate(tripUpdates *realtime.TripUpdates, row *models.Departure, d planner.Departure) {
+	if tripUpdates == nil {
+		return
+	}
+	key := realtime.StopKey{
+		StopID:             d.StopID,
+		Sequence:           d.StopSequence,
+		ScheduledArrival:   d.DepartureTimestamp,
+		ScheduledDeparture: d.DepartureTimestamp,
+	}
+	prediction, ok := tripUpdates.Predict(d.TripID, strings.ReplaceAll(d.ServiceDate, "-", ""), []realtime.StopKey{key})
+	if !ok {
+		return
+	}
+
+	row.Realtime = true
+	row.Cancelled = prediction.Cancelled
+	stop := prediction.Stops[0]
+	row.Skipped = stop.Skipped
+	if stop.Known && !stop.Skipped {
+		departure := stop.Departure
+		row.PredictedDeparture = &departure
+		row.DelaySeconds = stop.DepartureDelay
+	}
+}
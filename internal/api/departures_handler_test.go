@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestStopDepartures(t *testing.T) {
+	wh := newTestHandler(t)
+	tests := []struct {
+		target string
+		status int
+		want   []string // trip and stop of each departure
+	}{
+		{"/stops/A1/departures?date=2025-03-04&time=07:00&window=240", http.StatusOK, []string{"T1 A1"}},
+		{"/stops/A1/departures?date=2025-03-04&time=08:01&window=240", http.StatusOK, nil},
+		{"/stops/B/departures?date=2025-03-04&time=07:00&window=240", http.StatusOK, []string{"T4 B"}},
+		// A station lists the departures of its platforms; on 2025-03-03
+		// the weekend service replaces the weekday one.
+		{"/stops/ST/departures?date=2025-03-03&time=07:00&window=240", http.StatusOK, []string{"T3 A2"}},
+		{"/stops/A1/departures?date=2025-03-04&time=07:00&window=30", http.StatusOK, nil},
+		{"/stops/A1/departures?date=2025-03-04&time=23:00&window=60&limit=1", http.StatusOK, []string{"T2 A1"}},
+		{"/stops/NOPE/departures?date=2025-03-04", http.StatusNotFound, nil},
+		{"/stops/A1/departures?date=04.03.2025", http.StatusBadRequest, nil},
+		{"/stops/A1/departures?time=noon", http.StatusBadRequest, nil},
+		{"/stops/A1/departures?limit=0", http.StatusBadRequest, nil},
+		{"/stops/A1/departures?limit=101", http.StatusBadRequest, nil},
+		{"/stops/A1/departures?window=0", http.StatusBadRequest, nil},
+		{"/stops/A1/departures?window=1441", http.StatusBadRequest, nil},
+	}
+	for _, tc := range tests {
+		rec := get(wh.StopDepartures, "/stops/{id}/departures", tc.target)
+		if rec.Code != tc.status {
+			t.Errorf("%s: status %d, want %d: %s", tc.target, rec.Code, tc.status, rec.Body)
+			continue
+		}
+		if tc.status != http.StatusOK {
+			continue
+		}
+		var board departureBoard
+		decode(t, rec, &board)
+		var got []string
+		for _, d := range board.Departures {
+			got = append(got, d.TripID+" "+d.StopID)
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%s: got %q, want %q", tc.target, got, tc.want)
+		}
+	}
+}
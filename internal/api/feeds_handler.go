@@ -0,0 +1,170 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/Hajdudev/ecoDatabase/internal/gtfs"
+	"github.com/Hajdudev/ecoDatabase/internal/store"
+)
+
+// FeedVersion pins the feed version the handlers behind it read: the one
+// given by the optional feed_version query parameter, so a timetable can
+// be tried out before it goes live, or else the active one kept by active.
+// The version is fixed once per request, so that an activation while a
+// request runs does not mix two versions in its response. db is nil for
+// stores without feed versions, which reject the parameter.
+func FeedVersion(db store.Database, active *store.ActiveVersion) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if db == nil {
+				if r.URL.Query().Has("feed_version") {
+					http.Error(w, "'feed_version' needs a database store", http.StatusBadRequest)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := r.Context()
+			if !r.URL.Query().Has("feed_version") {
+				id, err := active.Get(ctx)
+				if err != nil {
+					http.Error(w, "There was an error loading the feed versions", http.StatusInternalServerError)
+					return
+				}
+				if id != 0 {
+					ctx = gtfs.WithFeedVersion(ctx, id)
+				}
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
+			id, err := strconv.Atoi(r.URL.Query().Get("feed_version"))
+			if err != nil || id < 1 {
+				http.Error(w, "Invalid 'feed_version' parameter", http.StatusBadRequest)
+				return
+			}
+			if _, err := store.FindFeedVersion(ctx, db, id); errors.Is(err, store.ErrFeedVersionNotFound) {
+				http.Error(w, "Unknown feed version", http.StatusNotFound)
+				return
+			} else if err != nil {
+				http.Error(w, "There was an error loading the feed versions", http.StatusInternalServerError)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(gtfs.WithFeedVersion(ctx, id)))
+		})
+	}
+}
+
+// FeedVersions serves GET /admin/feeds, every imported feed version.
+func FeedVersions(db store.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			http.Error(w, "The store has no feed versions", http.StatusNotFound)
+			return
+		}
+		versions, err := db.FeedVersions(r.Context())
+		if err != nil {
+			http.Error(w, "There was an error loading the feed versions", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, versions)
+	}
+}
+
+// ActivateFeedVersion serves POST /admin/feeds/{id}/activate, which makes
+// a feed version the one served by default. onChange runs after the
+// switch, so the server drops what it cached from the previous version.
+func ActivateFeedVersion(db store.Database, onChange func()) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			http.Error(w, "The store has no feed versions", http.StatusNotFound)
+			return
+		}
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "Invalid feed version", http.StatusBadRequest)
+			return
+		}
+
+		ctx := r.Context()
+		err = db.ActivateFeedVersion(ctx, id)
+		if errors.Is(err, store.ErrFeedVersionNotFound) {
+			http.Error(w, "Unknown feed version", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "There was an error activating the feed version", http.StatusInternalServerError)
+			return
+		}
+		onChange()
+
+		version, err := store.FindFeedVersion(ctx, db, id)
+		if err != nil {
+			http.Error(w, "There was an error loading the feed version", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, version)
+	}
+}
+
+// RollbackFeedVersion serves POST /admin/feeds/rollback, which activates
+// the feed version that was active before the current one.
+func RollbackFeedVersion(db store.Database, onChange func()) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			http.Error(w, "The store has no feed versions", http.StatusNotFound)
+			return
+		}
+		version, err := store.RollbackFeedVersion(r.Context(), db)
+		if errors.Is(err, store.ErrNoPreviousFeedVersion) {
+			http.Error(w, "There is no previous feed version to roll back to", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "There was an error rolling back the feed version", http.StatusInternalServerError)
+			return
+		}
+		onChange()
+		writeJSON(w, version)
+	}
+}
+
+// DeleteFeedVersion serves DELETE /admin/feeds/{id}, which removes an
+// inactive feed version and its data.
+func DeleteFeedVersion(db store.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			http.Error(w, "The store has no feed versions", http.StatusNotFound)
+			return
+		}
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "Invalid feed version", http.StatusBadRequest)
+			return
+		}
+
+		err = db.DeleteFeedVersion(r.Context(), id)
+		if errors.Is(err, store.ErrFeedVersionNotFound) {
+			http.Error(w, "Unknown feed version", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, store.ErrFeedVersionActive) {
+			http.Error(w, "The active feed version cannot be deleted", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "There was an error deleting the feed version", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/Hajdudev/ecoDatabase/internal/gtfs"
+	"github.com/Hajdudev/ecoDatabase/internal/store"
+)
+
+// versionOf answers with the feed version of the request context, or
+// "none".
+func versionOf(w http.ResponseWriter, r *http.Request) {
+	if id, ok := gtfs.FeedVersion(r.Context()); ok {
+		fmt.Fprint(w, id)
+		return
+	}
+	fmt.Fprint(w, "none")
+}
+
+func serveVersion(db store.Database, active *store.ActiveVersion, target string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	FeedVersion(db, active)(http.HandlerFunc(versionOf)).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	return rec
+}
+
+func TestFeedVersionWithoutDatabase(t *testing.T) {
+	if rec := serveVersion(nil, nil, "/stops/search"); rec.Code != http.StatusOK || rec.Body.String() != "none" {
+		t.Errorf("got %d %s, want no version", rec.Code, rec.Body)
+	}
+	if rec := serveVersion(nil, nil, "/stops/search?feed_version=1"); rec.Code != http.StatusBadRequest {
+		t.Errorf("feed_version without a database: status %d, want 400", rec.Code)
+	}
+}
+
+func TestFeedVersion(t *testing.T) {
+	ctx := context.Background()
+	db, err := store.OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := store.MigrateUp(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	active := store.NewActiveVersion(db)
+
+	// Without feed versions, requests are served without one.
+	if rec := serveVersion(db, active, "/"); rec.Body.String() != "none" {
+		t.Errorf("without versions: got %s", rec.Body)
+	}
+
+	var ids []int
+	for _, name := range []string{"v1", "v2"} {
+		v, err := db.ImportFeed(ctx, testFeed(t, map[string]string{
+			"feed_info.txt": "feed_publisher_name,feed_publisher_url,feed_lang,feed_version\nTest,https://example.com,en," + name + "\n",
+		}), log.New(io.Discard, "", 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, v.ID)
+	}
+	if err := db.ActivateFeedVersion(ctx, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := active.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The active version is kept in memory until it is refreshed, as the
+	// server does when it sees another version activated.
+	if err := db.ActivateFeedVersion(ctx, ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	if rec := serveVersion(db, active, "/"); rec.Body.String() != fmt.Sprint(ids[0]) {
+		t.Errorf("before the refresh: got %s, want %d", rec.Body, ids[0])
+	}
+	if _, err := active.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if rec := serveVersion(db, active, "/"); rec.Body.String() != fmt.Sprint(ids[1]) {
+		t.Errorf("after the refresh: got %s, want %d", rec.Body, ids[1])
+	}
+
+	tests := []struct {
+		query  string
+		status int
+		want   string
+	}{
+		{fmt.Sprintf("?feed_version=%d", ids[0]), http.StatusOK, fmt.Sprint(ids[0])},
+		{fmt.Sprintf("?feed_version=%d", ids[1]), http.StatusOK, fmt.Sprint(ids[1])},
+		{"?feed_version=999", http.StatusNotFound, ""},
+		{"?feed_version=0", http.StatusBadRequest, ""},
+		{"?feed_version=latest", http.StatusBadRequest, ""},
+		{"?feed_version=", http.StatusBadRequest, ""},
+	}
+	for _, tc := range tests {
+		rec := serveVersion(db, active, "/"+tc.query)
+		if rec.Code != tc.status {
+			t.Errorf("%q: status %d, want %d", tc.query, rec.Code, tc.status)
+			continue
+		}
+		if tc.status == http.StatusOK && rec.Body.String() != tc.want {
+			t.Errorf("%q: got %s, want %s", tc.query, rec.Body, tc.want)
+		}
+	}
+}
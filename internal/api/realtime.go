@@ -0,0 +1,50 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/Hajdudev/ecoDatabase/internal/realtime"
+	"github.com/Hajdudev/ecoDatabase/models"
+)
+
+// applyTripUpdates fills the realtime fields of leg from the current
+// GTFS-RT delays. Legs of trips without an update are left as scheduled.
+func applyTripUpdates(tripUpdates *realtime.TripUpdates, leg *models.RouteResult) {
+	if tripUpdates == nil || len(leg.Stops) == 0 {
+		return
+	}
+
+	keys := make([]realtime.StopKey, len(leg.Stops))
+	for i, s := range leg.Stops {
+		keys[i] = realtime.StopKey{
+			StopID:             s.StopId,
+			Sequence:           s.StopSequence,
+			ScheduledArrival:   s.ArrivalTimestamp,
+			ScheduledDeparture: s.DepartureTimestamp,
+		}
+	}
+
+	serviceDate := strings.ReplaceAll(leg.ServiceDate, "-", "")
+	prediction, ok := tripUpdates.Predict(leg.TripId, serviceDate, keys)
+	if !ok {
+		return
+	}
+
+	leg.Realtime = true
+	leg.Cancelled = prediction.Cancelled
+
+	board := prediction.Stops[0]
+	alight := prediction.Stops[len(prediction.Stops)-1]
+	leg.DepartureSkipped = board.Skipped
+	leg.ArrivalSkipped = alight.Skipped
+	if board.Known && !board.Skipped {
+		departure := board.Departure
+		leg.PredictedDeparture = &departure
+		leg.DepartureDelaySeconds = board.DepartureDelay
+	}
+	if alight.Known && !alight.Skipped {
+		arrival := alight.Arrival
+		leg.PredictedArrival = &arrival
+		leg.ArrivalDelaySeconds = alight.ArrivalDelay
+	}
+}
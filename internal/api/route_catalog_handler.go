@@ -0,0 +1,227 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/Hajdudev/ecoDatabase/internal/gtfs"
+	"github.com/Hajdudev/ecoDatabase/internal/realtime"
+	"github.com/Hajdudev/ecoDatabase/internal/schedule"
+	"github.com/Hajdudev/ecoDatabase/models"
+)
+
+// routeAlerts returns the alerts active now on route.
+func (wh *DatabaseHandler) routeAlerts(route models.Route) []models.Alert {
+	now := time.Now()
+	scope := realtime.Scope{
+		AgencyID:  route.AgencyID,
+		RouteID:   route.RouteID,
+		RouteType: route.RouteType,
+	}
+	return wh.alerts.Matching(&scope, now, now)
+}
+
+// Routes serves /routes?agency=&route_type=, every route ordered by
+// route_sort_order.
+func (wh *DatabaseHandler) Routes(w http.ResponseWriter, r *http.Request) {
+	if allowCORS(w, r) {
+		return
+	}
+	ctx := r.Context()
+
+	agency := r.URL.Query().Get("agency")
+	routeType, err := intParam(r, "route_type", -1, 0, 1700)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	routes, err := wh.databaseStore.GetAllRoutes(ctx)
+	if err != nil {
+		http.Error(w, "There was an error loading the routes", http.StatusInternalServerError)
+		return
+	}
+
+	out := []models.RouteInfo{}
+	for _, route := range routes {
+		if (agency != "" && route.AgencyID != agency) || (routeType >= 0 && route.RouteType != routeType) {
+			continue
+		}
+		out = append(out, models.RouteInfo{Route: route, Alerts: wh.routeAlerts(route)})
+	}
+	writeJSON(w, out)
+}
+
+// RouteDetail serves /routes/{id}, the route with its directions,
+// headsigns and stops.
+func (wh *DatabaseHandler) RouteDetail(w http.ResponseWriter, r *http.Request) {
+	if allowCORS(w, r) {
+		return
+	}
+	ctx := r.Context()
+
+	routeID := chi.URLParam(r, "id")
+	routes, err := wh.databaseStore.GetRoutesByID(ctx, []string{routeID})
+	if err != nil {
+		http.Error(w, "There was an error loading the route", http.StatusInternalServerError)
+		return
+	}
+	if len(routes) == 0 {
+		http.Error(w, fmt.Sprintf("Route %q not found", routeID), http.StatusNotFound)
+		return
+	}
+
+	var (
+		trips     []models.Trip
+		stopTimes []models.StopTime
+	)
+	g, gctx := errgroup.WithContext(ctx)
+	g.Go(func() (err error) {
+		trips, err = wh.databaseStore.GetTripsByRoute(gctx, routeID)
+		return err
+	})
+	g.Go(func() (err error) {
+		stopTimes, err = wh.databaseStore.GetStopTimesByRoute(gctx, routeID)
+		return err
+	})
+	if err := g.Wait(); err != nil {
+		http.Error(w, "There was an error loading the trips", http.StatusInternalServerError)
+		return
+	}
+
+	directions := schedule.Directions(trips, stopTimes)
+	var ids []string
+	for _, d := range directions {
+		for _, s := range d.Stops {
+			ids = append(ids, s.StopID)
+		}
+	}
+	stops, err := wh.databaseStore.GetStopsByID(ctx, ids)
+	if err != nil {
+		http.Error(w, "There was an error loading the stops", http.StatusInternalServerError)
+		return
+	}
+	stopByID := make(map[string]models.Stop, len(stops))
+	for _, s := range stops {
+		stopByID[s.StopID] = s
+	}
+	for d := range directions {
+		for i, s := range directions[d].Stops {
+			directions[d].Stops[i] = stopByID[s.StopID]
+		}
+	}
+
+	writeJSON(w, models.RouteDetail{
+		Route:      routes[0],
+		Directions: directions,
+		Alerts:     wh.routeAlerts(routes[0]),
+	})
+}
+
+// RouteTimetable serves /routes/{id}/timetable?date=&direction=&format=,
+// the route's trips on date as a grid per direction. format=html returns a
+// printable page instead of JSON.
+func (wh *DatabaseHandler) RouteTimetable(w http.ResponseWriter, r *http.Request) {
+	if allowCORS(w, r) {
+		return
+	}
+	ctx := r.Context()
+
+	routeID := chi.URLParam(r, "id")
+	query := r.URL.Query()
+
+	date := query.Get("date")
+	if date == "" {
+		date = time.Now().In(wh.planner.Location()).Format("2006-01-02")
+	}
+	day, err := gtfs.ParseDate(date)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	date = day.Format("2006-01-02")
+
+	direction, err := intParam(r, "direction", -1, 0, 1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format := query.Get("format")
+	if format != "" && format != "json" && format != "html" {
+		http.Error(w, "Invalid 'format' parameter, expected json or html", http.StatusBadRequest)
+		return
+	}
+
+	routes, err := wh.databaseStore.GetRoutesByID(ctx, []string{routeID})
+	if err != nil {
+		http.Error(w, "There was an error loading the route", http.StatusInternalServerError)
+		return
+	}
+	if len(routes) == 0 {
+		http.Error(w, fmt.Sprintf("Route %q not found", routeID), http.StatusNotFound)
+		return
+	}
+
+	var (
+		serviceIDs []string
+		routeTrips []models.Trip
+		stopTimes  []models.StopTime
+	)
+	g, gctx := errgroup.WithContext(ctx)
+	g.Go(func() (err error) {
+		serviceIDs, err = wh.databaseStore.GetActiveServices(gctx, date)
+		return err
+	})
+	g.Go(func() (err error) {
+		routeTrips, err = wh.databaseStore.GetTripsByRoute(gctx, routeID)
+		return err
+	})
+	g.Go(func() (err error) {
+		stopTimes, err = wh.databaseStore.GetStopTimesByRoute(gctx, routeID)
+		return err
+	})
+	if err := g.Wait(); err != nil {
+		http.Error(w, "There was an error loading the trips", http.StatusInternalServerError)
+		return
+	}
+	var trips []models.Trip
+	for _, t := range routeTrips {
+		if slices.Contains(serviceIDs, t.ServiceID) && (direction < 0 || t.DirectionID == direction) {
+			trips = append(trips, t)
+		}
+	}
+
+	ids := make([]string, len(stopTimes))
+	for i, st := range stopTimes {
+		ids[i] = st.StopID
+	}
+	stops, err := wh.databaseStore.GetStopsByID(ctx, ids)
+	if err != nil {
+		http.Error(w, "There was an error loading the stops", http.StatusInternalServerError)
+		return
+	}
+	stopByID := make(map[string]models.Stop, len(stops))
+	for _, s := range stops {
+		stopByID[s.StopID] = s
+	}
+
+	timetable := models.RouteTimetable{
+		Route: routes[0],
+		Date:  date,
+		Grids: schedule.BuildGrids(trips, stopTimes, stopByID),
+	}
+
+	if format == "html" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := schedule.RenderHTML(w, timetable); err != nil {
+			wh.logger.Printf("timetable: rendering %s: %v", routeID, err)
+		}
+		return
+	}
+	writeJSON(w, timetable)
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/Hajdudev/ecoDatabase/models"
+)
+
+func TestRoutes(t *testing.T) {
+	wh := newTestHandler(t)
+	tests := []struct {
+		query  string
+		status int
+		want   []string
+	}{
+		{"", http.StatusOK, []string{"R1", "R2"}},
+		{"?route_type=0", http.StatusOK, []string{"R2"}},
+		{"?route_type=7", http.StatusOK, nil},
+		{"?route_type=tram", http.StatusBadRequest, nil},
+		{"?route_type=-1", http.StatusBadRequest, nil},
+	}
+	for _, tc := range tests {
+		rec := get(wh.Routes, "/routes", "/routes"+tc.query)
+		if rec.Code != tc.status {
+			t.Errorf("%q: status %d, want %d", tc.query, rec.Code, tc.status)
+			continue
+		}
+		if tc.status != http.StatusOK {
+			continue
+		}
+		var routes []models.RouteInfo
+		decode(t, rec, &routes)
+		var got []string
+		for _, r := range routes {
+			got = append(got, r.RouteID)
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%q: got %q, want %q", tc.query, got, tc.want)
+		}
+	}
+}
+
+func TestRouteDetail(t *testing.T) {
+	wh := newTestHandler(t)
+
+	var detail models.RouteDetail
+	decode(t, get(wh.RouteDetail, "/routes/{id}", "/routes/R1"), &detail)
+	if detail.RouteShortName != "1" || len(detail.Directions) != 2 {
+		t.Fatalf("route %+v, want R1 in two directions", detail)
+	}
+	var stops []string
+	for _, s := range detail.Directions[0].Stops {
+		stops = append(stops, s.StopID)
+	}
+	if want := []string{"A1", "M", "B"}; detail.Directions[0].DirectionID != 0 || !slices.Equal(stops, want) {
+		t.Errorf("direction %d stops %q, want 0 with %q", detail.Directions[0].DirectionID, stops, want)
+	}
+
+	if rec := get(wh.RouteDetail, "/routes/{id}", "/routes/NOPE"); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown route: status %d, want 404", rec.Code)
+	}
+}
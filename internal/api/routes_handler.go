@@ -6,26 +6,73 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"sort"
+	"strconv"
 	"sync"
 	"time"
 
+	"github.com/Hajdudev/ecoDatabase/internal/geo"
+	"github.com/Hajdudev/ecoDatabase/internal/gtfs"
+	"github.com/Hajdudev/ecoDatabase/internal/planner"
+	"github.com/Hajdudev/ecoDatabase/internal/realtime"
+	"github.com/Hajdudev/ecoDatabase/internal/search"
 	"github.com/Hajdudev/ecoDatabase/internal/store"
+	"github.com/Hajdudev/ecoDatabase/internal/tiles"
 	"github.com/Hajdudev/ecoDatabase/models"
+	"golang.org/x/sync/errgroup"
 )
 
 type DatabaseHandler struct {
 	databaseStore store.DatabaseStore
+	planner       *planner.Planner
+	tripUpdates   *realtime.TripUpdates
+	vehicles      *realtime.Vehicles
+	alerts        *realtime.Alerts
+	tiler         *tiles.Tiler
 	logger        *log.Logger
+
+	// indexes holds the stop indexes of the most recently used feed
+	// versions, by version id, the oldest first.
+	indexMu sync.Mutex
+	indexes []*feedIndexes
+}
+
+// feedIndexes are the stop indexes built from one feed version. Version 0
+// stands for stores without feed versions.
+type feedIndexes struct {
+	version     int
+	searchIndex *builtIndex[*search.Index]
+	stopGrid    *builtIndex[*geo.Grid[models.Stop]]
+}
+
+// builtIndex is an index that is built once in the background. done is
+// closed once value and err are set.
+type builtIndex[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
 }
 
-func NewDatabaseHandler(databaseStore store.DatabaseStore, logger *log.Logger) *DatabaseHandler {
+// indexedVersions is how many feed versions keep their stop indexes: the
+// active one and one being tried out with ?feed_version=.
+const indexedVersions = 2
+
+func NewDatabaseHandler(databaseStore store.DatabaseStore, routePlanner *planner.Planner, tripUpdates *realtime.TripUpdates, vehicles *realtime.Vehicles, alerts *realtime.Alerts, logger *log.Logger) *DatabaseHandler {
 	return &DatabaseHandler{
 		databaseStore: databaseStore,
+		planner:       routePlanner,
+		tripUpdates:   tripUpdates,
+		vehicles:      vehicles,
+		alerts:        alerts,
+		tiler:         tiles.New(databaseStore, tileCacheSize),
 		logger:        logger,
 	}
 }
 
+const (
+	defaultJourneyLimit = 5
+	maxJourneyLimit     = 50
+)
+
 func normalizeTime(t string) string {
 	var hour, min, sec int
 	_, err := fmt.Sscanf(t, "%d:%d:%d", &hour, &min, &sec)
@@ -36,7 +83,32 @@ func normalizeTime(t string) string {
 	return fmt.Sprintf("%02d:%02d:%02d", hour, min, sec)
 }
 
+func stopIDs(stops []models.Stop) []string {
+	ids := make([]string, len(stops))
+	for i, s := range stops {
+		ids[i] = s.StopID
+	}
+	return ids
+}
+
+// resolvePlace turns a 'from' or 'to' parameter into a planner place. It
+// accepts anything ResolveStops understands or else a "lat,lon" pair, so
+// a stop named or coded like a coordinate still means that stop.
+func (wh *DatabaseHandler) resolvePlace(ctx context.Context, key string) (planner.Place, error) {
+	stops, err := wh.databaseStore.ResolveStops(ctx, key)
+	if err != nil {
+		return planner.Place{}, err
+	}
+	if len(stops) == 0 {
+		if p, ok := geo.ParsePoint(key); ok {
+			return planner.Place{Coordinate: &p}, nil
+		}
+	}
+	return planner.Place{StopIDs: stopIDs(stops)}, nil
+}
+
 func (wh *DatabaseHandler) StopNames(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	// Set CORS headers
 	w.Header().Set("Access-Control-Allow-Origin", "*") // Allow all origins
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
@@ -48,7 +120,7 @@ func (wh *DatabaseHandler) StopNames(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	stops, err := wh.databaseStore.GetStopsNames()
+	stops, err := wh.databaseStore.GetStopsNames(ctx)
 	if err != nil {
 		http.Error(w, "There was an error getting the names", http.StatusBadRequest)
 		return
@@ -81,160 +153,156 @@ func (wh *DatabaseHandler) FindRoute(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Missing required parameters 'from' and 'to'", http.StatusBadRequest)
 		return
 	}
+	if date == "" {
+		date = time.Now().In(wh.planner.Location()).Format("2006-01-02")
+	}
+	if _, err := gtfs.ParseDate(date); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	var wg sync.WaitGroup
-
-	toIdChan := make(chan []string, 1)
-	fromIdChan := make(chan []string, 1)
-	routesChan := make(chan map[string]models.TripHash, 1)
-	tempStopChan := make(chan []models.TempStop, 1)
-	fromStopChan := make(chan models.Stop, 1)
-	dateChan := make(chan string, 1)
-	toStopChan := make(chan models.Stop, 1)
-	errorChan := make(chan error, 1)
-
-	var service_date string
+	maxTransfers := -1
+	if v := query.Get("max_transfers"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid 'max_transfers' parameter", http.StatusBadRequest)
+			return
+		}
+		maxTransfers = n
+	}
 
-	handleError := func(err error, msg string) {
+	searchTime := -1
+	if v := query.Get("time"); v != "" {
+		t, err := gtfs.ParseTime(v)
 		if err != nil {
-			select {
-			case errorChan <- fmt.Errorf("%s: %w", msg, err):
-			default:
-			}
-			cancel()
+			http.Error(w, "Invalid 'time' parameter, expected HH:MM", http.StatusBadRequest)
+			return
 		}
+		searchTime = t
 	}
 
-	wg.Add(3)
-	go func() {
-		defer wg.Done()
-		err := wh.databaseStore.GetStopsID(from, fromIdChan)
-		handleError(err, "Failed to get stops for 'from'")
-		close(fromIdChan)
-	}()
-	go func() {
-		defer wg.Done()
-		err := wh.databaseStore.GetCalendarType(date, dateChan)
-		handleError(err, "Failed to get calendarDate")
-		service_date = <-dateChan
-		close(dateChan)
-	}()
-	go func() {
-		defer wg.Done()
-		err := wh.databaseStore.GetStopsID(to, toIdChan)
-		handleError(err, "Failed to get stops for 'to'")
-		close(toIdChan)
-	}()
-
-	wg.Wait()
-
-	fromIDs := <-fromIdChan
-	toIDs := <-toIdChan
-
-	if fromIDs == nil || toIDs == nil {
-		http.Error(w, "No stops found for given 'from' or 'to' locations", http.StatusNotFound)
+	arriveBy := false
+	if v := query.Get("arrive_by"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "Invalid 'arrive_by' parameter", http.StatusBadRequest)
+			return
+		}
+		arriveBy = b
+	}
+	if arriveBy && searchTime < 0 {
+		http.Error(w, "'arrive_by' requires the 'time' parameter", http.StatusBadRequest)
 		return
 	}
 
-	wg.Add(4)
-	go func() {
-		defer wg.Done()
-		err := wh.databaseStore.GetRoutesById(fromIDs, toIDs, routesChan)
-		handleError(err, "Failed to get routes by ID")
-		close(routesChan)
-	}()
-	go func() {
-		defer wg.Done()
-		err := wh.databaseStore.GetStopTimesInfo(fromIDs, toIDs, service_date, tempStopChan)
-		handleError(err, "Failed to get stop times info")
-		close(tempStopChan)
-	}()
-	go func() {
-		defer wg.Done()
-		err := wh.databaseStore.GetStopInfo(fromIDs[1], fromStopChan)
-		handleError(err, "Failed to get info for 'from' stop")
-		close(fromStopChan)
-	}()
-	go func() {
-		defer wg.Done()
-		err := wh.databaseStore.GetStopInfo(toIDs[1], toStopChan)
-		handleError(err, "Failed to get info for 'to' stop")
-		close(toStopChan)
-	}()
-
-	go func() {
-		wg.Wait()
-		close(errorChan)
-	}()
-
-	for err := range errorChan {
+	geometry := false
+	if v := query.Get("geometry"); v != "" {
+		b, err := strconv.ParseBool(v)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, "Invalid 'geometry' parameter", http.StatusBadRequest)
 			return
 		}
+		geometry = b
 	}
 
-	var tempStops []models.TempStop
-	var routes map[string]models.TripHash
-	var fromStop models.Stop
-	var toStop models.Stop
-
-	select {
-	case tempStops = <-tempStopChan:
-	case <-ctx.Done():
-		http.Error(w, "Timeout while fetching temporary stops", http.StatusGatewayTimeout)
-		return
+	limit := 0
+	if searchTime >= 0 {
+		limit = defaultJourneyLimit
+	}
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxJourneyLimit {
+			http.Error(w, fmt.Sprintf("Invalid 'limit' parameter, expected 1-%d", maxJourneyLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
 	}
 
-	select {
-	case routes = <-routesChan:
-	case <-ctx.Done():
-		http.Error(w, "Timeout while fetching routes", http.StatusGatewayTimeout)
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	var fromPlace, toPlace planner.Place
+	g, gctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		place, err := wh.resolvePlace(gctx, from)
+		if err != nil {
+			return fmt.Errorf("Failed to get stops for 'from': %w", err)
+		}
+		fromPlace = place
+		return nil
+	})
+	g.Go(func() error {
+		place, err := wh.resolvePlace(gctx, to)
+		if err != nil {
+			return fmt.Errorf("Failed to get stops for 'to': %w", err)
+		}
+		toPlace = place
+		return nil
+	})
+
+	if err := g.Wait(); err != nil {
+		if ctx.Err() != nil {
+			http.Error(w, "Timeout while fetching stops", http.StatusGatewayTimeout)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	select {
-	case fromStop = <-fromStopChan:
-	case <-ctx.Done():
-		http.Error(w, "Timeout while fetching 'from' stop info", http.StatusGatewayTimeout)
+	if fromPlace.IsEmpty() || toPlace.IsEmpty() {
+		http.Error(w, "No stops found for given 'from' or 'to' locations", http.StatusNotFound)
 		return
 	}
 
-	select {
-	case toStop = <-toStopChan:
-	case <-ctx.Done():
-		http.Error(w, "Timeout while fetching 'to' stop info", http.StatusGatewayTimeout)
+	journeys, err := wh.planner.Plan(ctx, planner.Request{
+		Date:         date,
+		From:         fromPlace,
+		To:           toPlace,
+		MaxTransfers: maxTransfers,
+		Time:         searchTime,
+		ArriveBy:     arriveBy,
+		Limit:        limit,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to plan journeys: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	var finalRoutes []models.RouteResult
-
-	for _, temp := range tempStops {
-		route := models.RouteResult{
-			TripId:        temp.TripID,
-			TripName:      routes[temp.TripID].Headsign,
-			FromStopId:    temp.FromStopID,
-			FromStopName:  fromStop.StopName,
-			ToStopId:      temp.ToStopID,
-			ToStopName:    toStop.StopName,
-			DepartureTime: normalizeTime(temp.FromDepartureTime),
-			ArrivalTime:   normalizeTime(temp.ToDepartureTime),
-			// ServiceId:          routes[temp.TripID].ServiceID,
-			DepartureDayOffset: 0,
-			ArrivalDayOffset:   0,
-			SearchDate:         date,
+	wh.attachLegAlerts(ctx, journeys)
+	if geometry {
+		if err := wh.attachLegGeometry(ctx, journeys); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to load leg geometry: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+	for i := range journeys {
+		journeys[i].DepartureTime = normalizeTime(journeys[i].DepartureTime)
+		journeys[i].ArrivalTime = normalizeTime(journeys[i].ArrivalTime)
+		for l := range journeys[i].Legs {
+			leg := &journeys[i].Legs[l]
+			applyTripUpdates(wh.tripUpdates, leg)
+			leg.DepartureTime = normalizeTime(leg.DepartureTime)
+			leg.ArrivalTime = normalizeTime(leg.ArrivalTime)
+			for s := range leg.Stops {
+				leg.Stops[s].DepartureTime = normalizeTime(leg.Stops[s].DepartureTime)
+				leg.Stops[s].ArrivalTime = normalizeTime(leg.Stops[s].ArrivalTime)
+			}
+		}
+		for _, walk := range []*models.WalkLeg{journeys[i].Access, journeys[i].Egress} {
+			if walk != nil {
+				walk.DepartureTime = normalizeTime(walk.DepartureTime)
+				walk.ArrivalTime = normalizeTime(walk.ArrivalTime)
+			}
+		}
+		for t := range journeys[i].Transfers {
+			tr := &journeys[i].Transfers[t]
+			tr.DepartureTime = normalizeTime(tr.DepartureTime)
+			tr.ArrivalTime = normalizeTime(tr.ArrivalTime)
 		}
-		finalRoutes = append(finalRoutes, route)
 	}
-	sort.Slice(finalRoutes, func(i, j int) bool {
-		return finalRoutes[i].DepartureTime < finalRoutes[j].DepartureTime
-	})
 
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(finalRoutes); err != nil {
+	if err := json.NewEncoder(w).Encode(journeys); err != nil {
 		http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
 		return
 	}
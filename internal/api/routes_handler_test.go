@@ -0,0 +1,250 @@
+package api
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/Hajdudev/ecoDatabase/internal/geo"
+	"github.com/Hajdudev/ecoDatabase/internal/gtfs"
+	"github.com/Hajdudev/ecoDatabase/internal/planner"
+	"github.com/Hajdudev/ecoDatabase/internal/store"
+	"github.com/Hajdudev/ecoDatabase/models"
+)
+
+// testFeed zips the feed in testdata/feed, with the files in overrides
+// added or replaced, and opens it.
+func testFeed(t *testing.T, overrides map[string]string) *gtfs.Feed {
+	t.Helper()
+	entries, err := os.ReadDir(filepath.Join("testdata", "feed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := maps.Clone(overrides)
+	if files == nil {
+		files = make(map[string]string)
+	}
+	for _, e := range entries {
+		if _, ok := files[e.Name()]; ok {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join("testdata", "feed", e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[e.Name()] = string(b)
+	}
+
+	path := filepath.Join(t.TempDir(), "feed.zip")
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(out)
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(w, files[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	feed, err := gtfs.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { feed.Close() })
+	return feed
+}
+
+// newTestHandler serves the feed in testdata/feed from a MemoryStore.
+func newTestHandler(t *testing.T) *DatabaseHandler {
+	t.Helper()
+	memory, err := store.LoadMemoryStore(testFeed(t, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := planner.DefaultOptions
+	opts.Location = time.UTC
+	logger := log.New(io.Discard, "", 0)
+	return NewDatabaseHandler(memory, planner.New(memory, opts), nil, nil, nil, logger)
+}
+
+// get serves target with handler mounted at pattern, so that chi fills
+// in the URL parameters.
+func get(handler http.HandlerFunc, pattern, target string) *httptest.ResponseRecorder {
+	r := chi.NewRouter()
+	r.Get(pattern, handler)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	return rec
+}
+
+// decode unmarshals the body of a successful response into v.
+func decode(t *testing.T, rec *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolvePlace(t *testing.T) {
+	wh := newTestHandler(t)
+	tests := []struct {
+		key   string
+		stops []string
+		point *geo.Point
+	}{
+		{key: "A1", stops: []string{"A1"}},
+		{key: "100", stops: []string{"A1"}},
+		{key: "Market", stops: []string{"B"}},
+		// A station stands for its platforms, by id and by name.
+		{key: "ST", stops: []string{"A1", "A2"}},
+		{key: "Central", stops: []string{"A1", "A2"}},
+		// Stops coded and named like coordinates.
+		{key: "12,5", stops: []string{"K"}},
+		{key: "7,7", stops: []string{"N"}},
+		{key: "48.1,17.1", point: &geo.Point{Lat: 48.1, Lon: 17.1}},
+		{key: "Nowhere"},
+	}
+	for _, tc := range tests {
+		place, err := wh.resolvePlace(context.Background(), tc.key)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.key, err)
+		}
+		ids := slices.Sorted(slices.Values(place.StopIDs))
+		if !slices.Equal(ids, tc.stops) {
+			t.Errorf("%q: stops %v, want %v", tc.key, ids, tc.stops)
+		}
+		if (place.Coordinate == nil) != (tc.point == nil) || place.Coordinate != nil && *place.Coordinate != *tc.point {
+			t.Errorf("%q: coordinate %v, want %v", tc.key, place.Coordinate, tc.point)
+		}
+	}
+}
+
+func TestFindRouteParameters(t *testing.T) {
+	wh := newTestHandler(t)
+	const base = "/find/route?from=Central&to=Market&date=2025-03-04"
+	tests := []struct {
+		query  string
+		status int
+		want   []string // departure and trip of each journey
+	}{
+		{"", http.StatusOK, []string{"08:00:00 T1", "23:50:00 T2"}},
+		{"&time=08:30", http.StatusOK, []string{"23:50:00 T2"}},
+		{"&time=7:00&limit=1", http.StatusOK, []string{"08:00:00 T1"}},
+		{"&time=09:00&arrive_by=true", http.StatusOK, []string{"08:00:00 T1"}},
+		{"&time=09:00&arrive_by=false", http.StatusOK, []string{"23:50:00 T2"}},
+		{"&max_transfers=0", http.StatusOK, []string{"08:00:00 T1", "23:50:00 T2"}},
+		{"&geometry=false", http.StatusOK, []string{"08:00:00 T1", "23:50:00 T2"}},
+		{"&time=8", http.StatusBadRequest, nil},
+		{"&time=noon", http.StatusBadRequest, nil},
+		{"&arrive_by=maybe&time=09:00", http.StatusBadRequest, nil},
+		{"&arrive_by=true", http.StatusBadRequest, nil},
+		{"&limit=0", http.StatusBadRequest, nil},
+		{"&limit=51", http.StatusBadRequest, nil},
+		{"&limit=few", http.StatusBadRequest, nil},
+		{"&max_transfers=-1", http.StatusBadRequest, nil},
+		{"&max_transfers=many", http.StatusBadRequest, nil},
+		{"&geometry=yes please", http.StatusBadRequest, nil},
+	}
+	for _, tc := range tests {
+		rec := get(wh.FindRoute, "/find/route", base+strings.ReplaceAll(tc.query, " ", "+"))
+		if rec.Code != tc.status {
+			t.Errorf("%q: status %d, want %d: %s", tc.query, rec.Code, tc.status, rec.Body)
+			continue
+		}
+		if tc.status != http.StatusOK {
+			continue
+		}
+		var journeys []models.Journey
+		decode(t, rec, &journeys)
+		var got []string
+		for _, j := range journeys {
+			got = append(got, j.DepartureTime+" "+j.Legs[0].TripId)
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%q: got %q, want %q", tc.query, got, tc.want)
+		}
+	}
+
+	for _, target := range []string{
+		"/find/route?to=Market",
+		"/find/route?from=Central",
+		"/find/route?from=Central&to=Market&date=2025-13-01",
+	} {
+		if rec := get(wh.FindRoute, "/find/route", target); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", target, rec.Code)
+		}
+	}
+	if rec := get(wh.FindRoute, "/find/route", "/find/route?from=Central&to=Nowhere"); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown stop: status %d, want 404", rec.Code)
+	}
+}
+
+// countingStore counts the stop time lookups by trip.
+type countingStore struct {
+	store.DatabaseStore
+	byTrip, byTrips atomic.Int32
+}
+
+func (s *countingStore) GetStopTimesByTrip(ctx context.Context, tripID string) ([]models.StopTime, error) {
+	s.byTrip.Add(1)
+	return s.DatabaseStore.GetStopTimesByTrip(ctx, tripID)
+}
+
+func (s *countingStore) GetStopTimesByTrips(ctx context.Context, tripIDs []string) ([]models.StopTime, error) {
+	s.byTrips.Add(1)
+	return s.DatabaseStore.GetStopTimesByTrips(ctx, tripIDs)
+}
+
+func TestFindRouteGeometry(t *testing.T) {
+	wh := newTestHandler(t)
+	counting := &countingStore{DatabaseStore: wh.databaseStore}
+	wh.databaseStore = counting
+
+	var journeys []models.Journey
+	decode(t, get(wh.FindRoute, "/find/route", "/find/route?from=Central&to=B&date=2025-03-04&time=07:00&geometry=true"), &journeys)
+	if len(journeys) != 2 {
+		t.Fatalf("got %d journeys, want T1 and T2", len(journeys))
+	}
+	for _, j := range journeys {
+		if g := j.Legs[0].Geometry; g == nil || len(g.Coordinates) < 2 {
+			t.Errorf("%s has no geometry", j.Legs[0].TripId)
+		}
+	}
+	// T1 follows its shape from Central to Market.
+	want := [][2]float64{{17.1, 48.1}, {17.15, 48.15}, {17.2, 48.2}}
+	if got := journeys[0].Legs[0].Geometry.Coordinates; !slices.Equal(got, want) {
+		t.Errorf("T1 geometry %v, want %v", got, want)
+	}
+	// The stop times of both trips come from one lookup.
+	if counting.byTrip.Load() != 0 || counting.byTrips.Load() != 1 {
+		t.Errorf("%d lookups by trip and %d by trips, want 0 and 1", counting.byTrip.Load(), counting.byTrips.Load())
+	}
+}
@@ -0,0 +1,302 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/Hajdudev/ecoDatabase/internal/geo"
+	"github.com/Hajdudev/ecoDatabase/models"
+)
+
+// errTripNotFound is returned by tripGeometry for unknown trip ids.
+var errTripNotFound = errors.New("trip not found")
+
+// geometrySource holds the trips, shapes and stop positions tripGeometry
+// needs, loaded together for all trips of a response.
+type geometrySource struct {
+	trips  map[string]models.Trip
+	shapes map[string][]models.Shape
+	stops  map[string]geo.Point
+}
+
+// loadGeometry loads the trips of stopTimes, keyed by trip id, with their
+// shapes and the positions of their stops.
+func (wh *DatabaseHandler) loadGeometry(ctx context.Context, stopTimes map[string][]models.StopTime) (*geometrySource, error) {
+	src := &geometrySource{
+		trips:  make(map[string]models.Trip),
+		shapes: make(map[string][]models.Shape),
+		stops:  make(map[string]geo.Point),
+	}
+	tripIDs := make([]string, 0, len(stopTimes))
+	var stopIDs []string
+	for id, sts := range stopTimes {
+		tripIDs = append(tripIDs, id)
+		for _, st := range sts {
+			stopIDs = append(stopIDs, st.StopID)
+		}
+	}
+
+	trips, err := wh.databaseStore.GetTripsByID(ctx, tripIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range trips {
+		src.trips[t.TripID] = t
+		if _, ok := src.shapes[t.ShapeID]; t.ShapeID == "" || ok {
+			continue
+		}
+		if src.shapes[t.ShapeID], err = wh.databaseStore.GetShape(ctx, t.ShapeID); err != nil {
+			return nil, err
+		}
+	}
+
+	stops, err := wh.databaseStore.GetStopsByID(ctx, stopIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range stops {
+		src.stops[s.StopID] = geo.Point{Lat: s.StopLat, Lon: s.StopLon}
+	}
+	return src, nil
+}
+
+// tripGeometry returns the trip's path between the stop times at positions
+// from and to of its stop_times, or the whole path when both are negative.
+// Trips without a shape fall back to straight lines between their stops;
+// stops missing from the store are left out.
+func (src *geometrySource) tripGeometry(tripID string, stopTimes []models.StopTime, from, to int) (*models.LineString, error) {
+	trip, ok := src.trips[tripID]
+	if !ok {
+		return nil, errTripNotFound
+	}
+	shape := src.shapes[trip.ShapeID]
+
+	if from < 0 && to < 0 {
+		from, to = 0, len(stopTimes)-1
+		if len(shape) >= 2 {
+			return lineString(shapePoints(shape)), nil
+		}
+	}
+	if len(shape) < 2 {
+		var line []geo.Point
+		for _, st := range stopTimes[from : to+1] {
+			if p, ok := src.stops[st.StopID]; ok {
+				line = append(line, p)
+			}
+		}
+		return lineString(line), nil
+	}
+	return lineString(cutShape(shape, stopTimes, src.stops, from, to)), nil
+}
+
+func shapePoints(shape []models.Shape) []geo.Point {
+	line := make([]geo.Point, len(shape))
+	for i, p := range shape {
+		line[i] = geo.Point{Lat: p.ShapePtLat, Lon: p.ShapePtLon}
+	}
+	return line
+}
+
+// cutShape returns the part of shape between the stop times at from and
+// to. It uses shape_dist_traveled when both the shape and the stop times
+// carry it, and otherwise projects the stops onto the line.
+func cutShape(shape []models.Shape, stopTimes []models.StopTime, stops map[string]geo.Point, from, to int) []geo.Point {
+	line := shapePoints(shape)
+
+	last := shape[len(shape)-1].ShapeDistTraveled
+	start, end := stopTimes[from].ShapeDistTraveled, stopTimes[to].ShapeDistTraveled
+	if last > 0 && end > 0 && start <= end {
+		measures := make([]float64, len(shape))
+		for i, p := range shape {
+			measures[i] = p.ShapeDistTraveled
+		}
+		return geo.Slice(line, measures, start, end)
+	}
+
+	// Project every stop up to the last one in order, so a stop on a loop
+	// is placed on the pass the trip makes at that point.
+	measures := geo.Measures(line)
+	position := 0.0
+	for i := 0; i <= to; i++ {
+		p, ok := stops[stopTimes[i].StopID]
+		if !ok {
+			continue
+		}
+		position = geo.Locate(line, measures, p, position)
+		if i == from {
+			start = position
+		}
+	}
+	return geo.Slice(line, measures, start, position)
+}
+
+func lineString(line []geo.Point) *models.LineString {
+	ls := &models.LineString{Type: "LineString", Coordinates: make([][2]float64, len(line))}
+	for i, p := range line {
+		ls.Coordinates[i] = [2]float64{p.Lon, p.Lat}
+	}
+	return ls
+}
+
+// stopPosition returns the position in stopTimes of the first visit to
+// stopID at or after position after, or -1. The id of a parent station
+// matches its platforms.
+func stopPosition(stopTimes []models.StopTime, parents map[string]string, stopID string, after int) int {
+	for i := after; i < len(stopTimes); i++ {
+		id := stopTimes[i].StopID
+		if id == stopID || parents[id] == stopID {
+			return i
+		}
+	}
+	return -1
+}
+
+// TripShape serves /trips/{trip_id}/shape?from_stop=&to_stop= as a GeoJSON
+// LineString, cut to the part between the two stops when they are given.
+func (wh *DatabaseHandler) TripShape(w http.ResponseWriter, r *http.Request) {
+	if allowCORS(w, r) {
+		return
+	}
+	ctx := r.Context()
+
+	tripID := chi.URLParam(r, "trip_id")
+	fromStop := r.URL.Query().Get("from_stop")
+	toStop := r.URL.Query().Get("to_stop")
+
+	stopTimes, err := wh.databaseStore.GetStopTimesByTrip(ctx, tripID)
+	if err != nil {
+		http.Error(w, "There was an error loading the trip", http.StatusInternalServerError)
+		return
+	}
+	if len(stopTimes) == 0 {
+		http.Error(w, fmt.Sprintf("Trip %q not found", tripID), http.StatusNotFound)
+		return
+	}
+
+	from, to := -1, -1
+	if fromStop != "" || toStop != "" {
+		parents, err := wh.parentStations(ctx, stopTimes)
+		if err != nil {
+			http.Error(w, "There was an error loading the stops", http.StatusInternalServerError)
+			return
+		}
+		from, to = 0, len(stopTimes)-1
+		if fromStop != "" {
+			if from = stopPosition(stopTimes, parents, fromStop, 0); from < 0 {
+				http.Error(w, fmt.Sprintf("Stop %q is not served by trip %q", fromStop, tripID), http.StatusBadRequest)
+				return
+			}
+		}
+		if toStop != "" {
+			if to = stopPosition(stopTimes, parents, toStop, from+1); to < 0 {
+				http.Error(w, fmt.Sprintf("Stop %q is not served by trip %q after %q", toStop, tripID, fromStop), http.StatusBadRequest)
+				return
+			}
+		}
+		if from >= to {
+			http.Error(w, "'from_stop' must come before 'to_stop'", http.StatusBadRequest)
+			return
+		}
+	}
+
+	src, err := wh.loadGeometry(ctx, map[string][]models.StopTime{tripID: stopTimes})
+	if err != nil {
+		http.Error(w, "There was an error loading the shape", http.StatusInternalServerError)
+		return
+	}
+	geometry, err := src.tripGeometry(tripID, stopTimes, from, to)
+	if errors.Is(err, errTripNotFound) {
+		http.Error(w, fmt.Sprintf("Trip %q not found", tripID), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "There was an error loading the shape", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, geometry)
+}
+
+// parentStations maps the stops of stopTimes to their parent station.
+func (wh *DatabaseHandler) parentStations(ctx context.Context, stopTimes []models.StopTime) (map[string]string, error) {
+	ids := make([]string, len(stopTimes))
+	for i, st := range stopTimes {
+		ids[i] = st.StopID
+	}
+	stops, err := wh.databaseStore.GetStopsByID(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	parents := make(map[string]string, len(stops))
+	for _, s := range stops {
+		parents[s.StopID] = s.ParentStation
+	}
+	return parents, nil
+}
+
+// attachLegGeometry fills the geometry of every leg of journeys. The stop
+// times, trips, shapes and stops of all legs are loaded once.
+func (wh *DatabaseHandler) attachLegGeometry(ctx context.Context, journeys []models.Journey) error {
+	var tripIDs []string
+	for _, j := range journeys {
+		for _, leg := range j.Legs {
+			if len(leg.Stops) >= 2 && !slices.Contains(tripIDs, leg.TripId) {
+				tripIDs = append(tripIDs, leg.TripId)
+			}
+		}
+	}
+	if len(tripIDs) == 0 {
+		return nil
+	}
+	// The store gives the stop times of each trip one after the other.
+	all, err := wh.databaseStore.GetStopTimesByTrips(ctx, tripIDs)
+	if err != nil {
+		return err
+	}
+	stopTimes := make(map[string][]models.StopTime, len(tripIDs))
+	for _, st := range all {
+		stopTimes[st.TripID] = append(stopTimes[st.TripID], st)
+	}
+	src, err := wh.loadGeometry(ctx, stopTimes)
+	if err != nil {
+		return err
+	}
+
+	for i := range journeys {
+		for l := range journeys[i].Legs {
+			leg := &journeys[i].Legs[l]
+			if len(leg.Stops) < 2 {
+				continue
+			}
+			sts := stopTimes[leg.TripId]
+
+			from, to := -1, -1
+			first, last := leg.Stops[0].StopSequence, leg.Stops[len(leg.Stops)-1].StopSequence
+			for p, st := range sts {
+				if st.StopSequence == first {
+					from = p
+				}
+				if st.StopSequence == last {
+					to = p
+				}
+			}
+			if from < 0 || to <= from {
+				continue
+			}
+
+			geometry, err := src.tripGeometry(leg.TripId, sts, from, to)
+			if errors.Is(err, errTripNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			leg.Geometry = geometry
+		}
+	}
+	return nil
+}
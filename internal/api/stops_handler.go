@@ -0,0 +1,316 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/Hajdudev/ecoDatabase/internal/geo"
+	"github.com/Hajdudev/ecoDatabase/internal/gtfs"
+	"github.com/Hajdudev/ecoDatabase/internal/search"
+	"github.com/Hajdudev/ecoDatabase/models"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	defaultSearchLimit = 10
+	maxSearchLimit     = 50
+
+	defaultNearbyRadius = 500
+	maxNearbyRadius     = 5000
+	defaultNearbyLimit  = 20
+	maxNearbyLimit      = 100
+)
+
+// allowCORS sets the CORS headers shared by the read-only endpoints and
+// reports whether the request was a preflight that has been answered.
+func allowCORS(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return true
+	}
+	return false
+}
+
+// intParam reads an optional integer query parameter within [lo, hi].
+func intParam(r *http.Request, name string, def, lo, hi int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < lo || n > hi {
+		return 0, fmt.Errorf("Invalid '%s' parameter, expected %d-%d", name, lo, hi)
+	}
+	return n, nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+	}
+}
+
+// ResetFeed drops everything the handler built from the store, for when
+// another feed version becomes active. The indexes are kept per feed
+// version, so this only frees memory early.
+func (wh *DatabaseHandler) ResetFeed() {
+	wh.indexMu.Lock()
+	wh.indexes = nil
+	wh.indexMu.Unlock()
+
+	wh.tiler.Reset()
+}
+
+// feedIndexes returns the indexes of the feed version of ctx, making room
+// for them when they are new. wh.indexMu must be held.
+func (wh *DatabaseHandler) feedIndexes(ctx context.Context) *feedIndexes {
+	version, _ := gtfs.FeedVersion(ctx)
+	for i, idx := range wh.indexes {
+		if idx.version == version {
+			// Move it to the end, so the least recently used goes first.
+			wh.indexes = append(slices.Delete(wh.indexes, i, i+1), idx)
+			return idx
+		}
+	}
+	idx := &feedIndexes{version: version}
+	if len(wh.indexes) >= indexedVersions {
+		wh.indexes = wh.indexes[1:]
+	}
+	wh.indexes = append(wh.indexes, idx)
+	return idx
+}
+
+// loadIndex returns the index slot picks from the indexes of the feed
+// version of ctx, building it on first use. The build runs outside
+// wh.indexMu and is not cancelled with the request that started it;
+// requests for an index that is still building wait for it, each until
+// its own ctx is done. A failed build is dropped, so the next request
+// builds the index again.
+func loadIndex[T any](ctx context.Context, wh *DatabaseHandler, slot func(*feedIndexes) **builtIndex[T], build func(context.Context) (T, error)) (T, error) {
+	wh.indexMu.Lock()
+	ref := slot(wh.feedIndexes(ctx))
+	b := *ref
+	if b == nil {
+		b = &builtIndex[T]{done: make(chan struct{})}
+		*ref = b
+		go func(ctx context.Context) {
+			b.value, b.err = build(ctx)
+			close(b.done)
+			if b.err == nil {
+				return
+			}
+			wh.indexMu.Lock()
+			defer wh.indexMu.Unlock()
+			if *ref == b {
+				*ref = nil
+			}
+		}(context.WithoutCancel(ctx))
+	}
+	wh.indexMu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	case <-b.done:
+		return b.value, b.err
+	}
+}
+
+// stopSearchIndex returns the autocomplete index of the feed version of
+// ctx, building it on first use.
+func (wh *DatabaseHandler) stopSearchIndex(ctx context.Context) (*search.Index, error) {
+	return loadIndex(ctx, wh, func(f *feedIndexes) **builtIndex[*search.Index] { return &f.searchIndex }, wh.buildSearchIndex)
+}
+
+func (wh *DatabaseHandler) buildSearchIndex(ctx context.Context) (*search.Index, error) {
+	var (
+		stops      []models.Stop
+		departures map[string]int
+	)
+	g, gctx := errgroup.WithContext(ctx)
+	g.Go(func() (err error) {
+		stops, err = wh.databaseStore.GetAllStops(gctx)
+		return err
+	})
+	g.Go(func() (err error) {
+		departures, err = wh.databaseStore.GetStopDepartureCounts(gctx)
+		return err
+	})
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return search.NewIndex(stops, departures), nil
+}
+
+type stopSearchResponse struct {
+	Results []models.StopSearchResult `json:"results"`
+	Total   int                       `json:"total"`
+	Offset  int                       `json:"offset"`
+	Limit   int                       `json:"limit"`
+}
+
+// SearchStops serves /stops/search?q=&limit=&offset=, the ranked stop
+// autocomplete.
+func (wh *DatabaseHandler) SearchStops(w http.ResponseWriter, r *http.Request) {
+	if allowCORS(w, r) {
+		return
+	}
+	ctx := r.Context()
+
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		http.Error(w, "Missing required parameter 'q'", http.StatusBadRequest)
+		return
+	}
+	limit, err := intParam(r, "limit", defaultSearchLimit, 1, maxSearchLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	offset, err := intParam(r, "offset", 0, 0, 10000)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	idx, err := wh.stopSearchIndex(ctx)
+	if err != nil {
+		http.Error(w, "There was an error loading the stops", http.StatusInternalServerError)
+		return
+	}
+
+	results, total := idx.Search(q, limit, offset)
+	for i := range results {
+		results[i].Alerts = wh.stopAlerts(results[i].StopIDs...)
+	}
+	writeJSON(w, stopSearchResponse{
+		Results: results,
+		Total:   total,
+		Offset:  offset,
+		Limit:   limit,
+	})
+}
+
+// stopSpatialIndex returns the grid of all stops of the feed version of
+// ctx, building it on first use. Child stops that leave
+// wheelchair_boarding empty inherit the value of their parent station, as
+// the GTFS spec describes.
+func (wh *DatabaseHandler) stopSpatialIndex(ctx context.Context) (*geo.Grid[models.Stop], error) {
+	return loadIndex(ctx, wh, func(f *feedIndexes) **builtIndex[*geo.Grid[models.Stop]] { return &f.stopGrid }, wh.buildSpatialIndex)
+}
+
+func (wh *DatabaseHandler) buildSpatialIndex(ctx context.Context) (*geo.Grid[models.Stop], error) {
+	stops, err := wh.databaseStore.GetAllStops(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	wheelchair := make(map[string]int)
+	for _, s := range stops {
+		if s.LocationType == gtfs.LocationStation {
+			wheelchair[s.StopID] = s.WheelchairBoarding
+		}
+	}
+
+	grid := geo.NewGrid[models.Stop](0.01)
+	for _, s := range stops {
+		if s.WheelchairBoarding == 0 && s.ParentStation != "" {
+			s.WheelchairBoarding = wheelchair[s.ParentStation]
+		}
+		grid.Insert(s.StopLat, s.StopLon, s)
+	}
+	return grid, nil
+}
+
+// floatParam reads a required floating point query parameter.
+func floatParam(r *http.Request, name string) (float64, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return 0, fmt.Errorf("Missing required parameter '%s'", name)
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid '%s' parameter", name)
+	}
+	return f, nil
+}
+
+// NearbyStops serves /stops/nearby?lat=&lon=&radius=&limit=, optionally
+// filtered by location_type and wheelchair_boarding.
+func (wh *DatabaseHandler) NearbyStops(w http.ResponseWriter, r *http.Request) {
+	if allowCORS(w, r) {
+		return
+	}
+	ctx := r.Context()
+
+	lat, err := floatParam(r, "lat")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	lon, err := floatParam(r, "lon")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !geo.ValidCoordinate(lat, lon) {
+		http.Error(w, "Coordinates out of range", http.StatusBadRequest)
+		return
+	}
+	radius, err := intParam(r, "radius", defaultNearbyRadius, 1, maxNearbyRadius)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := intParam(r, "limit", defaultNearbyLimit, 1, maxNearbyLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	locationType, err := intParam(r, "location_type", -1, 0, gtfs.LocationBoarding)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	wheelchair, err := intParam(r, "wheelchair_boarding", -1, 0, 2)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	grid, err := wh.stopSpatialIndex(ctx)
+	if err != nil {
+		http.Error(w, "There was an error loading the stops", http.StatusInternalServerError)
+		return
+	}
+
+	keep := func(s models.Stop) bool {
+		return (locationType < 0 || s.LocationType == locationType) &&
+			(wheelchair < 0 || s.WheelchairBoarding == wheelchair)
+	}
+	neighbors := grid.Within(lat, lon, float64(radius), keep)
+	if len(neighbors) > limit {
+		neighbors = neighbors[:limit]
+	}
+
+	stops := make([]models.NearbyStop, len(neighbors))
+	for i, n := range neighbors {
+		stops[i] = models.NearbyStop{
+			Stop:           n.Value,
+			DistanceMeters: math.Round(n.Distance*10) / 10,
+			Alerts:         wh.stopAlerts(n.Value.StopID, n.Value.ParentStation),
+		}
+	}
+	writeJSON(w, stops)
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Hajdudev/ecoDatabase/internal/store"
+	"github.com/Hajdudev/ecoDatabase/models"
+)
+
+// blockingStore holds GetAllStops until block is closed and counts the
+// calls.
+type blockingStore struct {
+	store.DatabaseStore
+	block chan struct{}
+	calls atomic.Int32
+}
+
+func (s *blockingStore) GetAllStops(ctx context.Context) ([]models.Stop, error) {
+	s.calls.Add(1)
+	select {
+	case <-s.block:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return s.DatabaseStore.GetAllStops(ctx)
+}
+
+func TestStopIndexBuildOutlivesRequest(t *testing.T) {
+	wh := newTestHandler(t)
+	source := &blockingStore{DatabaseStore: wh.databaseStore, block: make(chan struct{})}
+	wh.databaseStore = source
+
+	// The request that starts the build gives up, but the build goes on
+	// without holding the lock.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := wh.stopSearchIndex(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+	if !wh.indexMu.TryLock() {
+		t.Fatal("the index lock is held while the index builds")
+	}
+	wh.indexMu.Unlock()
+
+	close(source.block)
+	idx, err := wh.stopSearchIndex(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results, _ := idx.Search("Market", 1, 0); len(results) != 1 {
+		t.Errorf("got %v, want Market", results)
+	}
+	if _, err := wh.stopSpatialIndex(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// One load for the search index, which outlived its request, and one
+	// for the grid.
+	if n := source.calls.Load(); n != 2 {
+		t.Errorf("stops were loaded %d times, want 2", n)
+	}
+}
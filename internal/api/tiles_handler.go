@@ -0,0 +1,54 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/Hajdudev/ecoDatabase/internal/tiles"
+)
+
+// tileCacheSize is how many rendered tiles are kept in memory.
+const tileCacheSize = 4096
+
+// Tile serves /tiles/{z}/{x}/{y}.mvt, a Mapbox Vector Tile with a "stops"
+// and a "shapes" layer.
+func (wh *DatabaseHandler) Tile(w http.ResponseWriter, r *http.Request) {
+	if allowCORS(w, r) {
+		return
+	}
+	ctx := r.Context()
+
+	z, errZ := strconv.Atoi(chi.URLParam(r, "z"))
+	x, errX := strconv.Atoi(chi.URLParam(r, "x"))
+	y, errY := strconv.Atoi(chi.URLParam(r, "y"))
+	if errZ != nil || errX != nil || errY != nil || z < 0 || z > tiles.MaxZoom || x < 0 || y < 0 || x >= 1<<z || y >= 1<<z {
+		http.Error(w, "Invalid tile coordinates", http.StatusBadRequest)
+		return
+	}
+
+	tile, err := wh.tiler.Tile(ctx, z, x, y)
+	if err != nil {
+		wh.logger.Printf("tiles: rendering %d/%d/%d: %v", z, x, y, err)
+		http.Error(w, "There was an error rendering the tile", http.StatusInternalServerError)
+		return
+	}
+
+	// The URL of a tile stays the same when another feed version becomes
+	// active, so clients keep tiles only briefly. The ETag turns their
+	// revalidation into a 304 while the tile is unchanged.
+	w.Header().Set("Content-Type", "application/vnd.mapbox-vector-tile")
+	w.Header().Set("Cache-Control", "public, max-age=60, must-revalidate")
+	if len(tile) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	sum := sha256.Sum256(tile)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(tile))
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestTileCaching(t *testing.T) {
+	wh := newTestHandler(t)
+	r := chi.NewRouter()
+	r.Get("/tiles/{z}/{x}/{y}.mvt", wh.Tile)
+	serve := func(target, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// The tile around Central.
+	rec := serve("/tiles/10/560/355.mvt", "")
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || rec.Body.Len() == 0 || etag == "" {
+		t.Fatalf("status %d, %d bytes, ETag %q", rec.Code, rec.Body.Len(), etag)
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc != "public, max-age=60, must-revalidate" {
+		t.Errorf("Cache-Control %q", cc)
+	}
+	if rec := serve("/tiles/10/560/355.mvt", etag); rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("revalidation: status %d with %d bytes, want 304", rec.Code, rec.Body.Len())
+	}
+	if rec := serve("/tiles/10/560/355.mvt", `"stale"`); rec.Code != http.StatusOK {
+		t.Errorf("stale ETag: status %d, want 200", rec.Code)
+	}
+
+	if rec := serve("/tiles/10/0/0.mvt", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("empty tile: status %d, want 204", rec.Code)
+	}
+	if rec := serve("/tiles/10/1024/0.mvt", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("tile outside the zoom level: status %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/Hajdudev/ecoDatabase/internal/gtfs"
+	"github.com/Hajdudev/ecoDatabase/internal/realtime"
+	"github.com/Hajdudev/ecoDatabase/models"
+)
+
+// TripDetail serves /trips/{trip_id}?date=, the trip with its route, its
+// stops and the dates it runs on. With a date the stops also get
+// timestamps and realtime predictions for that day.
+func (wh *DatabaseHandler) TripDetail(w http.ResponseWriter, r *http.Request) {
+	if allowCORS(w, r) {
+		return
+	}
+	ctx := r.Context()
+
+	tripID := chi.URLParam(r, "trip_id")
+	date := r.URL.Query().Get("date")
+	var day time.Time
+	if date != "" {
+		var err error
+		if day, err = gtfs.ParseDate(date); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		date = day.Format("2006-01-02")
+	}
+
+	trips, err := wh.databaseStore.GetTripsByID(ctx, []string{tripID})
+	if err != nil {
+		http.Error(w, "There was an error loading the trip", http.StatusInternalServerError)
+		return
+	}
+	if len(trips) == 0 {
+		http.Error(w, fmt.Sprintf("Trip %q not found", tripID), http.StatusNotFound)
+		return
+	}
+	detail := models.TripDetail{Trip: trips[0], Date: date}
+
+	var (
+		routes     []models.Route
+		stopTimes  []models.StopTime
+		stops      []models.Stop
+		ids        []string
+		calendars  []models.Calendar
+		exceptions []models.CalendarDate
+	)
+	g, gctx := errgroup.WithContext(ctx)
+	g.Go(func() (err error) {
+		routes, err = wh.databaseStore.GetRoutesByID(gctx, []string{detail.RouteID})
+		return err
+	})
+	g.Go(func() (err error) {
+		if stopTimes, err = wh.databaseStore.GetStopTimesByTrip(gctx, tripID); err != nil {
+			return err
+		}
+		ids = make([]string, len(stopTimes))
+		for i, st := range stopTimes {
+			ids[i] = st.StopID
+		}
+		stops, err = wh.databaseStore.GetStopsByID(gctx, ids)
+		return err
+	})
+	g.Go(func() (err error) {
+		calendars, exceptions, err = wh.databaseStore.GetServiceCalendar(gctx, detail.ServiceID)
+		return err
+	})
+	if err := g.Wait(); err != nil {
+		http.Error(w, "There was an error loading the trip", http.StatusInternalServerError)
+		return
+	}
+	if len(routes) > 0 {
+		detail.Route = routes[0]
+	}
+	stopByID := make(map[string]models.Stop, len(stops))
+	for _, s := range stops {
+		stopByID[s.StopID] = s
+	}
+
+	detail.ServiceDates = []string{}
+	for _, d := range gtfs.ServiceDates(calendars, exceptions) {
+		detail.ServiceDates = append(detail.ServiceDates, d.Format("2006-01-02"))
+	}
+
+	start := gtfs.ServiceDayStart(day, wh.planner.Location())
+	detail.Stops = make([]models.TripStop, len(stopTimes))
+	for i, st := range stopTimes {
+		s := stopByID[st.StopID]
+		detail.Stops[i] = models.TripStop{
+			StopTime:           st,
+			StopName:           s.StopName,
+			StopLat:            s.StopLat,
+			StopLon:            s.StopLon,
+			PlatformCode:       s.PlatformCode,
+			WheelchairBoarding: s.WheelchairBoarding,
+		}
+		if date == "" {
+			continue
+		}
+		if arr, err := gtfs.ParseTime(st.ArrivalTime); err == nil {
+			t := start.Add(time.Duration(arr) * time.Second)
+			detail.Stops[i].ArrivalTimestamp = &t
+		}
+		if dep, err := gtfs.ParseTime(st.DepartureTime); err == nil {
+			t := start.Add(time.Duration(dep) * time.Second)
+			detail.Stops[i].DepartureTimestamp = &t
+		}
+	}
+
+	from, to := time.Now(), time.Now()
+	if date != "" {
+		runs := slices.Contains(detail.ServiceDates, date)
+		detail.RunsOnDate = &runs
+		applyTripDetailUpdates(wh.tripUpdates, &detail)
+		if n := len(detail.Stops); n > 0 && detail.Stops[0].DepartureTimestamp != nil && detail.Stops[n-1].ArrivalTimestamp != nil {
+			from, to = *detail.Stops[0].DepartureTimestamp, *detail.Stops[n-1].ArrivalTimestamp
+		}
+	}
+	scope := realtime.Scope{
+		AgencyID:  detail.Route.AgencyID,
+		RouteID:   detail.RouteID,
+		RouteType: -1,
+		TripID:    detail.TripID,
+		StopIDs:   ids,
+	}
+	if detail.Route.RouteID != "" {
+		scope.RouteType = detail.Route.RouteType
+	}
+	detail.Alerts = wh.alerts.Matching(&scope, from, to)
+
+	writeJSON(w, detail)
+}
+
+// applyTripDetailUpdates fills the predictions of the stops of a trip on
+// its requested date.
+func applyTripDetailUpdates(tripUpdates *realtime.TripUpdates, detail *models.TripDetail) {
+	if tripUpdates == nil || len(detail.Stops) == 0 {
+		return
+	}
+
+	keys := make([]realtime.StopKey, len(detail.Stops))
+	for i, s := range detail.Stops {
+		keys[i] = realtime.StopKey{StopID: s.StopID, Sequence: s.StopSequence}
+		if s.ArrivalTimestamp != nil {
+			keys[i].ScheduledArrival = *s.ArrivalTimestamp
+		}
+		if s.DepartureTimestamp != nil {
+			keys[i].ScheduledDeparture = *s.DepartureTimestamp
+		}
+	}
+
+	prediction, ok := tripUpdates.Predict(detail.TripID, strings.ReplaceAll(detail.Date, "-", ""), keys)
+	if !ok {
+		return
+	}
+	detail.Realtime = true
+	detail.Cancelled = prediction.Cancelled
+	for i, p := range prediction.Stops {
+		detail.Stops[i].Skipped = p.Skipped
+		if p.Known && !p.Skipped {
+			arrival, departure := p.Arrival, p.Departure
+			detail.Stops[i].PredictedArrival = &arrival
+			detail.Stops[i].PredictedDeparture = &departure
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/Hajdudev/ecoDatabase/models"
+)
+
+func TestTripDetail(t *testing.T) {
+	wh := newTestHandler(t)
+
+	var detail models.TripDetail
+	decode(t, get(wh.TripDetail, "/trips/{trip_id}", "/trips/T1"), &detail)
+	var stops []string
+	for _, s := range detail.Stops {
+		stops = append(stops, s.StopID+" "+s.StopName)
+	}
+	if want := []string{"A1 Central", "M Middle", "B Market"}; !slices.Equal(stops, want) {
+		t.Errorf("stops %q, want %q", stops, want)
+	}
+	if detail.Route.RouteShortName != "1" || detail.RunsOnDate != nil || detail.Stops[0].DepartureTimestamp != nil {
+		t.Errorf("trip without a date: %+v", detail)
+	}
+
+	tests := []struct {
+		date string
+		runs bool
+	}{
+		{"2025-03-04", true},
+		// Weekday service is removed on 2025-03-03.
+		{"2025-03-03", false},
+		{"2025-03-08", false},
+	}
+	for _, tc := range tests {
+		var detail models.TripDetail
+		decode(t, get(wh.TripDetail, "/trips/{trip_id}", "/trips/T1?date="+tc.date), &detail)
+		if detail.RunsOnDate == nil || *detail.RunsOnDate != tc.runs {
+			t.Errorf("%s: runs_on_date %v, want %v", tc.date, detail.RunsOnDate, tc.runs)
+		}
+		if ts := detail.Stops[0].DepartureTimestamp; ts == nil || ts.Format("2006-01-02 15:04") != tc.date+" 08:00" {
+			t.Errorf("%s: first departure at %v", tc.date, ts)
+		}
+	}
+
+	for target, status := range map[string]int{
+		"/trips/NOPE":                 http.StatusNotFound,
+		"/trips/T1?date=2025-02-30":   http.StatusBadRequest,
+		"/trips/T1?date=tomorrow":     http.StatusBadRequest,
+		"/trips/NOPE?date=2025-03-04": http.StatusNotFound,
+	} {
+		if rec := get(wh.TripDetail, "/trips/{trip_id}", target); rec.Code != status {
+			t.Errorf("%s: status %d, want %d", target, rec.Code, status)
+		}
+	}
+}
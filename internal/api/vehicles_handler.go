@@ -0,0 +1,199 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Hajdudev/ecoDatabase/internal/realtime"
+	"github.com/Hajdudev/ecoDatabase/models"
+)
+
+// vehicleStreamHeartbeat keeps idle /vehicles/stream connections open
+// through proxies that drop silent connections.
+const vehicleStreamHeartbeat = 15 * time.Second
+
+// vehicleFilter holds the /vehicles query parameters.
+type vehicleFilter struct {
+	bbox    bool
+	minLat  float64
+	minLon  float64
+	maxLat  float64
+	maxLon  float64
+	routeID string
+	tripID  string
+}
+
+// parseVehicleFilter reads bbox=minLon,minLat,maxLon,maxLat, route and trip.
+func parseVehicleFilter(r *http.Request) (vehicleFilter, error) {
+	query := r.URL.Query()
+	f := vehicleFilter{
+		routeID: query.Get("route"),
+		tripID:  query.Get("trip"),
+	}
+
+	if v := query.Get("bbox"); v != "" {
+		parts := strings.Split(v, ",")
+		if len(parts) != 4 {
+			return f, fmt.Errorf("Invalid 'bbox' parameter, expected minLon,minLat,maxLon,maxLat")
+		}
+		var coords [4]float64
+		for i, p := range parts {
+			c, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+			if err != nil {
+				return f, fmt.Errorf("Invalid 'bbox' parameter, expected minLon,minLat,maxLon,maxLat")
+			}
+			coords[i] = c
+		}
+		f.bbox = true
+		f.minLon, f.minLat, f.maxLon, f.maxLat = coords[0], coords[1], coords[2], coords[3]
+		if f.minLat > f.maxLat || f.minLon > f.maxLon {
+			return f, fmt.Errorf("Invalid 'bbox' parameter, minimum is above maximum")
+		}
+	}
+	return f, nil
+}
+
+func (f vehicleFilter) match(v models.Vehicle) bool {
+	if f.routeID != "" && v.RouteID != f.routeID {
+		return false
+	}
+	if f.tripID != "" && v.TripID != f.tripID {
+		return false
+	}
+	if f.bbox && (v.Lat < f.minLat || v.Lat > f.maxLat || v.Lon < f.minLon || v.Lon > f.maxLon) {
+		return false
+	}
+	return true
+}
+
+func (f vehicleFilter) apply(vehicles []models.Vehicle) []models.Vehicle {
+	out := make([]models.Vehicle, 0, len(vehicles))
+	for _, v := range vehicles {
+		if f.match(v) {
+			out = append(out, v)
+		}
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].VehicleID < out[b].VehicleID })
+	return out
+}
+
+// Vehicles serves /vehicles?bbox=&route=&trip=, the latest GTFS-RT vehicle
+// positions.
+func (wh *DatabaseHandler) Vehicles(w http.ResponseWriter, r *http.Request) {
+	if allowCORS(w, r) {
+		return
+	}
+
+	filter, err := parseVehicleFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, filter.apply(wh.vehicles.All()))
+}
+
+// VehicleStream serves /vehicles/stream as Server-Sent Events. The stream
+// starts with a "snapshot" event holding every matching vehicle, followed
+// by an "update" event per feed refresh with the vehicles that moved and
+// the ids of those that left the feed or the filter.
+func (wh *DatabaseHandler) VehicleStream(w http.ResponseWriter, r *http.Request) {
+	if allowCORS(w, r) {
+		return
+	}
+
+	filter, err := parseVehicleFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The server's write timeout is meant for ordinary requests; a stream
+	// lives until the client goes away.
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		wh.logger.Printf("vehicles stream: clearing write deadline: %v", err)
+	}
+
+	snapshot, events, cancel := wh.vehicles.Subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	// visible tracks which vehicles the client currently holds, so a
+	// vehicle leaving the bbox is reported as removed.
+	visible := make(map[string]bool)
+	initial := filter.apply(snapshot)
+	for _, v := range initial {
+		visible[v.VehicleID] = true
+	}
+	if err := writeEvent(w, "snapshot", initial); err != nil {
+		return
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(vehicleStreamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			update := realtime.VehicleEvent{
+				Updated: []models.Vehicle{},
+				Removed: []string{},
+			}
+			for _, v := range event.Updated {
+				if filter.match(v) {
+					update.Updated = append(update.Updated, v)
+					visible[v.VehicleID] = true
+				} else if visible[v.VehicleID] {
+					update.Removed = append(update.Removed, v.VehicleID)
+					delete(visible, v.VehicleID)
+				}
+			}
+			for _, id := range event.Removed {
+				if visible[id] {
+					update.Removed = append(update.Removed, id)
+					delete(visible, id)
+				}
+			}
+			if len(update.Updated) == 0 && len(update.Removed) == 0 {
+				continue
+			}
+			if err := writeEvent(w, "update", update); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeEvent writes one Server-Sent Event with a JSON payload.
+func writeEvent(w http.ResponseWriter, name string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+	return err
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	gtfsrt "github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/Hajdudev/ecoDatabase/internal/realtime"
+	"github.com/Hajdudev/ecoDatabase/models"
+)
+
+// noLookup joins vehicles with nothing.
+type noLookup struct{}
+
+func (noLookup) GetTripsByID(ctx context.Context, ids []string) ([]models.Trip, error) {
+	return nil, nil
+}
+
+func (noLookup) GetRoutesByID(ctx context.Context, ids []string) ([]models.Route, error) {
+	return nil, nil
+}
+
+func vehiclePositions(positions map[string][2]float32) *gtfsrt.FeedMessage {
+	msg := &gtfsrt.FeedMessage{Header: &gtfsrt.FeedHeader{GtfsRealtimeVersion: proto.String("2.0")}}
+	for id, p := range positions {
+		msg.Entity = append(msg.Entity, &gtfsrt.FeedEntity{
+			Id: proto.String(id),
+			Vehicle: &gtfsrt.VehiclePosition{
+				Vehicle:  &gtfsrt.VehicleDescriptor{Id: proto.String(id)},
+				Trip:     &gtfsrt.TripDescriptor{TripId: proto.String("T-" + id), RouteId: proto.String("R-" + id)},
+				Position: &gtfsrt.Position{Latitude: proto.Float32(p[0]), Longitude: proto.Float32(p[1])},
+			},
+		})
+	}
+	return msg
+}
+
+func newVehiclesHandler() (*DatabaseHandler, *realtime.Vehicles) {
+	logger := log.New(io.Discard, "", 0)
+	vehicles := realtime.NewVehicles(noLookup{}, logger)
+	vehicles.Apply(vehiclePositions(map[string][2]float32{
+		"IN":    {48.15, 17.10},
+		"OUT":   {48.30, 17.10},
+		"OTHER": {48.15, 17.12},
+	}))
+	return NewDatabaseHandler(nil, nil, nil, vehicles, nil, logger), vehicles
+}
+
+func vehicleIDs(vehicles []models.Vehicle) []string {
+	ids := []string{}
+	for _, v := range vehicles {
+		ids = append(ids, v.VehicleID)
+	}
+	return ids
+}
+
+func TestVehiclesFilter(t *testing.T) {
+	wh, _ := newVehiclesHandler()
+	tests := []struct {
+		query  string
+		status int
+		want   []string
+	}{
+		{"", http.StatusOK, []string{"IN", "OTHER", "OUT"}},
+		{"bbox=17.0,48.1,17.2,48.2", http.StatusOK, []string{"IN", "OTHER"}},
+		{"bbox=17.0,48.1,17.11,48.2", http.StatusOK, []string{"IN"}},
+		{"bbox=17.0,48.1,17.2,48.2&route=R-OTHER", http.StatusOK, []string{"OTHER"}},
+		{"trip=T-OUT", http.StatusOK, []string{"OUT"}},
+		{"bbox=17.0,48.1,17.2", http.StatusBadRequest, nil},
+		{"bbox=17.0,48.1,17.2,north", http.StatusBadRequest, nil},
+		{"bbox=17.2,48.1,17.0,48.2", http.StatusBadRequest, nil},
+	}
+	for _, tc := range tests {
+		rec := httptest.NewRecorder()
+		wh.Vehicles(rec, httptest.NewRequest(http.MethodGet, "/vehicles?"+tc.query, nil))
+		if rec.Code != tc.status {
+			t.Errorf("%q: status %d, want %d", tc.query, rec.Code, tc.status)
+			continue
+		}
+		if tc.status != http.StatusOK {
+			continue
+		}
+		var got []models.Vehicle
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if ids := vehicleIDs(got); !slices.Equal(ids, tc.want) {
+			t.Errorf("%q: got %v, want %v", tc.query, ids, tc.want)
+		}
+	}
+}
+
+// readEvent reads the next Server-Sent Event, skipping heartbeats.
+func readEvent(t *testing.T, r *bufio.Reader) (name string, data []byte) {
+	t.Helper()
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading the stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = []byte(strings.TrimPrefix(line, "data: "))
+		case line == "" && name != "":
+			return name, data
+		}
+	}
+}
+
+func TestVehicleStream(t *testing.T) {
+	wh, vehicles := newVehiclesHandler()
+	srv := httptest.NewServer(http.HandlerFunc(wh.VehicleStream))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"?bbox=17.0,48.1,17.11,48.2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type %q", ct)
+	}
+	body := bufio.NewReader(resp.Body)
+
+	name, data := readEvent(t, body)
+	var snapshot []models.Vehicle
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if name != "snapshot" || !slices.Equal(vehicleIDs(snapshot), []string{"IN"}) {
+		t.Fatalf("first event %s %s", name, data)
+	}
+
+	// IN leaves the bbox and OTHER enters it; OUT moves outside of it and
+	// is not reported.
+	vehicles.Apply(vehiclePositions(map[string][2]float32{
+		"IN":    {48.30, 17.10},
+		"OUT":   {48.31, 17.10},
+		"OTHER": {48.15, 17.105},
+	}))
+	name, data = readEvent(t, body)
+	var update realtime.VehicleEvent
+	if err := json.Unmarshal(data, &update); err != nil {
+		t.Fatal(err)
+	}
+	if name != "update" || !slices.Equal(vehicleIDs(update.Updated), []string{"OTHER"}) || !slices.Equal(update.Removed, []string{"IN"}) {
+		t.Errorf("update event %s %s", name, data)
+	}
+}
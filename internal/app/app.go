@@ -1,41 +1,248 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/Hajdudev/ecoDatabase/internal/api"
+	"github.com/Hajdudev/ecoDatabase/internal/gtfs"
+	"github.com/Hajdudev/ecoDatabase/internal/planner"
+	"github.com/Hajdudev/ecoDatabase/internal/realtime"
 	"github.com/Hajdudev/ecoDatabase/internal/store"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/joho/godotenv"
 )
 
 type Application struct {
 	Logger          *log.Logger
 	DatabaseHandler *api.DatabaseHandler
-	Database        *pgxpool.Pool
+	Database        store.Database
+
+	// ActiveVersion is the id of the active feed version, nil without a
+	// database.
+	ActiveVersion *store.ActiveVersion
+
+	// Cache is the cache in front of Database, nil when the store is not
+	// cached.
+	Cache *store.CachedStore
+
+	// FeedChanged drops everything cached from the previously active feed
+	// version. It runs when this server activates a version and when
+	// another process does.
+	FeedChanged func()
+
+	// AdminToken is the bearer token of the admin API, which is disabled
+	// when it is empty.
+	AdminToken string
 }
 
 func NewApplication() (*Application, error) {
 	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
+	// The store is chosen before store.Open runs, so .env is read here too.
+	_ = godotenv.Load()
 
-	db, err := store.Open()
-	if err != nil {
-		return nil, err
+	var db store.Database
+	var cache *store.CachedStore
+	var databaseStore store.DatabaseStore
+	switch backend := os.Getenv("STORE"); backend {
+	case "", "database", "postgres":
+		// The scheme of DATABASE_URL picks Postgres or SQLite.
+		var err error
+		if db, err = store.Open(); err != nil {
+			return nil, err
+		}
+		if v := os.Getenv("AUTO_MIGRATE"); v != "" {
+			autoMigrate, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid AUTO_MIGRATE %q", v)
+			}
+			if autoMigrate {
+				applied, err := store.MigrateUp(context.Background(), db)
+				if err != nil {
+					return nil, err
+				}
+				for _, m := range applied {
+					logger.Printf("migrate: applied %d_%s", m.Version, m.Name)
+				}
+			}
+		}
+		databaseStore = db
+
+		cacheOpts := store.DefaultCacheOptions
+		if v := os.Getenv("CACHE_SIZE"); v != "" {
+			size, err := strconv.Atoi(v)
+			if err != nil || size < 0 {
+				return nil, fmt.Errorf("invalid CACHE_SIZE %q", v)
+			}
+			cacheOpts.Size = size
+		}
+		if cacheOpts.Size > 0 {
+			cache = store.NewCachedStore(db, cacheOpts)
+			databaseStore = cache
+		}
+	case "memory":
+		memoryStore, err := loadMemoryStore(os.Getenv("GTFS_FEED"), logger)
+		if err != nil {
+			return nil, err
+		}
+		databaseStore = memoryStore
+	default:
+		return nil, fmt.Errorf("invalid STORE %q, expected database or memory", backend)
+	}
+
+	plannerOpts := planner.DefaultOptions
+	plannerOpts.Logger = logger
+	if tz := os.Getenv("FEED_TIMEZONE"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, fmt.Errorf("invalid FEED_TIMEZONE: %w", err)
+		}
+		plannerOpts.Location = loc
+	}
+	if v := os.Getenv("WALK_SPEED"); v != "" {
+		speed, err := strconv.ParseFloat(v, 64)
+		if err != nil || speed <= 0 {
+			return nil, fmt.Errorf("invalid WALK_SPEED %q, expected metres per second", v)
+		}
+		plannerOpts.WalkSpeed = speed
+	}
+	if v := os.Getenv("MAX_WALK_METERS"); v != "" {
+		meters, err := strconv.ParseFloat(v, 64)
+		if err != nil || meters < 0 {
+			return nil, fmt.Errorf("invalid MAX_WALK_METERS %q", v)
+		}
+		plannerOpts.MaxWalkMeters = meters
 	}
 
-	databaseStore := store.NewPostgresStore(db)
-	dbHandler := api.NewDatabaseHandler(databaseStore, logger)
+	pollInterval := 30 * time.Second
+	if v := os.Getenv("GTFS_RT_POLL_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid GTFS_RT_POLL_INTERVAL %q", v)
+		}
+		pollInterval = d
+	}
+
+	tripUpdates := realtime.NewTripUpdates()
+	if source := os.Getenv("GTFS_RT_TRIP_UPDATES_URL"); source != "" {
+		poller := &realtime.Poller{
+			Source:   source,
+			Interval: pollInterval,
+			Client:   &http.Client{Timeout: pollInterval},
+			Logger:   logger,
+			Apply:    tripUpdates.Apply,
+		}
+		go poller.Run(context.Background())
+	}
+
+	vehicles := realtime.NewVehicles(databaseStore, logger)
+	if source := os.Getenv("GTFS_RT_VEHICLE_POSITIONS_URL"); source != "" {
+		poller := &realtime.Poller{
+			Source:   source,
+			Interval: pollInterval,
+			Client:   &http.Client{Timeout: pollInterval},
+			Logger:   logger,
+			Apply:    vehicles.Apply,
+		}
+		go poller.Run(context.Background())
+	}
+
+	// Manual alerts are shared through the database; with the memory store
+	// they only live in this process.
+	var alertStore realtime.AlertStore
+	if db != nil {
+		alertStore = db
+	}
+	alerts := realtime.NewAlerts(alertStore)
+	if err := alerts.Reload(context.Background()); err != nil {
+		return nil, fmt.Errorf("loading manual alerts: %w", err)
+	}
+	if source := os.Getenv("GTFS_RT_ALERTS_URL"); source != "" {
+		poller := &realtime.Poller{
+			Source:   source,
+			Interval: pollInterval,
+			Client:   &http.Client{Timeout: pollInterval},
+			Logger:   logger,
+			Apply:    alerts.Apply,
+		}
+		go poller.Run(context.Background())
+	}
+
+	routePlanner := planner.New(databaseStore, plannerOpts)
+	dbHandler := api.NewDatabaseHandler(databaseStore, routePlanner, tripUpdates, vehicles, alerts, logger)
+
+	var activeVersion *store.ActiveVersion
+	if db != nil {
+		activeVersion = store.NewActiveVersion(db)
+		if _, err := activeVersion.Refresh(context.Background()); err != nil {
+			logger.Printf("feed: reading the active feed version: %v", err)
+		}
+	}
+
+	feedChanged := func() {
+		if activeVersion != nil {
+			// On failure the next request reads the version itself.
+			if _, err := activeVersion.Refresh(context.Background()); err != nil {
+				logger.Printf("feed: reading the active feed version: %v", err)
+			}
+		}
+		if cache != nil {
+			cache.Invalidate()
+		}
+		routePlanner.Reset()
+		dbHandler.ResetFeed()
+		vehicles.ResetStatic()
+	}
+	if db != nil {
+		checkInterval := time.Minute
+		if v := os.Getenv("FEED_CHECK_INTERVAL"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("invalid FEED_CHECK_INTERVAL %q", v)
+			}
+			checkInterval = d
+		}
+		go store.WatchFeed(context.Background(), checkInterval, db.FeedStamp, logger, feedChanged)
+		// Manual alerts written by other instances show up as often.
+		go alerts.Watch(context.Background(), checkInterval, logger)
+	}
 
 	app := &Application{
 		Logger:          logger,
 		DatabaseHandler: dbHandler,
 		Database:        db,
+		ActiveVersion:   activeVersion,
+		Cache:           cache,
+		FeedChanged:     feedChanged,
+		AdminToken:      os.Getenv("ADMIN_TOKEN"),
 	}
 	return app, nil
 }
 
+// loadMemoryStore reads the GTFS zip at path into a MemoryStore.
+func loadMemoryStore(path string, logger *log.Logger) (*store.MemoryStore, error) {
+	if path == "" {
+		return nil, fmt.Errorf("STORE=memory needs GTFS_FEED, the path of a GTFS zip")
+	}
+	feed, err := gtfs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer feed.Close()
+
+	start := time.Now()
+	memoryStore, err := store.LoadMemoryStore(feed)
+	if err != nil {
+		return nil, fmt.Errorf("loading %s: %w", path, err)
+	}
+	logger.Printf("loaded %s into memory in %s", path, time.Since(start).Round(time.Millisecond))
+	return memoryStore, nil
+}
+
 func (a *Application) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "The app is healthy\n")
 }
@@ -0,0 +1,54 @@
+package geo
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// EarthRadius is the mean earth radius in metres.
+const EarthRadius = 6371008.8
+
+// metresPerDegree is the length of one degree of latitude.
+const metresPerDegree = math.Pi * EarthRadius / 180
+
+// Point is a WGS84 coordinate in degrees.
+type Point struct {
+	Lat float64
+	Lon float64
+}
+
+// Distance returns the great-circle distance in metres between two
+// points given in degrees.
+func Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1 := lat1 * math.Pi / 180
+	phi2 := lat2 * math.Pi / 180
+	dPhi := (lat2 - lat1) * math.Pi / 180
+	dLambda := (lon2 - lon1) * math.Pi / 180
+
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) + math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return 2 * EarthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// ValidCoordinate reports whether lat and lon are within range.
+func ValidCoordinate(lat, lon float64) bool {
+	return lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180
+}
+
+// ParsePoint parses a "lat,lon" pair. ok is false when s is not one. Stop
+// names and codes can look like one too, so callers try those first.
+func ParsePoint(s string) (p Point, ok bool) {
+	latStr, lonStr, found := strings.Cut(s, ",")
+	if !found {
+		return Point{}, false
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(latStr), 64)
+	if err != nil {
+		return Point{}, false
+	}
+	lon, err := strconv.ParseFloat(strings.TrimSpace(lonStr), 64)
+	if err != nil || !ValidCoordinate(lat, lon) {
+		return Point{}, false
+	}
+	return Point{Lat: lat, Lon: lon}, true
+}
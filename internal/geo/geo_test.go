@@ -0,0 +1,53 @@
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParsePoint(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Point
+		ok   bool
+	}{
+		{"48.1486,17.1077", Point{48.1486, 17.1077}, true},
+		{" 48.1486 , 17.1077 ", Point{48.1486, 17.1077}, true},
+		{"-33.9,151.2", Point{-33.9, 151.2}, true},
+		{"90,180", Point{90, 180}, true},
+		{"12,5", Point{12, 5}, true},
+		{"91,0", Point{}, false},
+		{"0,181", Point{}, false},
+		{"48.1486", Point{}, false},
+		{"48.1486,17.1077,3", Point{}, false},
+		{"Hlavná stanica", Point{}, false},
+		{"stop,12", Point{}, false},
+		{"", Point{}, false},
+	}
+	for _, tc := range tests {
+		got, ok := ParsePoint(tc.in)
+		if ok != tc.ok || got != tc.want {
+			t.Errorf("ParsePoint(%q) = %v, %v, want %v, %v", tc.in, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lon1, lat2, lon2 float64
+		want                   float64
+	}{
+		{"same point", 48.1, 17.1, 48.1, 17.1, 0},
+		{"one degree of latitude", 48, 17, 49, 17, metresPerDegree},
+		{"one degree of longitude at the equator", 0, 0, 0, 1, metresPerDegree},
+		{"across the antimeridian", 0, 179.5, 0, -179.5, metresPerDegree},
+		{"pole to pole", 90, 0, -90, 0, math.Pi * EarthRadius},
+	}
+	for _, tc := range tests {
+		got := Distance(tc.lat1, tc.lon1, tc.lat2, tc.lon2)
+		if math.Abs(got-tc.want) > 0.01 {
+			t.Errorf("%s: %f m, want %f m", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package geo
+
+import (
+	"math"
+	"sort"
+)
+
+// Grid is a spatial index that buckets points into cells of a fixed size
+// in degrees. Radius queries only look at the cells overlapping the
+// bounding box of the circle.
+type Grid[T any] struct {
+	cellSize float64
+	cells    map[cell][]gridItem[T]
+	rows     map[int][]int // the populated lon cells of each lat row
+}
+
+type cell struct {
+	lat, lon int
+}
+
+type gridItem[T any] struct {
+	lat, lon float64
+	value    T
+}
+
+// Neighbor is a value found by Within along with its distance in metres.
+type Neighbor[T any] struct {
+	Value    T
+	Distance float64
+}
+
+// NewGrid returns an empty grid. A cell size of 0.01 degrees, about one
+// kilometre, suits stop-level queries.
+func NewGrid[T any](cellSize float64) *Grid[T] {
+	return &Grid[T]{cellSize: cellSize, cells: make(map[cell][]gridItem[T]), rows: make(map[int][]int)}
+}
+
+func (g *Grid[T]) cellOf(lat, lon float64) cell {
+	return cell{int(math.Floor(lat / g.cellSize)), int(math.Floor(lon / g.cellSize))}
+}
+
+func (g *Grid[T]) Insert(lat, lon float64, value T) {
+	c := g.cellOf(lat, lon)
+	if len(g.cells[c]) == 0 {
+		g.rows[c.lat] = append(g.rows[c.lat], c.lon)
+	}
+	g.cells[c] = append(g.cells[c], gridItem[T]{lat: lat, lon: lon, value: value})
+}
+
+// Within returns every value no further than radius metres from the
+// point, closest first. keep, when not nil, filters values before the
+// distance is computed.
+func (g *Grid[T]) Within(lat, lon, radius float64, keep func(T) bool) []Neighbor[T] {
+	dLat := radius / metresPerDegree
+	lo := g.cellOf(math.Max(-90, lat-dLat), lon)
+	hi := g.cellOf(math.Min(90, lat+dLat), lon)
+
+	// The circle spans asin(sin r / cos lat) of longitude either side of
+	// the point. When that reaches 90 degrees a pole lies inside it and
+	// every longitude is in range. Otherwise the span is split in two
+	// where it crosses the antimeridian.
+	var spans [][2]int
+	if x := math.Sin(radius/EarthRadius) / math.Cos(lat*math.Pi/180); x < 1 {
+		dLon := math.Asin(x) * 180 / math.Pi
+		west, east := lon-dLon, lon+dLon
+		switch {
+		case west < -180:
+			spans = [][2]int{g.lonCells(-180, east), g.lonCells(west+360, 180)}
+		case east > 180:
+			spans = [][2]int{g.lonCells(west, 180), g.lonCells(-180, east-360)}
+		default:
+			spans = [][2]int{g.lonCells(west, east)}
+		}
+	}
+	width := 0
+	for _, s := range spans {
+		width += s[1] - s[0] + 1
+	}
+
+	var out []Neighbor[T]
+	visit := func(c cell) {
+		for _, it := range g.cells[c] {
+			if keep != nil && !keep(it.value) {
+				continue
+			}
+			if d := Distance(lat, lon, it.lat, it.lon); d <= radius {
+				out = append(out, Neighbor[T]{Value: it.value, Distance: d})
+			}
+		}
+	}
+	for cl := lo.lat; cl <= hi.lat; cl++ {
+		// Wide spans, found near the poles, look at the populated cells
+		// of the row rather than at every cell in the span.
+		if row := g.rows[cl]; spans == nil || width > len(row) {
+			for _, cn := range row {
+				if spans == nil || inSpans(cn, spans) {
+					visit(cell{cl, cn})
+				}
+			}
+			continue
+		}
+		for _, s := range spans {
+			for cn := s[0]; cn <= s[1]; cn++ {
+				visit(cell{cl, cn})
+			}
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Distance < out[j].Distance })
+	return out
+}
+
+// lonCells returns the first and last lon cell between two longitudes.
+func (g *Grid[T]) lonCells(west, east float64) [2]int {
+	return [2]int{g.cellOf(0, west).lon, g.cellOf(0, east).lon}
+}
+
+func inSpans(cn int, spans [][2]int) bool {
+	for _, s := range spans {
+		if cn >= s[0] && cn <= s[1] {
+			return true
+		}
+	}
+	return false
+}
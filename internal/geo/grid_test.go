@@ -0,0 +1,107 @@
+package geo
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func names(found []Neighbor[string]) []string {
+	var out []string
+	for _, n := range found {
+		out = append(out, n.Value)
+	}
+	return out
+}
+
+func TestGridWithin(t *testing.T) {
+	g := NewGrid[string](0.01)
+	points := []struct {
+		name     string
+		lat, lon float64
+	}{
+		{"centre", 48.1, 17.1},
+		{"north 500 m", 48.1 + 500/metresPerDegree, 17.1},
+		{"north 1000 m", 48.1 + 1000/metresPerDegree, 17.1},
+		{"skip east 300 m", 48.1, 17.1 + 300/metresPerDegree/0.6678},
+		{"far", 48.5, 17.5},
+		{"east of the antimeridian", -17.0, 179.999},
+		{"west of the antimeridian", -17.0, -179.999},
+		{"near the north pole, lon 0", 89.999, 0},
+		{"near the north pole, lon 180", 89.999, 180},
+		{"near the north pole, lon -90", 89.999, -90},
+		{"near the south pole", -89.999, 45},
+	}
+	for _, p := range points {
+		g.Insert(p.lat, p.lon, p.name)
+	}
+	noSkip := func(name string) bool { return !strings.HasPrefix(name, "skip") }
+
+	tests := []struct {
+		name     string
+		lat, lon float64
+		radius   float64
+		keep     func(string) bool
+		want     []string
+	}{
+		{
+			name: "closest first", lat: 48.1, lon: 17.1, radius: 2000,
+			want: []string{"centre", "skip east 300 m", "north 500 m", "north 1000 m"},
+		},
+		{
+			name: "the radius edge is included", lat: 48.1, lon: 17.1, radius: 1000.001,
+			keep: noSkip,
+			want: []string{"centre", "north 500 m", "north 1000 m"},
+		},
+		{
+			name: "just short of the edge", lat: 48.1, lon: 17.1, radius: 999,
+			keep: noSkip,
+			want: []string{"centre", "north 500 m"},
+		},
+		{
+			name: "across the antimeridian", lat: -17.0, lon: 179.9995, radius: 500,
+			want: []string{"east of the antimeridian", "west of the antimeridian"},
+		},
+		{
+			name: "across the antimeridian from the west", lat: -17.0, lon: -179.9999, radius: 500,
+			want: []string{"west of the antimeridian", "east of the antimeridian"},
+		},
+		{
+			name: "at the north pole", lat: 90, lon: 0, radius: 200,
+			want: []string{"near the north pole, lon -90", "near the north pole, lon 0", "near the north pole, lon 180"},
+		},
+		{
+			name: "beside the north pole", lat: 89.999, lon: 0, radius: 100,
+			want: []string{"near the north pole, lon 0"},
+		},
+		{
+			name: "over the north pole", lat: 89.999, lon: 0, radius: 250,
+			want: []string{"near the north pole, lon 0", "near the north pole, lon -90", "near the north pole, lon 180"},
+		},
+		{
+			name: "at the south pole", lat: -90, lon: 0, radius: 200,
+			want: []string{"near the south pole"},
+		},
+	}
+	for _, tc := range tests {
+		found := g.Within(tc.lat, tc.lon, tc.radius, tc.keep)
+		got := names(found)
+		if tc.name == "at the north pole" {
+			// Equally far from the pole, in no particular order.
+			slices.Sort(got)
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+		for i := 1; i < len(found); i++ {
+			if found[i].Distance < found[i-1].Distance {
+				t.Errorf("%s: not ordered by distance: %v", tc.name, found)
+			}
+		}
+		for _, n := range found {
+			if n.Distance > tc.radius {
+				t.Errorf("%s: %s is %f m away", tc.name, n.Value, n.Distance)
+			}
+		}
+	}
+}
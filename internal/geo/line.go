@@ -0,0 +1,89 @@
+package geo
+
+import "math"
+
+// Measures returns the distance in metres from the start of line to each of
+// its points.
+func Measures(line []Point) []float64 {
+	m := make([]float64, len(line))
+	for i := 1; i < len(line); i++ {
+		m[i] = m[i-1] + Distance(line[i-1].Lat, line[i-1].Lon, line[i].Lat, line[i].Lon)
+	}
+	return m
+}
+
+// Locate projects p onto line and returns the measure of the closest point,
+// interpolated from measures. Only the part of the line at or after the
+// measure after is considered, which keeps stops on loops in order.
+func Locate(line []Point, measures []float64, p Point, after float64) float64 {
+	best, bestDist := after, math.Inf(1)
+	if len(line) == 1 {
+		return measures[0]
+	}
+	for i := 1; i < len(line); i++ {
+		if measures[i] < after {
+			continue
+		}
+		t := project(line[i-1], line[i], p)
+		m := measures[i-1] + t*(measures[i]-measures[i-1])
+		if m < after {
+			t = (after - measures[i-1]) / (measures[i] - measures[i-1])
+			m = after
+		}
+		q := interpolate(line[i-1], line[i], t)
+		if d := Distance(p.Lat, p.Lon, q.Lat, q.Lon); d < bestDist {
+			best, bestDist = m, d
+		}
+	}
+	return best
+}
+
+// Slice returns the part of line between the measures from and to,
+// interpolating the end points.
+func Slice(line []Point, measures []float64, from, to float64) []Point {
+	if len(line) < 2 || from > to {
+		return nil
+	}
+	out := []Point{at(line, measures, from)}
+	for i, m := range measures {
+		if m > from && m < to {
+			out = append(out, line[i])
+		}
+	}
+	return append(out, at(line, measures, to))
+}
+
+// at returns the point of line at measure m, clamped to its ends.
+func at(line []Point, measures []float64, m float64) Point {
+	if m <= measures[0] {
+		return line[0]
+	}
+	for i := 1; i < len(line); i++ {
+		if m <= measures[i] {
+			span := measures[i] - measures[i-1]
+			if span == 0 {
+				return line[i]
+			}
+			return interpolate(line[i-1], line[i], (m-measures[i-1])/span)
+		}
+	}
+	return line[len(line)-1]
+}
+
+// project returns the position of the point of segment ab closest to p as a
+// fraction of the segment. Segments are short enough to treat as planar
+// once longitude is scaled by the cosine of the latitude.
+func project(a, b, p Point) float64 {
+	scale := math.Cos(a.Lat * math.Pi / 180)
+	dx, dy := (b.Lon-a.Lon)*scale, b.Lat-a.Lat
+	px, py := (p.Lon-a.Lon)*scale, p.Lat-a.Lat
+	length := dx*dx + dy*dy
+	if length == 0 {
+		return 0
+	}
+	return math.Max(0, math.Min(1, (px*dx+py*dy)/length))
+}
+
+func interpolate(a, b Point, t float64) Point {
+	return Point{Lat: a.Lat + t*(b.Lat-a.Lat), Lon: a.Lon + t*(b.Lon-a.Lon)}
+}
@@ -0,0 +1,202 @@
+package gtfs
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Feed is an opened GTFS zip archive.
+type Feed struct {
+	name  string
+	zr    *zip.ReadCloser
+	files map[string]*zip.File
+}
+
+// Open opens the GTFS zip at path. Files nested in a single top level
+// directory are found as well, since some agencies publish them that way.
+func Open(name string) (*Feed, error) {
+	zr, err := zip.OpenReader(name)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		files[path.Base(f.Name)] = f
+	}
+
+	return &Feed{name: name, zr: zr, files: files}, nil
+}
+
+func (f *Feed) Close() error {
+	return f.zr.Close()
+}
+
+// Name returns the path the feed was opened from.
+func (f *Feed) Name() string {
+	return f.name
+}
+
+// Hash returns the hex encoded SHA-256 of the zip archive.
+func (f *Feed) Hash() (string, error) {
+	file, err := os.Open(f.name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Has reports whether the feed contains the given file, e.g. "shapes.txt".
+func (f *Feed) Has(file string) bool {
+	_, ok := f.files[file]
+	return ok
+}
+
+// Rows opens one file of the feed for streaming. The caller must Close it.
+func (f *Feed) Rows(file string) (*Rows, error) {
+	zf, ok := f.files[file]
+	if !ok {
+		return nil, fmt.Errorf("%s not found in feed", file)
+	}
+	rc, err := zf.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	r := csv.NewReader(rc)
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	r.ReuseRecord = true
+
+	header, err := r.Read()
+	if err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("reading %s header: %w", file, err)
+	}
+
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.TrimPrefix(name, "\ufeff")
+		index[strings.TrimSpace(name)] = i
+	}
+
+	return &Rows{file: file, rc: rc, r: r, rec: Record{index: index}}, nil
+}
+
+// Rows iterates over the records of one feed file.
+type Rows struct {
+	file string
+	rc   io.ReadCloser
+	r    *csv.Reader
+	rec  Record
+	line int
+	err  error
+}
+
+func (rs *Rows) Next() bool {
+	if rs.err != nil {
+		return false
+	}
+	fields, err := rs.r.Read()
+	if err != nil {
+		if err != io.EOF {
+			rs.err = fmt.Errorf("%s: %w", rs.file, err)
+		}
+		return false
+	}
+	rs.line++
+	rs.rec.fields = fields
+	return true
+}
+
+// Record returns the current record. It is only valid until the next call to Next.
+func (rs *Rows) Record() Record {
+	return rs.rec
+}
+
+// Line returns the number of the current data row, starting at 1.
+func (rs *Rows) Line() int {
+	return rs.line
+}
+
+func (rs *Rows) Err() error {
+	return rs.err
+}
+
+func (rs *Rows) Close() error {
+	return rs.rc.Close()
+}
+
+// Record is a single CSV row addressed by column name.
+type Record struct {
+	index  map[string]int
+	fields []string
+}
+
+// String returns the trimmed value of the column, or "" when it is missing.
+func (r Record) String(column string) string {
+	i, ok := r.index[column]
+	if !ok || i >= len(r.fields) {
+		return ""
+	}
+	return strings.TrimSpace(r.fields[i])
+}
+
+// Int parses an optional integer column; empty values are 0.
+func (r Record) Int(column string) (int, error) {
+	v := r.String(column)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", column, err)
+	}
+	return n, nil
+}
+
+// Float parses an optional floating point column; empty values are 0.
+func (r Record) Float(column string) (float64, error) {
+	v := r.String(column)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", column, err)
+	}
+	return n, nil
+}
+
+// Bool parses a 0/1 column.
+func (r Record) Bool(column string) (bool, error) {
+	n, err := r.Int(column)
+	return n == 1, err
+}
+
+// Date parses a GTFS YYYYMMDD column.
+func (r Record) Date(column string) (time.Time, error) {
+	d, err := time.Parse("20060102", r.String(column))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s: %w", column, err)
+	}
+	return d, nil
+}
@@ -0,0 +1,120 @@
+package gtfs
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Hajdudev/ecoDatabase/models"
+)
+
+const (
+	// ExceptionAdded and ExceptionRemoved are the calendar_dates.txt exception types.
+	ExceptionAdded   = 1
+	ExceptionRemoved = 2
+)
+
+// ParseDate accepts both the ISO form used by the API (2006-01-02) and the
+// compact GTFS form (20060102).
+func ParseDate(s string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02", "20060102"} {
+		if d, err := time.Parse(layout, s); err == nil {
+			return d, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", s)
+}
+
+// RunsOn reports whether the weekly pattern of c covers date, ignoring any
+// calendar_dates exceptions.
+func RunsOn(c models.Calendar, date time.Time) bool {
+	day := truncateDay(date)
+	if day.Before(truncateDay(c.StartDate)) || day.After(truncateDay(c.EndDate)) {
+		return false
+	}
+
+	switch day.Weekday() {
+	case time.Monday:
+		return c.Monday
+	case time.Tuesday:
+		return c.Tuesday
+	case time.Wednesday:
+		return c.Wednesday
+	case time.Thursday:
+		return c.Thursday
+	case time.Friday:
+		return c.Friday
+	case time.Saturday:
+		return c.Saturday
+	default:
+		return c.Sunday
+	}
+}
+
+// ActiveServices resolves the service_ids running on date. Calendars give
+// the weekly pattern and the exceptions for that date add or remove
+// services on top of it. Exceptions for other dates are ignored, so the
+// caller may pass either the full calendar_dates table or just one day.
+func ActiveServices(date time.Time, calendars []models.Calendar, exceptions []models.CalendarDate) []string {
+	active := make(map[string]bool)
+	for _, c := range calendars {
+		if RunsOn(c, date) {
+			active[c.ServiceID] = true
+		}
+	}
+
+	day := truncateDay(date)
+	for _, e := range exceptions {
+		if !truncateDay(e.Date).Equal(day) {
+			continue
+		}
+		switch e.ExceptionType {
+		case ExceptionAdded:
+			active[e.ServiceID] = true
+		case ExceptionRemoved:
+			delete(active, e.ServiceID)
+		}
+	}
+
+	ids := make([]string, 0, len(active))
+	for id := range active {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// ServiceDates lists every date a service runs on, in order, from its
+// calendars and calendar_dates exceptions. All rows must belong to the
+// same service.
+func ServiceDates(calendars []models.Calendar, exceptions []models.CalendarDate) []time.Time {
+	active := make(map[time.Time]bool)
+	for _, c := range calendars {
+		end := truncateDay(c.EndDate)
+		for day := truncateDay(c.StartDate); !day.After(end); day = day.AddDate(0, 0, 1) {
+			if RunsOn(c, day) {
+				active[day] = true
+			}
+		}
+	}
+	for _, e := range exceptions {
+		switch e.ExceptionType {
+		case ExceptionAdded:
+			active[truncateDay(e.Date)] = true
+		case ExceptionRemoved:
+			delete(active, truncateDay(e.Date))
+		}
+	}
+
+	dates := make([]time.Time, 0, len(active))
+	for d := range active {
+		dates = append(dates, d)
+	}
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+	return dates
+}
+
+func truncateDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
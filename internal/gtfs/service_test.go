@@ -0,0 +1,106 @@
+package gtfs
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Hajdudev/ecoDatabase/models"
+)
+
+func date(s string) time.Time {
+	d, err := ParseDate(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+var (
+	weekdays = models.Calendar{
+		ServiceID: "WK",
+		Monday:    true, Tuesday: true, Wednesday: true, Thursday: true, Friday: true,
+		StartDate: date("2025-01-01"),
+		EndDate:   date("2025-12-31"),
+	}
+	weekends = models.Calendar{
+		ServiceID: "WE",
+		Saturday:  true, Sunday: true,
+		StartDate: date("2025-01-01"),
+		EndDate:   date("2025-12-31"),
+	}
+	exceptions = []models.CalendarDate{
+		// Monday 3 March is a holiday that runs the weekend service.
+		{ServiceID: "WK", Date: date("2025-03-03"), ExceptionType: ExceptionRemoved},
+		{ServiceID: "WE", Date: date("2025-03-03"), ExceptionType: ExceptionAdded},
+		// A service that only runs on the days it is added.
+		{ServiceID: "EXTRA", Date: date("2025-03-04"), ExceptionType: ExceptionAdded},
+	}
+)
+
+func TestParseDate(t *testing.T) {
+	for _, s := range []string{"2025-03-04", "20250304"} {
+		d, err := ParseDate(s)
+		if err != nil {
+			t.Fatalf("ParseDate(%q): %v", s, err)
+		}
+		if !d.Equal(time.Date(2025, 3, 4, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("ParseDate(%q) = %v", s, d)
+		}
+	}
+	for _, s := range []string{"", "2025-13-01", "4.3.2025", "2025030"} {
+		if _, err := ParseDate(s); err == nil {
+			t.Errorf("ParseDate(%q) succeeded", s)
+		}
+	}
+}
+
+func TestActiveServices(t *testing.T) {
+	calendars := []models.Calendar{weekdays, weekends}
+	tests := []struct {
+		date string
+		want []string
+	}{
+		{"2025-03-05", []string{"WK"}},          // Wednesday
+		{"2025-03-08", []string{"WE"}},          // Saturday
+		{"2025-03-03", []string{"WE"}},          // holiday Monday
+		{"2025-03-04", []string{"EXTRA", "WK"}}, // added service, sorted
+		{"2024-12-31", []string{}},              // before the calendars start
+		{"2026-01-01", []string{}},              // after they end
+		{"2025-12-31", []string{"WK"}},          // last day is included
+	}
+	for _, tc := range tests {
+		got := ActiveServices(date(tc.date), calendars, exceptions)
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.date, got, tc.want)
+		}
+	}
+}
+
+func TestActiveServicesIgnoresTimeOfDay(t *testing.T) {
+	// A date carrying a time and zone, as from the database, still
+	// resolves by its calendar date.
+	loc := time.FixedZone("CET", 3600)
+	d := time.Date(2025, 3, 3, 23, 30, 0, 0, loc)
+	if got := ActiveServices(d, []models.Calendar{weekdays, weekends}, exceptions); !slices.Equal(got, []string{"WE"}) {
+		t.Errorf("got %v, want [WE]", got)
+	}
+}
+
+func TestServiceDates(t *testing.T) {
+	c := weekdays
+	c.StartDate, c.EndDate = date("2025-03-01"), date("2025-03-09")
+	got := ServiceDates([]models.Calendar{c}, []models.CalendarDate{
+		{ServiceID: "WK", Date: date("2025-03-03"), ExceptionType: ExceptionRemoved},
+		{ServiceID: "WK", Date: date("2025-03-09"), ExceptionType: ExceptionAdded},
+	})
+
+	var days []string
+	for _, d := range got {
+		days = append(days, d.Format("2006-01-02"))
+	}
+	want := []string{"2025-03-04", "2025-03-05", "2025-03-06", "2025-03-07", "2025-03-09"}
+	if !slices.Equal(days, want) {
+		t.Errorf("got %v, want %v", days, want)
+	}
+}
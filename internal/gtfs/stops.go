@@ -0,0 +1,67 @@
+package gtfs
+
+import "github.com/Hajdudev/ecoDatabase/models"
+
+// GTFS location_type values.
+const (
+	LocationStop     = 0
+	LocationStation  = 1
+	LocationEntrance = 2
+	LocationGeneric  = 3
+	LocationBoarding = 4
+)
+
+// ResolveStops picks the stops a user means by key out of candidates,
+// which must hold every stop whose id, code, name or parent_station equals
+// key together with the children of those stops. An exact stop_id wins
+// over a stop_code, which wins over a name. Stations are expanded into
+// their platforms, so the result only holds stops a vehicle serves.
+func ResolveStops(key string, candidates []models.Stop) []models.Stop {
+	children := make(map[string][]models.Stop)
+	for _, s := range candidates {
+		if s.ParentStation != "" {
+			children[s.ParentStation] = append(children[s.ParentStation], s)
+		}
+	}
+
+	matchers := []func(models.Stop) bool{
+		func(s models.Stop) bool { return s.StopID == key },
+		func(s models.Stop) bool { return s.StopCode == key },
+		func(s models.Stop) bool { return s.StopName == key },
+	}
+	for _, match := range matchers {
+		var out []models.Stop
+		seen := make(map[string]bool)
+		add := func(s models.Stop) {
+			if !seen[s.StopID] && s.LocationType == LocationStop {
+				seen[s.StopID] = true
+				out = append(out, s)
+			}
+		}
+
+		for _, s := range candidates {
+			if !match(s) {
+				continue
+			}
+			if s.LocationType == LocationStation {
+				for _, c := range children[s.StopID] {
+					add(c)
+				}
+				continue
+			}
+			add(s)
+		}
+		if len(out) > 0 {
+			return out
+		}
+	}
+
+	// Some feeds reference parent stations without listing them.
+	var out []models.Stop
+	for _, s := range children[key] {
+		if s.LocationType == LocationStop {
+			out = append(out, s)
+		}
+	}
+	return out
+}
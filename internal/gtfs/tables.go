@@ -0,0 +1,412 @@
+package gtfs
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/Hajdudev/ecoDatabase/models"
+)
+
+// Table describes how one GTFS file maps onto a database table. Columns
+// are listed in the same order as the values returned by Values.
+type Table struct {
+	Name     string
+	File     string
+	Required bool
+	Columns  []string
+	Values   func(Record) ([]any, error)
+	// Check, when set, returns a RowCheck that loaders run over the rows
+	// of File as they read them.
+	Check func() RowCheck
+}
+
+// RowCheck validates what spans several rows of a file, so that the file
+// is still read only once: Add sees each row after it parsed, and Err
+// reports a problem once every row has been seen.
+type RowCheck interface {
+	Add(line int, r Record)
+	Err() error
+}
+
+// Tables lists every file the importer loads, in load order.
+var Tables = []Table{
+	{
+		Name:     "stops",
+		File:     "stops.txt",
+		Required: true,
+		Columns: []string{
+			"stop_id", "stop_code", "stop_name", "stop_desc", "stop_lat", "stop_lon", "zone_id", "stop_url",
+			"location_type", "parent_station", "stop_timezone", "wheelchair_boarding", "level_id", "platform_code",
+		},
+		Values: func(r Record) ([]any, error) {
+			s, err := ParseStop(r)
+			if err != nil {
+				return nil, err
+			}
+			return []any{
+				s.StopID, s.StopCode, s.StopName, s.StopDesc, s.StopLat, s.StopLon, s.ZoneID, s.StopURL,
+				s.LocationType, s.ParentStation, s.StopTimezone, s.WheelchairBoarding, s.LevelID, s.PlatformCode,
+			}, nil
+		},
+	},
+	{
+		Name:     "routes",
+		File:     "routes.txt",
+		Required: true,
+		Columns: []string{
+			"route_id", "agency_id", "route_short_name", "route_long_name", "route_description", "route_type",
+			"route_url", "route_color", "route_text_color", "route_sort_order",
+		},
+		Values: func(r Record) ([]any, error) {
+			rt, err := ParseRoute(r)
+			if err != nil {
+				return nil, err
+			}
+			return []any{
+				rt.RouteID, rt.AgencyID, rt.RouteShortName, rt.RouteLongName, rt.RouteDescription, rt.RouteType,
+				rt.RouteURL, rt.RouteColor, rt.RouteTextColor, rt.RouteSortOrder,
+			}, nil
+		},
+	},
+	{
+		Name:     "trips",
+		File:     "trips.txt",
+		Required: true,
+		Columns: []string{
+			"route_id", "service_id", "trip_id", "trip_headsign", "trip_short_name", "direction_id", "block_id",
+			"shape_id", "wheelchair_accessible", "bikes_allowed",
+		},
+		Values: func(r Record) ([]any, error) {
+			t, err := ParseTrip(r)
+			if err != nil {
+				return nil, err
+			}
+			return []any{
+				t.RouteID, t.ServiceID, t.TripID, t.TripHeadsign, t.TripShortName, t.DirectionID, t.BlockID,
+				t.ShapeID, t.WheelchairAccessible, t.BikesAllowed,
+			}, nil
+		},
+	},
+	{
+		Name:     "stop_times",
+		File:     "stop_times.txt",
+		Required: true,
+		Columns: []string{
+			"trip_id", "arrival_time", "departure_time", "stop_id", "stop_sequence", "stop_headsign",
+			"pickup_type", "drop_off_type", "shape_dist_traveled", "timepoint",
+		},
+		Values: func(r Record) ([]any, error) {
+			st, err := ParseStopTime(r)
+			if err != nil {
+				return nil, err
+			}
+			return []any{
+				st.TripID, st.ArrivalTime, st.DepartureTime, st.StopID, st.StopSequence, st.StopHeadsign,
+				st.PickupType, st.DropOffType, st.ShapeDistTraveled, st.Timepoint,
+			}, nil
+		},
+		Check: func() RowCheck { return newTripTimesCheck() },
+	},
+	{
+		Name: "calendar",
+		File: "calendar.txt",
+		Columns: []string{
+			"service_id", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday",
+			"start_date", "end_date",
+		},
+		Values: func(r Record) ([]any, error) {
+			c, err := ParseCalendar(r)
+			if err != nil {
+				return nil, err
+			}
+			return []any{
+				c.ServiceID, c.Monday, c.Tuesday, c.Wednesday, c.Thursday, c.Friday, c.Saturday, c.Sunday,
+				c.StartDate, c.EndDate,
+			}, nil
+		},
+	},
+	{
+		Name:    "calendar_dates",
+		File:    "calendar_dates.txt",
+		Columns: []string{"service_id", "date", "exception_type"},
+		Values: func(r Record) ([]any, error) {
+			cd, err := ParseCalendarDate(r)
+			if err != nil {
+				return nil, err
+			}
+			return []any{cd.ServiceID, cd.Date, cd.ExceptionType}, nil
+		},
+	},
+	{
+		Name:    "shapes",
+		File:    "shapes.txt",
+		Columns: []string{"shape_id", "shape_pt_lat", "shape_pt_lon", "shape_pt_sequence", "shape_dist_traveled"},
+		Values: func(r Record) ([]any, error) {
+			sh, err := ParseShape(r)
+			if err != nil {
+				return nil, err
+			}
+			return []any{sh.ShapeID, sh.ShapePtLat, sh.ShapePtLon, sh.ShapePtSequence, sh.ShapeDistTraveled}, nil
+		},
+	},
+}
+
+func ParseStop(r Record) (models.Stop, error) {
+	s := models.Stop{
+		StopID:        r.String("stop_id"),
+		StopCode:      r.String("stop_code"),
+		StopName:      r.String("stop_name"),
+		ZoneID:        r.String("zone_id"),
+		StopURL:       r.String("stop_url"),
+		ParentStation: r.String("parent_station"),
+		StopTimezone:  r.String("stop_timezone"),
+		LevelID:       r.String("level_id"),
+		PlatformCode:  r.String("platform_code"),
+	}
+	if desc := r.String("stop_desc"); desc != "" {
+		s.StopDesc = sql.NullString{String: desc, Valid: true}
+	}
+
+	var err error
+	if s.StopLat, err = r.Float("stop_lat"); err != nil {
+		return s, err
+	}
+	if s.StopLon, err = r.Float("stop_lon"); err != nil {
+		return s, err
+	}
+	if s.LocationType, err = r.Int("location_type"); err != nil {
+		return s, err
+	}
+	if s.WheelchairBoarding, err = r.Int("wheelchair_boarding"); err != nil {
+		return s, err
+	}
+	return s, nil
+}
+
+func ParseRoute(r Record) (models.Route, error) {
+	rt := models.Route{
+		RouteID:          r.String("route_id"),
+		AgencyID:         r.String("agency_id"),
+		RouteShortName:   r.String("route_short_name"),
+		RouteLongName:    r.String("route_long_name"),
+		RouteDescription: r.String("route_desc"),
+		RouteURL:         r.String("route_url"),
+		RouteColor:       r.String("route_color"),
+		RouteTextColor:   r.String("route_text_color"),
+	}
+
+	var err error
+	if rt.RouteType, err = r.Int("route_type"); err != nil {
+		return rt, err
+	}
+	sortOrder, err := r.Int("route_sort_order")
+	if err != nil {
+		return rt, err
+	}
+	rt.RouteSortOrder = int64(sortOrder)
+	return rt, nil
+}
+
+func ParseTrip(r Record) (models.Trip, error) {
+	t := models.Trip{
+		RouteID:       r.String("route_id"),
+		ServiceID:     r.String("service_id"),
+		TripID:        r.String("trip_id"),
+		TripHeadsign:  r.String("trip_headsign"),
+		TripShortName: r.String("trip_short_name"),
+		BlockID:       r.String("block_id"),
+		ShapeID:       r.String("shape_id"),
+	}
+
+	var err error
+	if t.DirectionID, err = r.Int("direction_id"); err != nil {
+		return t, err
+	}
+	if t.WheelchairAccessible, err = r.Int("wheelchair_accessible"); err != nil {
+		return t, err
+	}
+	if t.BikesAllowed, err = r.Int("bikes_allowed"); err != nil {
+		return t, err
+	}
+	return t, nil
+}
+
+func ParseStopTime(r Record) (models.StopTime, error) {
+	st := models.StopTime{
+		TripID:        r.String("trip_id"),
+		ArrivalTime:   r.String("arrival_time"),
+		DepartureTime: r.String("departure_time"),
+		StopID:        r.String("stop_id"),
+		StopHeadsign:  r.String("stop_headsign"),
+	}
+	// Where only one of the two times is given, it is used for both. Stops
+	// between timepoints may leave both empty; those stay empty here and
+	// are interpolated by the planner. The check of the stop_times table
+	// makes sure every trip starts and ends with a time to interpolate
+	// from.
+	if st.ArrivalTime == "" {
+		st.ArrivalTime = st.DepartureTime
+	}
+	if st.DepartureTime == "" {
+		st.DepartureTime = st.ArrivalTime
+	}
+
+	// Pad times to HH:MM:SS so that they sort correctly as text, including
+	// those past 24:00:00.
+	var err error
+	if st.ArrivalTime, err = padTime(st.ArrivalTime); err != nil {
+		return st, fmt.Errorf("arrival_time: %w", err)
+	}
+	if st.DepartureTime, err = padTime(st.DepartureTime); err != nil {
+		return st, fmt.Errorf("departure_time: %w", err)
+	}
+
+	if st.StopSequence, err = r.Int("stop_sequence"); err != nil {
+		return st, err
+	}
+	if st.PickupType, err = r.Int("pickup_type"); err != nil {
+		return st, err
+	}
+	if st.DropOffType, err = r.Int("drop_off_type"); err != nil {
+		return st, err
+	}
+	if st.ShapeDistTraveled, err = r.Float("shape_dist_traveled"); err != nil {
+		return st, err
+	}
+	if st.Timepoint, err = r.Int("timepoint"); err != nil {
+		return st, err
+	}
+	return st, nil
+}
+
+// tripTimesCheck reports a trip whose first or last stop has neither an
+// arrival nor a departure time. GTFS only allows empty times between two
+// timed stops, which they are interpolated from.
+type tripTimesCheck struct {
+	first, last map[string]tripEnd
+}
+
+type tripEnd struct {
+	sequence, line int
+	timed          bool
+}
+
+func newTripTimesCheck() *tripTimesCheck {
+	return &tripTimesCheck{first: make(map[string]tripEnd), last: make(map[string]tripEnd)}
+}
+
+func (c *tripTimesCheck) Add(line int, r Record) {
+	sequence, err := r.Int("stop_sequence")
+	if err != nil {
+		// ParseStopTime reports it.
+		return
+	}
+	tripID := r.String("trip_id")
+	e := tripEnd{
+		sequence: sequence,
+		line:     line,
+		timed:    r.String("arrival_time") != "" || r.String("departure_time") != "",
+	}
+	if f, ok := c.first[tripID]; !ok || sequence < f.sequence {
+		c.first[tripID] = e
+	}
+	if l, ok := c.last[tripID]; !ok || sequence > l.sequence {
+		c.last[tripID] = e
+	}
+}
+
+// Err reports the offending row nearest the top of the file, so that the
+// error does not depend on map order.
+func (c *tripTimesCheck) Err() error {
+	var bad error
+	badLine := 0
+	for tripID, f := range c.first {
+		l := c.last[tripID]
+		for _, e := range []struct {
+			tripEnd
+			which string
+		}{{f, "first"}, {l, "last"}} {
+			if !e.timed && (bad == nil || e.line < badLine) {
+				bad = fmt.Errorf("line %d: trip %s has no time at its %s stop", e.line, tripID, e.which)
+				badLine = e.line
+			}
+		}
+	}
+	return bad
+}
+
+func padTime(s string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+	seconds, err := ParseTime(s)
+	if err != nil {
+		return "", err
+	}
+	return FormatTime(seconds), nil
+}
+
+func ParseCalendar(r Record) (models.Calendar, error) {
+	c := models.Calendar{ServiceID: r.String("service_id")}
+
+	days := []struct {
+		column string
+		dst    *bool
+	}{
+		{"monday", &c.Monday},
+		{"tuesday", &c.Tuesday},
+		{"wednesday", &c.Wednesday},
+		{"thursday", &c.Thursday},
+		{"friday", &c.Friday},
+		{"saturday", &c.Saturday},
+		{"sunday", &c.Sunday},
+	}
+	for _, d := range days {
+		v, err := r.Bool(d.column)
+		if err != nil {
+			return c, err
+		}
+		*d.dst = v
+	}
+
+	var err error
+	if c.StartDate, err = r.Date("start_date"); err != nil {
+		return c, err
+	}
+	if c.EndDate, err = r.Date("end_date"); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+func ParseCalendarDate(r Record) (models.CalendarDate, error) {
+	cd := models.CalendarDate{ServiceID: r.String("service_id")}
+
+	var err error
+	if cd.Date, err = r.Date("date"); err != nil {
+		return cd, err
+	}
+	if cd.ExceptionType, err = r.Int("exception_type"); err != nil {
+		return cd, err
+	}
+	return cd, nil
+}
+
+func ParseShape(r Record) (models.Shape, error) {
+	sh := models.Shape{ShapeID: r.String("shape_id")}
+
+	var err error
+	if sh.ShapePtLat, err = r.Float("shape_pt_lat"); err != nil {
+		return sh, err
+	}
+	if sh.ShapePtLon, err = r.Float("shape_pt_lon"); err != nil {
+		return sh, err
+	}
+	if sh.ShapePtSequence, err = r.Int("shape_pt_sequence"); err != nil {
+		return sh, err
+	}
+	if sh.ShapeDistTraveled, err = r.Float("shape_dist_traveled"); err != nil {
+		return sh, err
+	}
+	return sh, nil
+}
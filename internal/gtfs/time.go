@@ -0,0 +1,58 @@
+package gtfs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SecondsPerDay is the length of a GTFS service day in seconds.
+const SecondsPerDay = 24 * 60 * 60
+
+// ParseTime converts a GTFS HH:MM:SS time to seconds since the start of the
+// service day. Hours may be 24 or more for trips running past midnight, so
+// "25:10:00" is 90600. The seconds may be left out, as in "17:30".
+func ParseTime(s string) (int, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 2 && len(parts) != 3 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+
+	var fields [3]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid time %q", s)
+		}
+		fields[i] = n
+	}
+	hour, min, sec := fields[0], fields[1], fields[2]
+	if min > 59 || sec > 59 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return hour*3600 + min*60 + sec, nil
+}
+
+// FormatTime formats seconds since the start of the service day as a GTFS
+// time, keeping hours past 24.
+func FormatTime(seconds int) string {
+	return fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+}
+
+// ServiceDayStart returns the instant GTFS times on date count from, which
+// the spec defines as noon minus 12 hours so that days with a daylight
+// saving change still line up with the clock.
+func ServiceDayStart(date time.Time, loc *time.Location) time.Time {
+	y, m, d := date.Date()
+	return time.Date(y, m, d, 12, 0, 0, 0, loc).Add(-12 * time.Hour)
+}
+
+// DayOffset returns how many calendar days after the service day a time
+// given in seconds falls on; negative times belong to the previous day.
+func DayOffset(seconds int) int {
+	if seconds < 0 {
+		return (seconds+1)/SecondsPerDay - 1
+	}
+	return seconds / SecondsPerDay
+}
@@ -0,0 +1,18 @@
+package gtfs
+
+import "context"
+
+type feedVersionKey struct{}
+
+// WithFeedVersion returns a copy of ctx under which stores read feed
+// version v instead of the active one.
+func WithFeedVersion(ctx context.Context, v int) context.Context {
+	return context.WithValue(ctx, feedVersionKey{}, v)
+}
+
+// FeedVersion returns the feed version set by WithFeedVersion. ok is false
+// when ctx reads the active version.
+func FeedVersion(ctx context.Context) (v int, ok bool) {
+	v, ok = ctx.Value(feedVersionKey{}).(int)
+	return v, ok
+}
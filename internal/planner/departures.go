@@ -0,0 +1,136 @@
+package planner
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/Hajdudev/ecoDatabase/internal/gtfs"
+)
+
+// ErrStopNotFound is returned by Departures for unknown stop ids.
+var ErrStopNotFound = errors.New("stop not found")
+
+// Departure is a scheduled departure of a trip from a stop.
+type Departure struct {
+	TripID       string
+	RouteID      string
+	ServiceID    string
+	ServiceDate  string
+	Headsign     string
+	StopID       string
+	StopName     string
+	PlatformCode string
+	StopSequence int
+	PickupType   int
+	// DepartureTime is the GTFS time on the trip's service day, which may
+	// be past 24:00:00.
+	DepartureTime      string
+	DepartureTimestamp time.Time
+}
+
+// Departures lists the departures from stopID, or from the platforms of
+// the station stopID, between from and until seconds after the start of
+// date. Windows running past the end of the day continue into the next
+// service day. The last stop of a trip is not a departure.
+func (p *Planner) Departures(ctx context.Context, date, stopID string, from, until int) ([]Departure, error) {
+	tt, err := p.Timetable(ctx, date)
+	if err != nil {
+		return nil, err
+	}
+	stops := tt.stopsAt(stopID)
+	if len(stops) == 0 {
+		return nil, ErrStopNotFound
+	}
+
+	// Overnight trips of date show up in the next day's timetable too,
+	// with a negative offset; they are taken from date's timetable only.
+	deps := tt.departures(stops, from, until, -1)
+	if until >= gtfs.SecondsPerDay {
+		next := tt.Date.AddDate(0, 0, 1).Format("2006-01-02")
+		nextTT, err := p.Timetable(ctx, next)
+		if err != nil {
+			return nil, err
+		}
+		shift := int(nextTT.Start.Sub(tt.Start) / time.Second)
+		deps = append(deps, nextTT.departures(nextTT.stopsAt(stopID), from-shift, until-shift, 0)...)
+	}
+
+	sort.SliceStable(deps, func(i, j int) bool {
+		return deps[i].DepartureTimestamp.Before(deps[j].DepartureTimestamp)
+	})
+	return deps, nil
+}
+
+// StopIDs returns the ids of stopID and of the platforms of the station
+// stopID in the timetable of date, the stops Departures reads from.
+func (p *Planner) StopIDs(ctx context.Context, date, stopID string) ([]string, error) {
+	tt, err := p.Timetable(ctx, date)
+	if err != nil {
+		return nil, err
+	}
+	stops := tt.stopsAt(stopID)
+	if len(stops) == 0 {
+		return nil, ErrStopNotFound
+	}
+	ids := make([]string, len(stops))
+	for i, s := range stops {
+		ids[i] = tt.Stops[s].StopID
+	}
+	return ids, nil
+}
+
+// stopsAt returns the indexes of stopID and of the platforms of the
+// station stopID.
+func (tt *Timetable) stopsAt(stopID string) []int {
+	var out []int
+	for i, s := range tt.Stops {
+		if s.StopID == stopID || s.ParentStation == stopID {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+// departures lists the departures from stops between from and until. Only
+// trips with a day offset of at least minOffset are included.
+func (tt *Timetable) departures(stops []int, from, until, minOffset int) []Departure {
+	var out []Departure
+	for _, s := range stops {
+		stop := tt.Stops[s]
+		for _, ps := range tt.stopPatterns[s] {
+			pat := &tt.patterns[ps.pattern]
+			if ps.position == len(pat.stops)-1 {
+				continue
+			}
+			for _, ti := range pat.trips {
+				t := &tt.trips[ti]
+				dep := t.departures[ps.position]
+				if dep < from || dep > until || t.dayOffset < minOffset {
+					continue
+				}
+
+				headsign := t.headsign
+				if h := t.stopHeadsign[ps.position]; h != "" {
+					headsign = h
+				}
+				out = append(out, Departure{
+					TripID:             t.id,
+					RouteID:            t.routeID,
+					ServiceID:          t.serviceID,
+					ServiceDate:        tt.Date.AddDate(0, 0, t.dayOffset).Format("2006-01-02"),
+					Headsign:           headsign,
+					StopID:             stop.StopID,
+					StopName:           stop.StopName,
+					PlatformCode:       stop.PlatformCode,
+					StopSequence:       t.sequences[ps.position],
+					PickupType:         t.pickupTypes[ps.position],
+					DepartureTime:      gtfs.FormatTime(dep - t.dayOffset*gtfs.SecondsPerDay),
+					DepartureTimestamp: tt.timestamp(dep),
+				})
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,497 @@
+package planner
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Hajdudev/ecoDatabase/internal/geo"
+	"github.com/Hajdudev/ecoDatabase/internal/gtfs"
+	"github.com/Hajdudev/ecoDatabase/models"
+)
+
+// Source is the part of store.DatabaseStore the planner reads timetables from.
+type Source interface {
+	GetActiveServices(ctx context.Context, date string) ([]string, error)
+	GetAllStops(ctx context.Context) ([]models.Stop, error)
+	GetTripsByService(ctx context.Context, serviceIDs []string) ([]models.Trip, error)
+	GetStopTimesByService(ctx context.Context, serviceIDs []string) ([]models.StopTime, error)
+	GetStopTimesAfterMidnight(ctx context.Context, serviceIDs []string) ([]models.StopTime, error)
+}
+
+type Options struct {
+	// MaxTransfers caps the transfers a request may ask for.
+	MaxTransfers int
+	// MinTransferSeconds is the time needed to change vehicles at a stop
+	// or between platforms of the same station.
+	MinTransferSeconds int
+	// CacheSize is the number of service days kept in memory.
+	CacheSize int
+	// Location is the time zone of the feed, used to turn GTFS times
+	// into absolute timestamps.
+	Location *time.Location
+	// WalkSpeed is the walking speed in metres per second used to reach
+	// stops from coordinates, and MaxWalkMeters how far a walk may be.
+	WalkSpeed     float64
+	MaxWalkMeters float64
+	// Logger reports trips left out of a timetable. It may be nil.
+	Logger *log.Logger
+}
+
+var DefaultOptions = Options{
+	MaxTransfers:       3,
+	MinTransferSeconds: 120,
+	CacheSize:          4,
+	Location:           time.Local,
+	WalkSpeed:          1.3,
+	MaxWalkMeters:      800,
+}
+
+// Planner answers journey queries with RAPTOR over timetables loaded from
+// a Source. Timetables are built once per date and cached.
+type Planner struct {
+	source Source
+	opts   Options
+
+	mu    sync.Mutex
+	cache map[string]*cachedTimetable
+	order []string
+}
+
+type cachedTimetable struct {
+	done chan struct{} // closed once tt and err are set
+	tt   *Timetable
+	err  error
+}
+
+func New(source Source, opts Options) *Planner {
+	return &Planner{
+		source: source,
+		opts:   opts,
+		cache:  make(map[string]*cachedTimetable),
+	}
+}
+
+// Timetable returns the timetable of the trips running on date, in the
+// feed version of ctx. Requests for a date that is still loading wait for
+// it, each until its own ctx is done. The load itself is not cancelled
+// with the request that started it; if it fails, the error is not cached
+// and the next request loads the date again.
+func (p *Planner) Timetable(ctx context.Context, date string) (*Timetable, error) {
+	key := date
+	if v, ok := gtfs.FeedVersion(ctx); ok {
+		key = fmt.Sprintf("%s@%d", date, v)
+	}
+
+	p.mu.Lock()
+	entry, ok := p.cache[key]
+	if !ok {
+		entry = &cachedTimetable{done: make(chan struct{})}
+		p.cache[key] = entry
+		p.order = append(p.order, key)
+		if len(p.order) > p.opts.CacheSize {
+			delete(p.cache, p.order[0])
+			p.order = p.order[1:]
+		}
+	}
+	p.mu.Unlock()
+
+	if !ok {
+		go p.fill(context.WithoutCancel(ctx), key, date, entry)
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-entry.done:
+		return entry.tt, entry.err
+	}
+}
+
+// fill loads the timetable of entry and drops the entry again when the
+// load fails.
+func (p *Planner) fill(ctx context.Context, key, date string, entry *cachedTimetable) {
+	entry.tt, entry.err = p.load(ctx, date)
+	close(entry.done)
+	if entry.err == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cache[key] == entry {
+		delete(p.cache, key)
+		p.order = slices.DeleteFunc(p.order, func(k string) bool { return k == key })
+	}
+}
+
+// Reset drops the cached timetables, for when another feed version
+// becomes active.
+func (p *Planner) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cache = make(map[string]*cachedTimetable)
+	p.order = nil
+}
+
+// load builds the timetable of date from its own trips and the trips of
+// the previous service day that are still running after midnight.
+func (p *Planner) load(ctx context.Context, date string) (*Timetable, error) {
+	day, err := gtfs.ParseDate(date)
+	if err != nil {
+		return nil, err
+	}
+	previous := day.AddDate(0, 0, -1).Format("2006-01-02")
+
+	stops, err := p.source.GetAllStops(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loading stops: %w", err)
+	}
+
+	today, err := p.serviceDay(ctx, date, 0, p.source.GetStopTimesByService)
+	if err != nil {
+		return nil, err
+	}
+	overnight, err := p.serviceDay(ctx, previous, -1, p.source.GetStopTimesAfterMidnight)
+	if err != nil {
+		return nil, err
+	}
+
+	tt := NewTimetable(day, p.opts.Location, stops, []ServiceDay{today, overnight}, p.opts.MinTransferSeconds)
+	if p.opts.Logger != nil {
+		for _, err := range tt.Skipped {
+			p.opts.Logger.Printf("planner: %s: skipping %v", date, err)
+		}
+	}
+	return tt, nil
+}
+
+func (p *Planner) serviceDay(ctx context.Context, date string, offset int, stopTimes func(context.Context, []string) ([]models.StopTime, error)) (ServiceDay, error) {
+	day := ServiceDay{Offset: offset}
+
+	serviceIDs, err := p.source.GetActiveServices(ctx, date)
+	if err != nil {
+		return day, fmt.Errorf("resolving services for %s: %w", date, err)
+	}
+	if day.Trips, err = p.source.GetTripsByService(ctx, serviceIDs); err != nil {
+		return day, fmt.Errorf("loading trips for %s: %w", date, err)
+	}
+	if day.StopTimes, err = stopTimes(ctx, serviceIDs); err != nil {
+		return day, fmt.Errorf("loading stop times for %s: %w", date, err)
+	}
+	return day, nil
+}
+
+// Place is where a journey starts or ends: either a set of stops or a
+// coordinate, which is reached on foot from every stop within
+// Options.MaxWalkMeters.
+type Place struct {
+	StopIDs    []string
+	Coordinate *geo.Point
+}
+
+// IsEmpty reports whether the place matched neither stops nor a coordinate.
+func (p Place) IsEmpty() bool {
+	return p.Coordinate == nil && len(p.StopIDs) == 0
+}
+
+type Request struct {
+	Date         string
+	From         Place
+	To           Place
+	MaxTransfers int
+	// Time is in seconds since the start of the service day, or negative
+	// to search the whole day. With ArriveBy unset it is the earliest
+	// departure, otherwise the latest arrival.
+	Time     int
+	ArriveBy bool
+	// Limit caps the number of journeys returned; 0 returns all of them.
+	// Depart-after searches keep the first journeys, arrive-by searches
+	// the last ones.
+	Limit int
+}
+
+// Plan returns every journey from req.From to req.To on req.Date that is
+// not beaten by another journey leaving later, arriving
+// earlier and needing no more transfers. Journeys are sorted by departure.
+func (p *Planner) Plan(ctx context.Context, req Request) ([]models.Journey, error) {
+	tt, err := p.Timetable(ctx, req.Date)
+	if err != nil {
+		return nil, err
+	}
+
+	maxTransfers := req.MaxTransfers
+	if maxTransfers < 0 || maxTransfers > p.opts.MaxTransfers {
+		maxTransfers = p.opts.MaxTransfers
+	}
+
+	origins := p.endpoints(tt, req.From)
+	targets := p.endpoints(tt, req.To)
+	if len(origins) == 0 || len(targets) == 0 {
+		return nil, nil
+	}
+
+	earliest, latest := 0, unreachable
+	if req.Time >= 0 {
+		if req.ArriveBy {
+			latest = req.Time
+		} else {
+			earliest = req.Time
+		}
+	}
+
+	// Depart-after searches walk the departures forwards and arrive-by
+	// searches backwards, so that with a limit they can stop as soon as
+	// the journeys to return are settled.
+	departures := tt.departuresFrom(origins, earliest, latest)
+	if req.ArriveBy {
+		slices.Reverse(departures)
+	}
+
+	var paths paretoSet
+	seen := make(map[string]bool)
+	for i, dep := range departures {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		for _, pa := range tt.raptor(origins, targets, dep, maxTransfers+1) {
+			key := pa.key()
+			if pa.arrival > latest || seen[key] {
+				continue
+			}
+			seen[key] = true
+			paths.add(pa)
+		}
+
+		if req.Limit > 0 && len(paths) >= req.Limit && i+1 < len(departures) {
+			if paths.settled(req.Limit, req.ArriveBy, departures[i+1]) {
+				break
+			}
+		}
+	}
+
+	sort.Slice(paths, func(i, j int) bool {
+		if paths[i].departure != paths[j].departure {
+			return paths[i].departure < paths[j].departure
+		}
+		return paths[i].arrival < paths[j].arrival
+	})
+	if req.Limit > 0 && len(paths) > req.Limit {
+		if req.ArriveBy {
+			paths = paths[len(paths)-req.Limit:]
+		} else {
+			paths = paths[:req.Limit]
+		}
+	}
+
+	journeys := make([]models.Journey, 0, len(paths))
+	for _, pa := range paths {
+		journeys = append(journeys, tt.journey(pa, req))
+	}
+	return journeys, nil
+}
+
+// endpoints lists the stops a search can start or end at for place.
+func (p *Planner) endpoints(tt *Timetable, place Place) []endpoint {
+	var out []endpoint
+	if place.Coordinate == nil {
+		for _, id := range place.StopIDs {
+			if i, ok := tt.stopIndex[id]; ok {
+				out = append(out, endpoint{stop: i})
+			}
+		}
+		return out
+	}
+
+	c := place.Coordinate
+	for _, n := range tt.grid.Within(c.Lat, c.Lon, p.opts.MaxWalkMeters, nil) {
+		out = append(out, endpoint{
+			stop:    n.Value,
+			seconds: int(math.Ceil(n.Distance / p.opts.WalkSpeed)),
+			meters:  n.Distance,
+		})
+	}
+	return out
+}
+
+func (pa path) key() string {
+	var b strings.Builder
+	for _, l := range pa.legs {
+		fmt.Fprintf(&b, "%d:%d:%d;", l.trip, l.board, l.alight)
+	}
+	return b.String()
+}
+
+// paretoSet holds the paths found so far that no other path beats by
+// departing no earlier, arriving no later and having no more legs. Paths
+// are added one at a time, so each search only compares a new path with
+// the set rather than all paths with each other.
+type paretoSet []path
+
+// add puts pa into the set unless a path in it beats pa, and drops the
+// paths pa beats.
+func (s *paretoSet) add(pa path) {
+	for _, b := range *s {
+		if b.beats(pa) {
+			return
+		}
+	}
+	*s = append(slices.DeleteFunc(*s, pa.beats), pa)
+}
+
+// beats reports whether a departs no earlier, arrives no later and has no
+// more legs than b, and is better in at least one of them.
+func (a path) beats(b path) bool {
+	noWorse := a.departure >= b.departure && a.arrival <= b.arrival && len(a.legs) <= len(b.legs)
+	better := a.departure > b.departure || a.arrival < b.arrival || len(a.legs) < len(b.legs)
+	return noWorse && better
+}
+
+// settled reports whether the set already holds the limit journeys a
+// search returns, with next the departure it would try next. A later
+// departure can only find journeys leaving at next or later, which beat
+// no journey arriving before next and sort after all of them. An
+// arrive-by search tries earlier departures next; those find nothing that
+// leaves later than what was already found, so every journey found so far
+// is settled.
+func (s paretoSet) settled(limit int, arriveBy bool, next int) bool {
+	if arriveBy {
+		return len(s) >= limit
+	}
+	n := 0
+	for _, pa := range s {
+		if pa.arrival < next {
+			n++
+		}
+	}
+	return n >= limit
+}
+
+func (tt *Timetable) journey(pa path, req Request) models.Journey {
+	date := req.Date
+	j := models.Journey{
+		DepartureTime:      gtfs.FormatTime(pa.departure),
+		ArrivalTime:        gtfs.FormatTime(pa.arrival),
+		DepartureTimestamp: tt.timestamp(pa.departure),
+		ArrivalTimestamp:   tt.timestamp(pa.arrival),
+		DurationSeconds:    pa.arrival - pa.departure,
+		TransferCount:      len(pa.legs) - 1,
+		SearchDate:         date,
+	}
+
+	for i, l := range pa.legs {
+		t := &tt.trips[l.trip]
+		departure := t.departures[l.board]
+		arrival := t.arrivals[l.alight]
+		j.Legs = append(j.Legs, models.RouteResult{
+			TripId:             t.id,
+			TripName:           t.headsign,
+			RouteId:            t.routeID,
+			FromStopId:         tt.Stops[l.boardStop].StopID,
+			FromStopName:       tt.Stops[l.boardStop].StopName,
+			FromPlatformCode:   tt.Stops[l.boardStop].PlatformCode,
+			ToStopId:           tt.Stops[l.alightStop].StopID,
+			ToStopName:         tt.Stops[l.alightStop].StopName,
+			ToPlatformCode:     tt.Stops[l.alightStop].PlatformCode,
+			DepartureTime:      gtfs.FormatTime(departure),
+			ArrivalTime:        gtfs.FormatTime(arrival),
+			ServiceId:          t.serviceID,
+			ServiceDate:        tt.Date.AddDate(0, 0, t.dayOffset).Format("2006-01-02"),
+			DepartureDayOffset: gtfs.DayOffset(departure),
+			ArrivalDayOffset:   gtfs.DayOffset(arrival),
+			DepartureTimestamp: tt.timestamp(departure),
+			ArrivalTimestamp:   tt.timestamp(arrival),
+			SearchDate:         date,
+			Stops:              tt.segment(l),
+		})
+
+		if i == 0 {
+			continue
+		}
+		prev := pa.legs[i-1]
+		prevArrival := tt.trips[prev.trip].arrivals[prev.alight]
+		j.Transfers = append(j.Transfers, models.Transfer{
+			FromStopId:       tt.Stops[prev.alightStop].StopID,
+			FromStopName:     tt.Stops[prev.alightStop].StopName,
+			FromPlatformCode: tt.Stops[prev.alightStop].PlatformCode,
+			ToStopId:         tt.Stops[l.boardStop].StopID,
+			ToStopName:       tt.Stops[l.boardStop].StopName,
+			ToPlatformCode:   tt.Stops[l.boardStop].PlatformCode,
+			ArrivalTime:      gtfs.FormatTime(prevArrival),
+			DepartureTime:    gtfs.FormatTime(departure),
+			WaitSeconds:      departure - prevArrival,
+		})
+	}
+	if c := req.From.Coordinate; c != nil {
+		first := pa.legs[0]
+		board := tt.trips[first.trip].departures[first.board]
+		j.Access = tt.walk(pa.access, board-pa.access.seconds, *c, true)
+	}
+	if c := req.To.Coordinate; c != nil {
+		last := pa.legs[len(pa.legs)-1]
+		alight := tt.trips[last.trip].arrivals[last.alight]
+		j.Egress = tt.walk(pa.egress, alight, *c, false)
+	}
+	return j
+}
+
+// walk describes the walk between a coordinate and the stop of e, leaving
+// at start. toStop tells whether the walk ends at the stop or starts there.
+func (tt *Timetable) walk(e endpoint, start int, c geo.Point, toStop bool) *models.WalkLeg {
+	s := tt.Stops[e.stop]
+	w := &models.WalkLeg{
+		FromLat:         c.Lat,
+		FromLon:         c.Lon,
+		ToStopId:        s.StopID,
+		ToStopName:      s.StopName,
+		ToLat:           s.StopLat,
+		ToLon:           s.StopLon,
+		DistanceMeters:  math.Round(e.meters),
+		DurationSeconds: e.seconds,
+		DepartureTime:   gtfs.FormatTime(start),
+		ArrivalTime:     gtfs.FormatTime(start + e.seconds),
+	}
+	if !toStop {
+		w.FromStopId, w.FromStopName, w.FromLat, w.FromLon = s.StopID, s.StopName, s.StopLat, s.StopLon
+		w.ToStopId, w.ToStopName, w.ToLat, w.ToLon = "", "", c.Lat, c.Lon
+	}
+	return w
+}
+
+// segment lists the stops a leg passes through, from the boarding stop to
+// the alighting stop. Legs always run forward along the trip, so the
+// stop_sequence of each stop is higher than that of the one before.
+func (tt *Timetable) segment(l leg) []models.SegmentStop {
+	t := &tt.trips[l.trip]
+	p := &tt.patterns[tt.tripPattern[l.trip]]
+
+	stops := make([]models.SegmentStop, 0, l.alight-l.board+1)
+	for pos := l.board; pos <= l.alight; pos++ {
+		s := tt.Stops[p.stops[pos]]
+		stops = append(stops, models.SegmentStop{
+			StopId:             s.StopID,
+			StopName:           s.StopName,
+			ArrivalTime:        gtfs.FormatTime(t.arrivals[pos]),
+			DepartureTime:      gtfs.FormatTime(t.departures[pos]),
+			ArrivalTimestamp:   tt.timestamp(t.arrivals[pos]),
+			DepartureTimestamp: tt.timestamp(t.departures[pos]),
+			StopSequence:       t.sequences[pos],
+		})
+	}
+	return stops
+}
+
+// timestamp turns seconds since the start of the service day into an
+// absolute time.
+func (tt *Timetable) timestamp(seconds int) time.Time {
+	return tt.Start.Add(time.Duration(seconds) * time.Second)
+}
+
+// Location returns the time zone timetables are built in.
+func (p *Planner) Location() *time.Location {
+	return p.opts.Location
+}
@@ -0,0 +1,367 @@
+package planner
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Hajdudev/ecoDatabase/internal/geo"
+	"github.com/Hajdudev/ecoDatabase/internal/gtfs"
+	"github.com/Hajdudev/ecoDatabase/models"
+)
+
+const testDate = "2025-03-04"
+
+// fakeSource serves a fixed timetable running on testDate only. When
+// block is set, GetAllStops waits for it to be closed.
+type fakeSource struct {
+	stops     []models.Stop
+	trips     []models.Trip
+	stopTimes []models.StopTime
+
+	block chan struct{}
+	loads atomic.Int32
+}
+
+func (s *fakeSource) GetActiveServices(ctx context.Context, date string) ([]string, error) {
+	if date == testDate {
+		return []string{"S"}, nil
+	}
+	return nil, nil
+}
+
+func (s *fakeSource) GetAllStops(ctx context.Context) ([]models.Stop, error) {
+	s.loads.Add(1)
+	if s.block != nil {
+		select {
+		case <-s.block:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return s.stops, nil
+}
+
+func (s *fakeSource) GetTripsByService(ctx context.Context, serviceIDs []string) ([]models.Trip, error) {
+	if len(serviceIDs) == 0 {
+		return nil, nil
+	}
+	return s.trips, nil
+}
+
+func (s *fakeSource) GetStopTimesByService(ctx context.Context, serviceIDs []string) ([]models.StopTime, error) {
+	if len(serviceIDs) == 0 {
+		return nil, nil
+	}
+	return s.stopTimes, nil
+}
+
+func (s *fakeSource) GetStopTimesAfterMidnight(ctx context.Context, serviceIDs []string) ([]models.StopTime, error) {
+	if len(serviceIDs) == 0 {
+		return nil, nil
+	}
+	overnight := make(map[string]bool)
+	for _, st := range s.stopTimes {
+		if t, err := gtfs.ParseTime(st.ArrivalTime); err == nil && t >= gtfs.SecondsPerDay {
+			overnight[st.TripID] = true
+		}
+	}
+	var out []models.StopTime
+	for _, st := range s.stopTimes {
+		if overnight[st.TripID] {
+			out = append(out, st)
+		}
+	}
+	return out, nil
+}
+
+// newFakeSource builds the test network. The stops lie a few kilometres
+// apart, so no transfer can be walked:
+//
+//	SLOW   A 08:00 -> C 09:00, beaten by FAST
+//	FAST   A 08:20 -> C 08:50
+//	LEG1   A 07:00 -> B 07:10, then LEG2 B 07:20 -> C 07:30
+//	INTERP A 10:00 -> M (no time) -> B 10:20
+//	BROKEN A 11:00 -> B (no time), unusable
+//	NIGHT  A 23:50 -> C 24:20
+func newFakeSource() *fakeSource {
+	s := &fakeSource{
+		stops: []models.Stop{
+			{StopID: "A", StopName: "Alpha", StopLat: 48.0, StopLon: 17.0},
+			{StopID: "M", StopName: "Middle", StopLat: 48.05, StopLon: 17.0},
+			{StopID: "B", StopName: "Beta", StopLat: 48.1, StopLon: 17.0},
+			{StopID: "C", StopName: "Gamma", StopLat: 48.2, StopLon: 17.0},
+		},
+	}
+	add := func(tripID, routeID string, stopsAndTimes ...string) {
+		s.trips = append(s.trips, models.Trip{TripID: tripID, RouteID: routeID, ServiceID: "S"})
+		for i := 0; i < len(stopsAndTimes); i += 2 {
+			t := stopsAndTimes[i+1]
+			s.stopTimes = append(s.stopTimes, models.StopTime{
+				TripID:        tripID,
+				StopID:        stopsAndTimes[i],
+				StopSequence:  i/2 + 1,
+				ArrivalTime:   t,
+				DepartureTime: t,
+			})
+		}
+	}
+	add("SLOW", "R1", "A", "08:00:00", "C", "09:00:00")
+	add("FAST", "R1", "A", "08:20:00", "C", "08:50:00")
+	add("LEG1", "R2", "A", "07:00:00", "B", "07:10:00")
+	add("LEG2", "R3", "B", "07:20:00", "C", "07:30:00")
+	add("INTERP", "R2", "A", "10:00:00", "M", "", "B", "10:20:00")
+	add("BROKEN", "R2", "A", "11:00:00", "B", "")
+	add("NIGHT", "R1", "A", "23:50:00", "C", "24:20:00")
+	return s
+}
+
+func newTestPlanner(source Source) *Planner {
+	opts := DefaultOptions
+	opts.Location = time.UTC
+	return New(source, opts)
+}
+
+// summary describes each journey as its departure time and trips.
+func summary(journeys []models.Journey) []string {
+	var out []string
+	for _, j := range journeys {
+		var trips []string
+		for _, leg := range j.Legs {
+			trips = append(trips, leg.TripId)
+		}
+		out = append(out, j.DepartureTime+" "+strings.Join(trips, "+"))
+	}
+	return out
+}
+
+func TestPlan(t *testing.T) {
+	tests := []struct {
+		name string
+		req  Request
+		want []string
+	}{
+		{
+			name: "whole day",
+			req:  Request{From: Place{StopIDs: []string{"A"}}, To: Place{StopIDs: []string{"C"}}, MaxTransfers: -1, Time: -1},
+			want: []string{"07:00:00 LEG1+LEG2", "08:20:00 FAST", "23:50:00 NIGHT"},
+		},
+		{
+			name: "depart after with limit",
+			req:  Request{From: Place{StopIDs: []string{"A"}}, To: Place{StopIDs: []string{"C"}}, MaxTransfers: -1, Time: 7*3600 + 1, Limit: 1},
+			want: []string{"08:20:00 FAST"},
+		},
+		{
+			name: "without transfers",
+			req:  Request{From: Place{StopIDs: []string{"A"}}, To: Place{StopIDs: []string{"C"}}, MaxTransfers: 0, Time: 6 * 3600, Limit: 2},
+			want: []string{"08:20:00 FAST", "23:50:00 NIGHT"},
+		},
+		{
+			name: "arrive by",
+			req:  Request{From: Place{StopIDs: []string{"A"}}, To: Place{StopIDs: []string{"C"}}, MaxTransfers: -1, Time: 9 * 3600, ArriveBy: true, Limit: 1},
+			want: []string{"08:20:00 FAST"},
+		},
+		{
+			name: "arrive by keeps the last journeys",
+			req:  Request{From: Place{StopIDs: []string{"A"}}, To: Place{StopIDs: []string{"C"}}, MaxTransfers: -1, Time: 9 * 3600, ArriveBy: true, Limit: 5},
+			want: []string{"07:00:00 LEG1+LEG2", "08:20:00 FAST"},
+		},
+	}
+
+	p := newTestPlanner(newFakeSource())
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.req.Date = testDate
+			journeys, err := p.Plan(context.Background(), tc.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := summary(journeys); !slices.Equal(got, tc.want) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPlanTransfer(t *testing.T) {
+	p := newTestPlanner(newFakeSource())
+	journeys, err := p.Plan(context.Background(), Request{
+		Date:         testDate,
+		From:         Place{StopIDs: []string{"A"}},
+		To:           Place{StopIDs: []string{"C"}},
+		MaxTransfers: -1,
+		Time:         6 * 3600,
+		Limit:        1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(journeys) != 1 {
+		t.Fatalf("got %d journeys, want 1", len(journeys))
+	}
+	j := journeys[0]
+	if j.TransferCount != 1 || j.ArrivalTime != "07:30:00" || j.DurationSeconds != 30*60 {
+		t.Errorf("journey %+v", j)
+	}
+	if j.Legs[0].ToStopId != "B" || j.Legs[1].FromStopId != "B" {
+		t.Errorf("transfer at %s/%s, want B", j.Legs[0].ToStopId, j.Legs[1].FromStopId)
+	}
+}
+
+func TestPlanInterpolatesUntimedStops(t *testing.T) {
+	p := newTestPlanner(newFakeSource())
+	journeys, err := p.Plan(context.Background(), Request{
+		Date:         testDate,
+		From:         Place{StopIDs: []string{"A"}},
+		To:           Place{StopIDs: []string{"M"}},
+		MaxTransfers: -1,
+		Time:         9 * 3600,
+		Limit:        1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// M lies halfway between A and B.
+	if len(journeys) != 1 || journeys[0].ArrivalTime != "10:10:00" {
+		t.Fatalf("got %q, want INTERP arriving 10:10:00", summary(journeys))
+	}
+}
+
+func TestPlanWalkingAccessEgress(t *testing.T) {
+	p := newTestPlanner(newFakeSource())
+	// About 111 m north of A and 74 m east of C.
+	from := geo.Point{Lat: 48.001, Lon: 17.0}
+	to := geo.Point{Lat: 48.2, Lon: 17.001}
+	journeys, err := p.Plan(context.Background(), Request{
+		Date:         testDate,
+		From:         Place{Coordinate: &from},
+		To:           Place{Coordinate: &to},
+		MaxTransfers: -1,
+		Time:         6 * 3600,
+		Limit:        1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The journey starts with the 86 s walk to A.
+	if got := summary(journeys); !slices.Equal(got, []string{"06:58:34 LEG1+LEG2"}) {
+		t.Fatalf("got %q, want LEG1+LEG2 with the walk to A", got)
+	}
+	j := journeys[0]
+
+	access := j.Access
+	if access == nil || access.ToStopId != "A" || access.FromStopId != "" || access.DistanceMeters != 111 {
+		t.Fatalf("access %+v, want 111 m to A", access)
+	}
+	if access.FromLat != from.Lat || access.ArrivalTime != "07:00:00" ||
+		access.DepartureTime != gtfs.FormatTime(7*3600-access.DurationSeconds) {
+		t.Errorf("access %+v, want a walk from the origin arriving for the 07:00 departure", access)
+	}
+
+	egress := j.Egress
+	if egress == nil || egress.FromStopId != "C" || egress.ToStopId != "" || egress.DistanceMeters != 74 {
+		t.Fatalf("egress %+v, want 74 m from C", egress)
+	}
+	if egress.ToLon != to.Lon || egress.DepartureTime != "07:30:00" ||
+		egress.ArrivalTime != gtfs.FormatTime(7*3600+30*60+egress.DurationSeconds) {
+		t.Errorf("egress %+v, want a walk to the destination leaving at 07:30", egress)
+	}
+	if want := int(math.Ceil(geo.Distance(from.Lat, from.Lon, 48.0, 17.0) / DefaultOptions.WalkSpeed)); access.DurationSeconds != want {
+		t.Errorf("access takes %d s, want %d s", access.DurationSeconds, want)
+	}
+
+	// Nothing is within walking distance of a point far from every stop.
+	far := geo.Point{Lat: 47.5, Lon: 17.0}
+	journeys, err = p.Plan(context.Background(), Request{
+		Date:         testDate,
+		From:         Place{Coordinate: &far},
+		To:           Place{StopIDs: []string{"C"}},
+		MaxTransfers: -1,
+		Time:         -1,
+	})
+	if err != nil || len(journeys) != 0 {
+		t.Errorf("got %q, %v, want no journeys", summary(journeys), err)
+	}
+}
+
+func TestTimetableSkipsUnusableTrips(t *testing.T) {
+	p := newTestPlanner(newFakeSource())
+	tt, err := p.Timetable(context.Background(), testDate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tt.Skipped) != 1 || !strings.Contains(tt.Skipped[0].Error(), "BROKEN") {
+		t.Errorf("Skipped = %v, want BROKEN only", tt.Skipped)
+	}
+}
+
+func TestPlanCancelled(t *testing.T) {
+	p := newTestPlanner(newFakeSource())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := p.Plan(ctx, Request{Date: testDate, From: Place{StopIDs: []string{"A"}}, To: Place{StopIDs: []string{"C"}}, MaxTransfers: -1, Time: -1})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
+
+func TestTimetableLoadOutlivesRequest(t *testing.T) {
+	source := newFakeSource()
+	source.block = make(chan struct{})
+	p := newTestPlanner(source)
+
+	// The request that starts the load gives up, but the load goes on for
+	// the requests after it.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := p.Timetable(ctx, testDate); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+	close(source.block)
+
+	if _, err := p.Timetable(context.Background(), testDate); err != nil {
+		t.Fatal(err)
+	}
+	if n := source.loads.Load(); n != 1 {
+		t.Errorf("loaded %d times, want 1", n)
+	}
+}
+
+func TestParetoSet(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	for range 100 {
+		var all []path
+		var set paretoSet
+		for range 50 {
+			pa := path{
+				legs:      make([]leg, 1+rng.IntN(3)),
+				departure: rng.IntN(20),
+				arrival:   20 + rng.IntN(20),
+			}
+			all = append(all, pa)
+			set.add(pa)
+		}
+
+		// Every path beaten by none of the others, and no other.
+		var want []path
+		for _, a := range all {
+			if !slices.ContainsFunc(all, func(b path) bool { return b.beats(a) }) {
+				want = append(want, a)
+			}
+		}
+		if len(set) != len(want) {
+			t.Fatalf("set holds %d paths, want %d", len(set), len(want))
+		}
+		for _, a := range set {
+			if slices.ContainsFunc(all, func(b path) bool { return b.beats(a) }) {
+				t.Fatalf("set holds the beaten path %+v", a)
+			}
+		}
+	}
+}
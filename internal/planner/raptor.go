@@ -0,0 +1,230 @@
+package planner
+
+import "math"
+
+const unreachable = math.MaxInt32
+
+// leg is one ride in a journey found by raptor, addressed by trip index and
+// positions in the trip's stop list.
+type leg struct {
+	trip       int
+	board      int
+	alight     int
+	boardStop  int
+	alightStop int
+}
+
+// endpoint is a stop a search may start or end at, with the time needed
+// to walk between it and the place the user asked for.
+type endpoint struct {
+	stop    int
+	seconds int
+	meters  float64
+}
+
+// path is a journey as found by raptor, before it is turned into models.
+// departure and arrival include the walks at both ends.
+type path struct {
+	legs      []leg
+	access    endpoint
+	egress    endpoint
+	departure int
+	arrival   int
+}
+
+type arrivalLabel struct {
+	set bool
+	leg leg
+}
+
+type readyLabel struct {
+	set  bool
+	from int // stop where the previous leg alighted, -1 at the origin
+}
+
+// raptor runs a round based search leaving for the origins at departure.
+// Round k only adds journeys with k rides, so the result holds at most one
+// path per number of rides and every path arrives strictly earlier than
+// the ones with fewer rides.
+func (tt *Timetable) raptor(origins, targets []endpoint, departure, maxRides int) []path {
+	n := len(tt.Stops)
+
+	isTarget := make([]bool, n)
+	egress := make([]endpoint, n)
+	for _, t := range targets {
+		isTarget[t.stop] = true
+		egress[t.stop] = t
+	}
+	access := make([]endpoint, n)
+
+	// ready[k][s] is the earliest time a trip can be boarded at s after k
+	// rides, arrival[k][s] the earliest arrival at s by the k-th ride.
+	ready := make([][]int, maxRides+1)
+	readyLabels := make([][]readyLabel, maxRides+1)
+	arrivalLabels := make([][]arrivalLabel, maxRides+1)
+	best := make([]int, n)
+	for i := range best {
+		best[i] = unreachable
+	}
+
+	ready[0] = make([]int, n)
+	readyLabels[0] = make([]readyLabel, n)
+	for i := range ready[0] {
+		ready[0][i] = unreachable
+	}
+
+	marked := make([]bool, n)
+	for _, o := range origins {
+		if isTarget[o.stop] {
+			continue
+		}
+		if t := departure + o.seconds; t < ready[0][o.stop] {
+			ready[0][o.stop] = t
+			readyLabels[0][o.stop] = readyLabel{set: true, from: -1}
+			access[o.stop] = o
+			marked[o.stop] = true
+		}
+	}
+
+	bestTarget := unreachable
+	var paths []path
+
+	for k := 1; k <= maxRides; k++ {
+		ready[k] = make([]int, n)
+		copy(ready[k], ready[k-1])
+		readyLabels[k] = make([]readyLabel, n)
+		arrivalLabels[k] = make([]arrivalLabel, n)
+		arrival := make([]int, n)
+		for i := range arrival {
+			arrival[i] = unreachable
+		}
+
+		queue := make(map[int]int)
+		for s, m := range marked {
+			if !m {
+				continue
+			}
+			for _, ps := range tt.stopPatterns[s] {
+				if pos, ok := queue[ps.pattern]; !ok || ps.position < pos {
+					queue[ps.pattern] = ps.position
+				}
+			}
+		}
+
+		reached := make([]bool, n)
+		improvedTarget := -1
+		for pi, start := range queue {
+			p := &tt.patterns[pi]
+			current := -1
+			boardPos := 0
+
+			for pos := start; pos < len(p.stops); pos++ {
+				s := p.stops[pos]
+
+				if current >= 0 {
+					t := &tt.trips[p.trips[current]]
+					arr := t.arrivals[pos]
+					if t.canAlight[pos] && arr < best[s] && arr < bestTarget {
+						arrival[s] = arr
+						best[s] = arr
+						arrivalLabels[k][s] = arrivalLabel{set: true, leg: leg{
+							trip:       p.trips[current],
+							board:      boardPos,
+							alight:     pos,
+							boardStop:  p.stops[boardPos],
+							alightStop: s,
+						}}
+						reached[s] = true
+						if isTarget[s] && arr+egress[s].seconds < bestTarget {
+							bestTarget = arr + egress[s].seconds
+							improvedTarget = s
+						}
+					}
+				}
+
+				if ready[k-1][s] == unreachable || pos == len(p.stops)-1 {
+					continue
+				}
+				if next := tt.earliestTrip(p, pos, ready[k-1][s]); next >= 0 {
+					if current < 0 || tt.trips[p.trips[next]].departures[pos] < tt.trips[p.trips[current]].departures[pos] {
+						current = next
+						boardPos = pos
+					}
+				}
+			}
+		}
+
+		if improvedTarget >= 0 {
+			pa := tt.reconstruct(arrivalLabels, readyLabels, k, improvedTarget)
+			pa.access = access[pa.legs[0].boardStop]
+			pa.egress = egress[improvedTarget]
+			pa.departure -= pa.access.seconds
+			pa.arrival += pa.egress.seconds
+			paths = append(paths, pa)
+		}
+
+		for i := range marked {
+			marked[i] = false
+		}
+		improved := false
+		for s, r := range reached {
+			if !r || isTarget[s] {
+				continue
+			}
+			for _, tr := range tt.transfers[s] {
+				t := arrival[s] + tr.duration
+				if t < ready[k][tr.to] {
+					ready[k][tr.to] = t
+					readyLabels[k][tr.to] = readyLabel{set: true, from: s}
+					marked[tr.to] = true
+					improved = true
+				}
+			}
+		}
+		if !improved {
+			break
+		}
+	}
+
+	return paths
+}
+
+// earliestTrip returns the index within p.trips of the first trip that can
+// be boarded at position pos no earlier than at, or -1.
+func (tt *Timetable) earliestTrip(p *pattern, pos, at int) int {
+	for i, ti := range p.trips {
+		t := &tt.trips[ti]
+		if t.departures[pos] >= at && t.canBoard[pos] {
+			return i
+		}
+	}
+	return -1
+}
+
+func (tt *Timetable) reconstruct(arrivals [][]arrivalLabel, readies [][]readyLabel, k, target int) path {
+	var legs []leg
+	stop := target
+	round := k
+	for round > 0 {
+		l := arrivals[round][stop].leg
+		legs = append([]leg{l}, legs...)
+
+		r := round - 1
+		for r > 0 && !readies[r][l.boardStop].set {
+			r--
+		}
+		if r == 0 {
+			break
+		}
+		stop = readies[r][l.boardStop].from
+		round = r
+	}
+
+	first := &tt.trips[legs[0].trip]
+	last := &tt.trips[legs[len(legs)-1].trip]
+	return path{
+		legs:      legs,
+		departure: first.departures[legs[0].board],
+		arrival:   last.arrivals[legs[len(legs)-1].alight],
+	}
+}
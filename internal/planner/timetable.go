@@ -0,0 +1,307 @@
+package planner
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Hajdudev/ecoDatabase/internal/geo"
+	"github.com/Hajdudev/ecoDatabase/internal/gtfs"
+	"github.com/Hajdudev/ecoDatabase/models"
+)
+
+// Timetable is the RAPTOR view of one service day: trips grouped into
+// patterns that share the same stop sequence, plus the transfers allowed
+// between stops.
+type Timetable struct {
+	// Date is the service day and Start the instant its times count from.
+	Date  time.Time
+	Start time.Time
+
+	Stops     []models.Stop
+	stopIndex map[string]int
+
+	grid *geo.Grid[int]
+
+	// Skipped lists the trips left out because their stop times could not
+	// be used, one error each.
+	Skipped []error
+
+	trips        []trip
+	tripPattern  []int
+	patterns     []pattern
+	stopPatterns [][]patternStop
+	transfers    [][]transfer
+}
+
+type trip struct {
+	id           string
+	routeID      string
+	serviceID    string
+	dayOffset    int
+	headsign     string
+	arrivals     []int
+	departures   []int
+	sequences    []int
+	canBoard     []bool
+	canAlight    []bool
+	pickupTypes  []int
+	stopHeadsign []string
+}
+
+// pattern is a RAPTOR route: trips visiting exactly the same stops, sorted
+// by their departure from the first stop.
+type pattern struct {
+	stops []int
+	trips []int
+}
+
+type patternStop struct {
+	pattern  int
+	position int
+}
+
+type transfer struct {
+	to       int
+	duration int
+}
+
+// ServiceDay holds the trips of one service day and how many days it lies
+// before or after the day the timetable is built for.
+type ServiceDay struct {
+	Offset    int
+	Trips     []models.Trip
+	StopTimes []models.StopTime
+}
+
+// NewTimetable indexes the trips running on date. Trips of other service
+// days are shifted by their offset, so a trip of the previous day leaving
+// at 24:30:00 becomes a trip at 00:30:00. stopTimes must be ordered by
+// trip and stop_sequence. Transfers are allowed at the same stop and
+// between stops sharing a parent station, both taking minTransfer seconds.
+// Trips that cannot be used are left out and listed in Skipped; they never
+// fail the whole day.
+func NewTimetable(date time.Time, loc *time.Location, stops []models.Stop, days []ServiceDay, minTransfer int) *Timetable {
+	tt := &Timetable{
+		Date:      date,
+		Start:     gtfs.ServiceDayStart(date, loc),
+		Stops:     stops,
+		stopIndex: make(map[string]int, len(stops)),
+	}
+	tt.grid = geo.NewGrid[int](0.01)
+	for i, s := range stops {
+		tt.stopIndex[s.StopID] = i
+		if s.LocationType == gtfs.LocationStop {
+			tt.grid.Insert(s.StopLat, s.StopLon, i)
+		}
+	}
+
+	patternIndex := make(map[string]int)
+	for _, day := range days {
+		tripInfo := make(map[string]models.Trip, len(day.Trips))
+		for _, t := range day.Trips {
+			tripInfo[t.TripID] = t
+		}
+
+		stopTimes := day.StopTimes
+		for start := 0; start < len(stopTimes); {
+			end := start
+			for end < len(stopTimes) && stopTimes[end].TripID == stopTimes[start].TripID {
+				end++
+			}
+			info, ok := tripInfo[stopTimes[start].TripID]
+			if ok && end-start >= 2 {
+				if err := tt.addTrip(info, stopTimes[start:end], day.Offset, patternIndex); err != nil {
+					tt.Skipped = append(tt.Skipped, err)
+				}
+			}
+			start = end
+		}
+	}
+
+	tt.stopPatterns = make([][]patternStop, len(stops))
+	for pi := range tt.patterns {
+		p := &tt.patterns[pi]
+		sort.Slice(p.trips, func(a, b int) bool {
+			return tt.trips[p.trips[a]].departures[0] < tt.trips[p.trips[b]].departures[0]
+		})
+		for pos, s := range p.stops {
+			tt.stopPatterns[s] = append(tt.stopPatterns[s], patternStop{pattern: pi, position: pos})
+		}
+	}
+
+	tt.buildTransfers(minTransfer)
+	return tt
+}
+
+func (tt *Timetable) addTrip(info models.Trip, stopTimes []models.StopTime, dayOffset int, patternIndex map[string]int) error {
+	t := trip{
+		id:        info.TripID,
+		routeID:   info.RouteID,
+		serviceID: info.ServiceID,
+		dayOffset: dayOffset,
+		headsign:  info.TripHeadsign,
+	}
+	shift := dayOffset * gtfs.SecondsPerDay
+
+	stops := make([]int, 0, len(stopTimes))
+	for _, st := range stopTimes {
+		s, ok := tt.stopIndex[st.StopID]
+		if !ok {
+			return fmt.Errorf("trip %s references unknown stop %s", st.TripID, st.StopID)
+		}
+		stops = append(stops, s)
+	}
+	arrivals, departures, err := tt.stopTimeSeconds(stopTimes, stops)
+	if err != nil {
+		return err
+	}
+
+	var key strings.Builder
+	for i, st := range stopTimes {
+		key.WriteString(strconv.Itoa(stops[i]))
+		key.WriteByte(',')
+
+		t.arrivals = append(t.arrivals, arrivals[i]+shift)
+		t.departures = append(t.departures, departures[i]+shift)
+		t.sequences = append(t.sequences, st.StopSequence)
+		t.canBoard = append(t.canBoard, st.PickupType != 1)
+		t.canAlight = append(t.canAlight, st.DropOffType != 1)
+		t.pickupTypes = append(t.pickupTypes, st.PickupType)
+		t.stopHeadsign = append(t.stopHeadsign, st.StopHeadsign)
+	}
+
+	pi, ok := patternIndex[key.String()]
+	if !ok {
+		pi = len(tt.patterns)
+		patternIndex[key.String()] = pi
+		tt.patterns = append(tt.patterns, pattern{stops: stops})
+	}
+	tt.patterns[pi].trips = append(tt.patterns[pi].trips, len(tt.trips))
+	tt.trips = append(tt.trips, t)
+	tt.tripPattern = append(tt.tripPattern, pi)
+	return nil
+}
+
+// stopTimeSeconds parses the arrival and departure times of one trip.
+// Stops without times are interpolated between the timed stops around
+// them, by shape_dist_traveled when the feed gives it and by the distance
+// between the stops otherwise, as GTFS intends. The first and last stop
+// must have times.
+func (tt *Timetable) stopTimeSeconds(stopTimes []models.StopTime, stops []int) (arrivals, departures []int, err error) {
+	n := len(stopTimes)
+	arrivals = make([]int, n)
+	departures = make([]int, n)
+	timed := make([]bool, n)
+	for i, st := range stopTimes {
+		if st.ArrivalTime == "" && st.DepartureTime == "" {
+			continue
+		}
+		if arrivals[i], err = gtfs.ParseTime(st.ArrivalTime); err != nil {
+			return nil, nil, fmt.Errorf("trip %s: %w", st.TripID, err)
+		}
+		if departures[i], err = gtfs.ParseTime(st.DepartureTime); err != nil {
+			return nil, nil, fmt.Errorf("trip %s: %w", st.TripID, err)
+		}
+		timed[i] = true
+	}
+	if !timed[0] || !timed[n-1] {
+		return nil, nil, fmt.Errorf("trip %s has no time at its first or last stop", stopTimes[0].TripID)
+	}
+
+	for from := 0; from < n-1; {
+		to := from + 1
+		for !timed[to] {
+			to++
+		}
+		if to > from+1 {
+			dist := tt.distances(stopTimes[from:to+1], stops[from:to+1])
+			total := dist[len(dist)-1]
+			span := arrivals[to] - departures[from]
+			for k := from + 1; k < to; k++ {
+				var at int
+				if total > 0 {
+					at = departures[from] + int(math.Round(float64(span)*dist[k-from]/total))
+				} else {
+					at = departures[from] + span*(k-from)/(to-from)
+				}
+				arrivals[k], departures[k] = at, at
+			}
+		}
+		from = to
+	}
+	return arrivals, departures, nil
+}
+
+// distances returns how far along the trip each of stopTimes lies from
+// the first one, using shape_dist_traveled when it increases along them.
+func (tt *Timetable) distances(stopTimes []models.StopTime, stops []int) []float64 {
+	dist := make([]float64, len(stopTimes))
+	byShape := true
+	for k := 1; k < len(stopTimes); k++ {
+		if stopTimes[k].ShapeDistTraveled < stopTimes[k-1].ShapeDistTraveled {
+			byShape = false
+		}
+	}
+	if byShape && stopTimes[len(stopTimes)-1].ShapeDistTraveled > stopTimes[0].ShapeDistTraveled {
+		for k := range stopTimes {
+			dist[k] = stopTimes[k].ShapeDistTraveled - stopTimes[0].ShapeDistTraveled
+		}
+		return dist
+	}
+	for k := 1; k < len(stops); k++ {
+		a, b := tt.Stops[stops[k-1]], tt.Stops[stops[k]]
+		dist[k] = dist[k-1] + geo.Distance(a.StopLat, a.StopLon, b.StopLat, b.StopLon)
+	}
+	return dist
+}
+
+func (tt *Timetable) buildTransfers(minTransfer int) {
+	tt.transfers = make([][]transfer, len(tt.Stops))
+
+	stations := make(map[string][]int)
+	for i, s := range tt.Stops {
+		tt.transfers[i] = append(tt.transfers[i], transfer{to: i, duration: minTransfer})
+		if s.ParentStation != "" {
+			stations[s.ParentStation] = append(stations[s.ParentStation], i)
+		}
+	}
+
+	for _, platforms := range stations {
+		for _, a := range platforms {
+			for _, b := range platforms {
+				if a != b {
+					tt.transfers[a] = append(tt.transfers[a], transfer{to: b, duration: minTransfer})
+				}
+			}
+		}
+	}
+}
+
+// departuresFrom lists the distinct times at which one can leave for the
+// origins and board a trip there, between from and until and in ascending
+// order.
+func (tt *Timetable) departuresFrom(origins []endpoint, from, until int) []int {
+	seen := make(map[int]bool)
+	for _, o := range origins {
+		for _, ps := range tt.stopPatterns[o.stop] {
+			for _, ti := range tt.patterns[ps.pattern].trips {
+				t := &tt.trips[ti]
+				leave := t.departures[ps.position] - o.seconds
+				if t.canBoard[ps.position] && leave >= from && leave <= until {
+					seen[leave] = true
+				}
+			}
+		}
+	}
+
+	times := make([]int, 0, len(seen))
+	for dep := range seen {
+		times = append(times, dep)
+	}
+	sort.Ints(times)
+	return times
+}
@@ -0,0 +1,312 @@
+package realtime
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	gtfsrt "github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+
+	"github.com/Hajdudev/ecoDatabase/models"
+)
+
+const (
+	AlertSourceFeed   = "feed"
+	AlertSourceManual = "manual"
+)
+
+// ErrAlertNotFound is returned when a manual alert does not exist.
+var ErrAlertNotFound = errors.New("alert not found")
+
+// AlertStore persists manual alerts, so that every server instance
+// sharing it shows the same ones.
+type AlertStore interface {
+	ManualAlerts(ctx context.Context) ([]models.Alert, error)
+	PutManualAlert(ctx context.Context, alert models.Alert) error
+	// DeleteManualAlert reports whether the alert existed.
+	DeleteManualAlert(ctx context.Context, id string) (bool, error)
+}
+
+// Alerts holds the service alerts from a GTFS-RT Alerts feed together with
+// the ones written by hand. Feed alerts are replaced on every fetch.
+// Manual alerts are written to the AlertStore and kept in memory for
+// matching; Reload picks up the ones other instances wrote. Without a
+// store they only live in memory.
+type Alerts struct {
+	store AlertStore
+
+	mu     sync.RWMutex
+	feed   []models.Alert
+	manual map[string]models.Alert
+}
+
+// NewAlerts returns Alerts persisting manual alerts to store, which may be
+// nil.
+func NewAlerts(store AlertStore) *Alerts {
+	return &Alerts{store: store, manual: make(map[string]models.Alert)}
+}
+
+// Apply replaces the feed alerts with the alerts in msg.
+func (a *Alerts) Apply(msg *gtfsrt.FeedMessage) {
+	var alerts []models.Alert
+	for _, e := range msg.GetEntity() {
+		al := e.GetAlert()
+		if e.GetIsDeleted() || al == nil {
+			continue
+		}
+
+		alert := models.Alert{
+			ID:              e.GetId(),
+			Source:          AlertSourceFeed,
+			Cause:           al.GetCause().String(),
+			Effect:          al.GetEffect().String(),
+			HeaderText:      translations(al.GetHeaderText()),
+			DescriptionText: translations(al.GetDescriptionText()),
+			URL:             translations(al.GetUrl()),
+		}
+		for _, p := range al.GetActivePeriod() {
+			var period models.AlertPeriod
+			if p.Start != nil {
+				t := time.Unix(int64(p.GetStart()), 0).UTC()
+				period.Start = &t
+			}
+			if p.End != nil {
+				t := time.Unix(int64(p.GetEnd()), 0).UTC()
+				period.End = &t
+			}
+			alert.ActivePeriods = append(alert.ActivePeriods, period)
+		}
+		for _, ie := range al.GetInformedEntity() {
+			entity := models.AlertEntity{
+				AgencyID: ie.GetAgencyId(),
+				RouteID:  ie.GetRouteId(),
+				TripID:   ie.GetTrip().GetTripId(),
+				StopID:   ie.GetStopId(),
+			}
+			if ie.RouteType != nil {
+				rt := int(ie.GetRouteType())
+				entity.RouteType = &rt
+			}
+			if entity.TripID != "" && entity.RouteID == "" {
+				entity.RouteID = ie.GetTrip().GetRouteId()
+			}
+			alert.InformedEntities = append(alert.InformedEntities, entity)
+		}
+		alerts = append(alerts, alert)
+	}
+
+	a.mu.Lock()
+	a.feed = alerts
+	a.mu.Unlock()
+}
+
+func translations(s *gtfsrt.TranslatedString) []models.LocalizedText {
+	var out []models.LocalizedText
+	for _, t := range s.GetTranslation() {
+		out = append(out, models.LocalizedText{Language: t.GetLanguage(), Text: t.GetText()})
+	}
+	return out
+}
+
+// Put stores a manual alert, replacing any alert with the same id. An
+// empty id is filled with a random one. The stored alert is returned.
+func (a *Alerts) Put(ctx context.Context, alert models.Alert) (models.Alert, error) {
+	if alert.ID == "" {
+		var b [8]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			return models.Alert{}, fmt.Errorf("generating an alert id: %w", err)
+		}
+		alert.ID = hex.EncodeToString(b[:])
+	}
+	alert.Source = AlertSourceManual
+
+	if a.store != nil {
+		if err := a.store.PutManualAlert(ctx, alert); err != nil {
+			return models.Alert{}, err
+		}
+	}
+	a.mu.Lock()
+	a.manual[alert.ID] = alert
+	a.mu.Unlock()
+	return alert, nil
+}
+
+// Delete removes a manual alert.
+func (a *Alerts) Delete(ctx context.Context, id string) error {
+	if a.store != nil {
+		found, err := a.store.DeleteManualAlert(ctx, id)
+		if err != nil {
+			return err
+		}
+		a.mu.Lock()
+		delete(a.manual, id)
+		a.mu.Unlock()
+		if !found {
+			return ErrAlertNotFound
+		}
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.manual[id]; !ok {
+		return ErrAlertNotFound
+	}
+	delete(a.manual, id)
+	return nil
+}
+
+// Reload replaces the manual alerts in memory with the ones in the store.
+func (a *Alerts) Reload(ctx context.Context) error {
+	if a.store == nil {
+		return nil
+	}
+	alerts, err := a.store.ManualAlerts(ctx)
+	if err != nil {
+		return err
+	}
+	manual := make(map[string]models.Alert, len(alerts))
+	for _, alert := range alerts {
+		alert.Source = AlertSourceManual
+		manual[alert.ID] = alert
+	}
+
+	a.mu.Lock()
+	a.manual = manual
+	a.mu.Unlock()
+	return nil
+}
+
+// Watch calls Reload every interval until ctx is done, so manual alerts
+// written by other instances show up here too.
+func (a *Alerts) Watch(ctx context.Context, interval time.Duration, logger *log.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := a.Reload(ctx); err != nil {
+			logger.Printf("alerts: reloading manual alerts: %v", err)
+		}
+	}
+}
+
+// Manual returns the manual alerts ordered by id.
+func (a *Alerts) Manual() []models.Alert {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	out := make([]models.Alert, 0, len(a.manual))
+	for _, alert := range a.manual {
+		out = append(out, alert)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// Scope describes what a response item touches. Empty fields, a negative
+// RouteType and nil StopIDs are unknown.
+type Scope struct {
+	AgencyID  string
+	RouteID   string
+	RouteType int
+	TripID    string
+	StopIDs   []string
+}
+
+// matches reports whether e applies to the scope. Every field e sets that
+// the scope knows has to be equal, and at least one has to be known, so an
+// alert for a stop on one route shows up on that stop and on that route
+// but not on other routes through the stop.
+func (s Scope) matches(e models.AlertEntity) bool {
+	known := false
+	if e.AgencyID != "" && s.AgencyID != "" {
+		if e.AgencyID != s.AgencyID {
+			return false
+		}
+		known = true
+	}
+	if e.RouteID != "" && s.RouteID != "" {
+		if e.RouteID != s.RouteID {
+			return false
+		}
+		known = true
+	}
+	if e.RouteType != nil && s.RouteType >= 0 {
+		if *e.RouteType != s.RouteType {
+			return false
+		}
+		known = true
+	}
+	if e.TripID != "" && s.TripID != "" {
+		if e.TripID != s.TripID {
+			return false
+		}
+		known = true
+	}
+	if e.StopID != "" && s.StopIDs != nil {
+		if !slices.Contains(s.StopIDs, e.StopID) {
+			return false
+		}
+		known = true
+	}
+	return known
+}
+
+// active reports whether alert is active at some point between from and
+// to. Alerts without active periods are always active.
+func active(alert models.Alert, from, to time.Time) bool {
+	if len(alert.ActivePeriods) == 0 {
+		return true
+	}
+	for _, p := range alert.ActivePeriods {
+		if (p.Start == nil || !p.Start.After(to)) && (p.End == nil || !p.End.Before(from)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Active returns the alerts active between from and to.
+func (a *Alerts) Active(from, to time.Time) []models.Alert {
+	return a.Matching(nil, from, to)
+}
+
+// Matching returns the alerts active between from and to that apply to
+// scope. A nil scope matches every alert.
+func (a *Alerts) Matching(scope *Scope, from, to time.Time) []models.Alert {
+	if a == nil {
+		return nil
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	var out []models.Alert
+	check := func(alert models.Alert) {
+		if !active(alert, from, to) {
+			return
+		}
+		if scope == nil || slices.ContainsFunc(alert.InformedEntities, scope.matches) {
+			out = append(out, alert)
+		}
+	}
+	for _, alert := range a.feed {
+		check(alert)
+	}
+	for _, alert := range a.manual {
+		check(alert)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
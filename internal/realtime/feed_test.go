@@ -0,0 +1,80 @@
+package realtime
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gtfsrt "github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"google.golang.org/protobuf/proto"
+)
+
+// writeFeed stores a feed message holding entities in a file, the way
+// tests and offline setups stub a realtime source, and returns its path.
+func writeFeed(t *testing.T, path string, entities ...*gtfsrt.FeedEntity) string {
+	t.Helper()
+	msg := &gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{
+			GtfsRealtimeVersion: proto.String("2.0"),
+			Timestamp:           proto.Uint64(uint64(time.Now().Unix())),
+		},
+		Entity: entities,
+	}
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path == "" {
+		path = filepath.Join(t.TempDir(), "feed.pb")
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// readFeed fetches the message at path as the pollers do.
+func readFeed(t *testing.T, path string) *gtfsrt.FeedMessage {
+	t.Helper()
+	msg, err := Fetch(context.Background(), nil, "file://"+path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestPollerKeepsLastGoodFeed(t *testing.T) {
+	path := writeFeed(t, "", tripEntity("T1", "", stopDelay(1, 60)))
+	tu := NewTripUpdates()
+	p := &Poller{
+		Source:   path,
+		Interval: time.Second,
+		Logger:   log.New(io.Discard, "", 0),
+		Apply:    tu.Apply,
+	}
+	p.poll(context.Background())
+	if _, ok := tu.Predict("T1", testServiceDate, testStops()); !ok {
+		t.Fatal("the first poll was not applied")
+	}
+	updated := tu.Updated()
+
+	// A broken feed and a missing one both leave the last good data in
+	// place.
+	if err := os.WriteFile(path, []byte("not a feed message"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p.poll(context.Background())
+	p.Source = filepath.Join(t.TempDir(), "missing.pb")
+	p.poll(context.Background())
+
+	if _, ok := tu.Predict("T1", testServiceDate, testStops()); !ok {
+		t.Error("a failed fetch dropped the trip updates")
+	}
+	if !tu.Updated().Equal(updated) {
+		t.Error("a failed fetch replaced the trip updates")
+	}
+}
@@ -0,0 +1,244 @@
+package realtime
+
+import (
+	"sync"
+	"time"
+
+	gtfsrt "github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+)
+
+// TripUpdates is the in-memory delay table built from a GTFS-RT
+// TripUpdates feed. Every fetched message replaces the whole table, as
+// feeds publish the full dataset each time.
+type TripUpdates struct {
+	mu      sync.RWMutex
+	trips   map[string]tripUpdate
+	updated time.Time
+}
+
+type tripUpdate struct {
+	startDate string
+	cancelled bool
+	delay     *int32
+	stops     []stopUpdate
+}
+
+type stopUpdate struct {
+	stopID    string
+	sequence  int // -1 when the feed only gave a stop_id
+	skipped   bool
+	noData    bool
+	arrival   *event
+	departure *event
+}
+
+// event is either a delay in seconds or an absolute time.
+type event struct {
+	delay    int32
+	hasDelay bool
+	time     int64
+}
+
+func NewTripUpdates() *TripUpdates {
+	return &TripUpdates{trips: make(map[string]tripUpdate)}
+}
+
+// Apply replaces the delay table with the trip updates in msg.
+func (tu *TripUpdates) Apply(msg *gtfsrt.FeedMessage) {
+	trips := make(map[string]tripUpdate)
+	for _, e := range msg.GetEntity() {
+		u := e.GetTripUpdate()
+		if e.GetIsDeleted() || u == nil || u.GetTrip().GetTripId() == "" {
+			continue
+		}
+
+		t := tripUpdate{
+			startDate: u.GetTrip().GetStartDate(),
+			cancelled: u.GetTrip().GetScheduleRelationship() == gtfsrt.TripDescriptor_CANCELED,
+		}
+		if u.Delay != nil {
+			d := u.GetDelay()
+			t.delay = &d
+		}
+		for _, stu := range u.GetStopTimeUpdate() {
+			su := stopUpdate{
+				stopID:    stu.GetStopId(),
+				sequence:  -1,
+				skipped:   stu.GetScheduleRelationship() == gtfsrt.TripUpdate_StopTimeUpdate_SKIPPED,
+				noData:    stu.GetScheduleRelationship() == gtfsrt.TripUpdate_StopTimeUpdate_NO_DATA,
+				arrival:   newEvent(stu.GetArrival()),
+				departure: newEvent(stu.GetDeparture()),
+			}
+			if stu.StopSequence != nil {
+				su.sequence = int(stu.GetStopSequence())
+			}
+			t.stops = append(t.stops, su)
+		}
+		trips[u.GetTrip().GetTripId()] = t
+	}
+
+	tu.mu.Lock()
+	tu.trips = trips
+	tu.updated = time.Now()
+	tu.mu.Unlock()
+}
+
+func newEvent(e *gtfsrt.TripUpdate_StopTimeEvent) *event {
+	if e == nil {
+		return nil
+	}
+	return &event{delay: e.GetDelay(), hasDelay: e.Delay != nil, time: e.GetTime()}
+}
+
+// StopKey identifies one scheduled stop of a trip.
+type StopKey struct {
+	StopID             string
+	Sequence           int
+	ScheduledArrival   time.Time
+	ScheduledDeparture time.Time
+}
+
+// StopPrediction is the realtime view of one StopKey.
+type StopPrediction struct {
+	Arrival        time.Time
+	Departure      time.Time
+	ArrivalDelay   int
+	DepartureDelay int
+	Skipped        bool
+	// Known is false when the feed says nothing about this stop, in
+	// which case the prediction equals the schedule.
+	Known bool
+}
+
+// TripPrediction holds the predictions for the stops passed to Predict.
+type TripPrediction struct {
+	Cancelled bool
+	Stops     []StopPrediction
+}
+
+// Predict applies the current delays of tripID, running on serviceDate
+// (YYYYMMDD), to stops, which must be in stop_sequence order. Delays
+// propagate downstream from the last stop with an update, as the GTFS-RT
+// spec describes, and ok is false when there is no update for the trip.
+func (tu *TripUpdates) Predict(tripID, serviceDate string, stops []StopKey) (p TripPrediction, ok bool) {
+	tu.mu.RLock()
+	t, found := tu.trips[tripID]
+	tu.mu.RUnlock()
+	if !found || (t.startDate != "" && t.startDate != serviceDate) {
+		return TripPrediction{}, false
+	}
+
+	p.Cancelled = t.cancelled
+	p.Stops = make([]StopPrediction, len(stops))
+
+	var delay int32
+	known := false
+	if t.delay != nil {
+		delay, known = *t.delay, true
+	}
+
+	next := 0
+	for i, s := range stops {
+		sp := StopPrediction{
+			Arrival:   s.ScheduledArrival,
+			Departure: s.ScheduledDeparture,
+		}
+
+		// Every update up to and including this stop moves the
+		// propagated delay forward.
+		var here *stopUpdate
+		for next < len(t.stops) {
+			u := &t.stops[next]
+			if u.sequence > s.Sequence {
+				break
+			}
+			next++
+			if u.sequence < 0 {
+				continue
+			}
+			if u.matches(s) {
+				here = u
+			}
+			delay, known = u.propagatedDelay(delay, known, s)
+		}
+		if here == nil {
+			// Updates given by stop_id only are matched out of order.
+			for j := range t.stops {
+				if t.stops[j].sequence < 0 && t.stops[j].stopID == s.StopID {
+					here = &t.stops[j]
+					delay, known = here.propagatedDelay(delay, known, s)
+				}
+			}
+		}
+
+		switch {
+		case here != nil && here.skipped:
+			sp.Skipped, sp.Known = true, true
+		case here != nil && here.noData:
+			known = false
+		case known:
+			sp.Known = true
+			sp.ArrivalDelay, sp.DepartureDelay = int(delay), int(delay)
+			if here != nil && here.arrival != nil {
+				sp.ArrivalDelay = here.arrival.delayAt(s.ScheduledArrival, delay)
+			}
+			if here != nil && here.departure != nil {
+				sp.DepartureDelay = here.departure.delayAt(s.ScheduledDeparture, delay)
+			}
+			sp.Arrival = s.ScheduledArrival.Add(time.Duration(sp.ArrivalDelay) * time.Second)
+			sp.Departure = s.ScheduledDeparture.Add(time.Duration(sp.DepartureDelay) * time.Second)
+		}
+		p.Stops[i] = sp
+	}
+	return p, true
+}
+
+func (u *stopUpdate) matches(s StopKey) bool {
+	if u.sequence >= 0 {
+		return u.sequence == s.Sequence
+	}
+	return u.stopID == s.StopID
+}
+
+// propagatedDelay returns the delay carried past this update. Only updates
+// at stop s can turn absolute times into delays; earlier ones keep their
+// explicit delay values.
+func (u *stopUpdate) propagatedDelay(delay int32, known bool, s StopKey) (int32, bool) {
+	if u.noData {
+		return 0, false
+	}
+	for _, e := range []*event{u.departure, u.arrival} {
+		if e == nil {
+			continue
+		}
+		if e.hasDelay {
+			return e.delay, true
+		}
+		if e.time != 0 && u.matches(s) {
+			scheduled := s.ScheduledDeparture
+			if e == u.arrival {
+				scheduled = s.ScheduledArrival
+			}
+			return int32(e.time - scheduled.Unix()), true
+		}
+	}
+	return delay, known
+}
+
+func (e *event) delayAt(scheduled time.Time, fallback int32) int {
+	switch {
+	case e.time != 0:
+		return int(e.time - scheduled.Unix())
+	case e.hasDelay:
+		return int(e.delay)
+	default:
+		return int(fallback)
+	}
+}
+
+// Updated returns when the table was last replaced.
+func (tu *TripUpdates) Updated() time.Time {
+	tu.mu.RLock()
+	defer tu.mu.RUnlock()
+	return tu.updated
+}
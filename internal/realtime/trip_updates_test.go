@@ -0,0 +1,204 @@
+package realtime
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	gtfsrt "github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"google.golang.org/protobuf/proto"
+)
+
+const testServiceDate = "20250304"
+
+// testStops are four stops of a trip ten minutes apart from 08:00.
+func testStops() []StopKey {
+	start := time.Date(2025, 3, 4, 8, 0, 0, 0, time.UTC)
+	stops := make([]StopKey, 4)
+	for i := range stops {
+		at := start.Add(time.Duration(i) * 10 * time.Minute)
+		stops[i] = StopKey{
+			StopID:             fmt.Sprintf("S%d", i+1),
+			Sequence:           i + 1,
+			ScheduledArrival:   at,
+			ScheduledDeparture: at,
+		}
+	}
+	return stops
+}
+
+func tripEntity(tripID, startDate string, updates ...*gtfsrt.TripUpdate_StopTimeUpdate) *gtfsrt.FeedEntity {
+	trip := &gtfsrt.TripDescriptor{TripId: proto.String(tripID)}
+	if startDate != "" {
+		trip.StartDate = proto.String(startDate)
+	}
+	return &gtfsrt.FeedEntity{
+		Id:         proto.String(tripID),
+		TripUpdate: &gtfsrt.TripUpdate{Trip: trip, StopTimeUpdate: updates},
+	}
+}
+
+func stopDelay(sequence uint32, delay int32) *gtfsrt.TripUpdate_StopTimeUpdate {
+	return &gtfsrt.TripUpdate_StopTimeUpdate{
+		StopSequence: proto.Uint32(sequence),
+		Arrival:      &gtfsrt.TripUpdate_StopTimeEvent{Delay: proto.Int32(delay)},
+	}
+}
+
+func stopStatus(sequence uint32, status gtfsrt.TripUpdate_StopTimeUpdate_ScheduleRelationship) *gtfsrt.TripUpdate_StopTimeUpdate {
+	return &gtfsrt.TripUpdate_StopTimeUpdate{
+		StopSequence:         proto.Uint32(sequence),
+		ScheduleRelationship: status.Enum(),
+	}
+}
+
+// describe summarises each stop prediction as "" when unknown, "skipped",
+// or the arrival delay in seconds.
+func describe(p TripPrediction) []string {
+	var out []string
+	for _, s := range p.Stops {
+		switch {
+		case s.Skipped:
+			out = append(out, "skipped")
+		case s.Known:
+			out = append(out, fmt.Sprintf("%+d", s.ArrivalDelay))
+		default:
+			out = append(out, "")
+		}
+	}
+	return out
+}
+
+func TestPredict(t *testing.T) {
+	eight10 := time.Date(2025, 3, 4, 8, 10, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		entity *gtfsrt.FeedEntity
+		want   []string
+	}{
+		{
+			name:   "delay propagates to later stops",
+			entity: tripEntity("T1", "", stopDelay(2, 120)),
+			want:   []string{"", "+120", "+120", "+120"},
+		},
+		{
+			name:   "a later update replaces the propagated delay",
+			entity: tripEntity("T1", "", stopDelay(1, 60), stopDelay(3, -30)),
+			want:   []string{"+60", "+60", "-30", "-30"},
+		},
+		{
+			name: "absolute times become delays",
+			entity: tripEntity("T1", "", &gtfsrt.TripUpdate_StopTimeUpdate{
+				StopSequence: proto.Uint32(2),
+				Arrival:      &gtfsrt.TripUpdate_StopTimeEvent{Time: proto.Int64(eight10.Add(5 * time.Minute).Unix())},
+			}),
+			want: []string{"", "+300", "+300", "+300"},
+		},
+		{
+			name:   "skipped stop",
+			entity: tripEntity("T1", "", stopDelay(1, 60), stopStatus(2, gtfsrt.TripUpdate_StopTimeUpdate_SKIPPED)),
+			want:   []string{"+60", "skipped", "+60", "+60"},
+		},
+		{
+			name:   "no data ends the propagation",
+			entity: tripEntity("T1", "", stopDelay(1, 60), stopStatus(3, gtfsrt.TripUpdate_StopTimeUpdate_NO_DATA)),
+			want:   []string{"+60", "+60", "", ""},
+		},
+		{
+			name:   "no data followed by a new delay",
+			entity: tripEntity("T1", "", stopStatus(1, gtfsrt.TripUpdate_StopTimeUpdate_NO_DATA), stopDelay(3, 45)),
+			want:   []string{"", "", "+45", "+45"},
+		},
+		{
+			name: "update by stop_id only",
+			entity: tripEntity("T1", "", &gtfsrt.TripUpdate_StopTimeUpdate{
+				StopId:  proto.String("S3"),
+				Arrival: &gtfsrt.TripUpdate_StopTimeEvent{Delay: proto.Int32(180)},
+			}),
+			want: []string{"", "", "+180", "+180"},
+		},
+		{
+			name:   "matching start date",
+			entity: tripEntity("T1", testServiceDate, stopDelay(1, 60)),
+			want:   []string{"+60", "+60", "+60", "+60"},
+		},
+		{
+			name:   "start date of another service day",
+			entity: tripEntity("T1", "20250305", stopDelay(1, 60)),
+			want:   nil,
+		},
+		{
+			name:   "update for another trip",
+			entity: tripEntity("T2", "", stopDelay(1, 60)),
+			want:   nil,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tu := NewTripUpdates()
+			tu.Apply(readFeed(t, writeFeed(t, "", tc.entity)))
+
+			p, ok := tu.Predict("T1", testServiceDate, testStops())
+			if ok != (tc.want != nil) {
+				t.Fatalf("ok = %v, want %v", ok, tc.want != nil)
+			}
+			if got := describe(p); !slices.Equal(got, tc.want) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPredictTimes(t *testing.T) {
+	entity := tripEntity("T1", "", stopDelay(2, 120), &gtfsrt.TripUpdate_StopTimeUpdate{
+		StopSequence: proto.Uint32(3),
+		Arrival:      &gtfsrt.TripUpdate_StopTimeEvent{Delay: proto.Int32(120)},
+		Departure:    &gtfsrt.TripUpdate_StopTimeEvent{Delay: proto.Int32(180)},
+	})
+	tu := NewTripUpdates()
+	tu.Apply(readFeed(t, writeFeed(t, "", entity)))
+
+	stops := testStops()
+	p, ok := tu.Predict("T1", testServiceDate, stops)
+	if !ok {
+		t.Fatal("no prediction")
+	}
+	// A longer dwell at S3 carries its departure delay on to S4.
+	s3, s4 := p.Stops[2], p.Stops[3]
+	if s3.ArrivalDelay != 120 || s3.DepartureDelay != 180 {
+		t.Errorf("S3 delays %d/%d, want 120/180", s3.ArrivalDelay, s3.DepartureDelay)
+	}
+	if !s3.Departure.Equal(stops[2].ScheduledDeparture.Add(3 * time.Minute)) {
+		t.Errorf("S3 departs %v", s3.Departure)
+	}
+	if s4.ArrivalDelay != 180 {
+		t.Errorf("S4 arrival delay %d, want 180", s4.ArrivalDelay)
+	}
+	// Before the first update the schedule stands.
+	if !p.Stops[0].Arrival.Equal(stops[0].ScheduledArrival) {
+		t.Errorf("S1 arrives %v", p.Stops[0].Arrival)
+	}
+}
+
+func TestPredictCancelled(t *testing.T) {
+	entity := tripEntity("T1", "")
+	entity.TripUpdate.Trip.ScheduleRelationship = gtfsrt.TripDescriptor_CANCELED.Enum()
+	tu := NewTripUpdates()
+	tu.Apply(readFeed(t, writeFeed(t, "", entity)))
+
+	p, ok := tu.Predict("T1", testServiceDate, testStops())
+	if !ok || !p.Cancelled {
+		t.Errorf("ok %v, cancelled %v, want a cancelled trip", ok, p.Cancelled)
+	}
+}
+
+func TestApplyReplacesTable(t *testing.T) {
+	tu := NewTripUpdates()
+	tu.Apply(readFeed(t, writeFeed(t, "", tripEntity("T1", "", stopDelay(1, 60)))))
+	tu.Apply(readFeed(t, writeFeed(t, "", tripEntity("T2", "", stopDelay(1, 60)))))
+	if _, ok := tu.Predict("T1", testServiceDate, testStops()); ok {
+		t.Error("T1 is still predicted after a feed without it")
+	}
+}
@@ -0,0 +1,223 @@
+package realtime
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	gtfsrt "github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+
+	"github.com/Hajdudev/ecoDatabase/models"
+)
+
+// TripRouteLookup is the part of store.DatabaseStore used to join vehicles
+// to their trip and route.
+type TripRouteLookup interface {
+	GetTripsByID(ctx context.Context, ids []string) ([]models.Trip, error)
+	GetRoutesByID(ctx context.Context, ids []string) ([]models.Route, error)
+}
+
+// lookupTimeout bounds the store queries of one Apply.
+const lookupTimeout = 10 * time.Second
+
+// VehicleEvent describes what changed between two VehiclePositions fetches.
+type VehicleEvent struct {
+	Updated []models.Vehicle `json:"updated"`
+	Removed []string         `json:"removed"`
+}
+
+// Vehicles keeps the latest position of every vehicle from a GTFS-RT
+// VehiclePositions feed and notifies subscribers of changes.
+type Vehicles struct {
+	lookup TripRouteLookup
+	logger *log.Logger
+
+	mu          sync.RWMutex
+	vehicles    map[string]models.Vehicle
+	subscribers map[chan VehicleEvent]struct{}
+
+	// trips and routes cache the static data vehicles are joined with.
+	// They are only touched by Apply, which runs on the poller goroutine;
+	// ResetStatic asks it to drop them through stale.
+	trips  map[string]models.Trip
+	routes map[string]models.Route
+	stale  atomic.Bool
+}
+
+func NewVehicles(lookup TripRouteLookup, logger *log.Logger) *Vehicles {
+	return &Vehicles{
+		lookup:      lookup,
+		logger:      logger,
+		vehicles:    make(map[string]models.Vehicle),
+		subscribers: make(map[chan VehicleEvent]struct{}),
+		trips:       make(map[string]models.Trip),
+		routes:      make(map[string]models.Route),
+	}
+}
+
+// Apply replaces the vehicle table with the positions in msg and sends
+// the difference to subscribers.
+func (v *Vehicles) Apply(msg *gtfsrt.FeedMessage) {
+	next := make(map[string]models.Vehicle)
+	for _, e := range msg.GetEntity() {
+		vp := e.GetVehicle()
+		if e.GetIsDeleted() || vp == nil || vp.GetPosition() == nil {
+			continue
+		}
+
+		id := vp.GetVehicle().GetId()
+		if id == "" {
+			id = e.GetId()
+		}
+		veh := models.Vehicle{
+			VehicleID:     id,
+			Label:         vp.GetVehicle().GetLabel(),
+			TripID:        vp.GetTrip().GetTripId(),
+			RouteID:       vp.GetTrip().GetRouteId(),
+			Lat:           float64(vp.GetPosition().GetLatitude()),
+			Lon:           float64(vp.GetPosition().GetLongitude()),
+			Bearing:       vp.GetPosition().GetBearing(),
+			Speed:         vp.GetPosition().GetSpeed(),
+			StopID:        vp.GetStopId(),
+			CurrentStatus: vp.GetCurrentStatus().String(),
+		}
+		if ts := vp.GetTimestamp(); ts != 0 {
+			veh.Timestamp = time.Unix(int64(ts), 0).UTC()
+		}
+		next[id] = veh
+	}
+	v.join(next)
+
+	v.mu.Lock()
+	var event VehicleEvent
+	for id, veh := range next {
+		if old, ok := v.vehicles[id]; !ok || old != veh {
+			event.Updated = append(event.Updated, veh)
+		}
+	}
+	for id := range v.vehicles {
+		if _, ok := next[id]; !ok {
+			event.Removed = append(event.Removed, id)
+		}
+	}
+	v.vehicles = next
+
+	if len(event.Updated) > 0 || len(event.Removed) > 0 {
+		for ch := range v.subscribers {
+			select {
+			case ch <- event:
+			default:
+				// The subscriber fell behind; closing its channel ends the
+				// stream so the client reconnects and gets a fresh snapshot.
+				close(ch)
+				delete(v.subscribers, ch)
+			}
+		}
+	}
+	v.mu.Unlock()
+}
+
+// ResetStatic drops the cached trips and routes before the next update,
+// for when another feed version becomes active.
+func (v *Vehicles) ResetStatic() {
+	v.stale.Store(true)
+}
+
+// join fills in headsign and route details, loading trips and routes that
+// are not cached yet.
+func (v *Vehicles) join(vehicles map[string]models.Vehicle) {
+	if v.stale.Swap(false) {
+		v.trips = make(map[string]models.Trip)
+		v.routes = make(map[string]models.Route)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+
+	var missingTrips []string
+	for _, veh := range vehicles {
+		if _, ok := v.trips[veh.TripID]; veh.TripID != "" && !ok {
+			missingTrips = append(missingTrips, veh.TripID)
+		}
+	}
+	if len(missingTrips) > 0 {
+		trips, err := v.lookup.GetTripsByID(ctx, missingTrips)
+		if err != nil {
+			v.logger.Printf("realtime: loading trips for vehicles: %v", err)
+		}
+		for _, t := range trips {
+			v.trips[t.TripID] = t
+		}
+	}
+
+	var missingRoutes []string
+	for id, veh := range vehicles {
+		if t, ok := v.trips[veh.TripID]; ok {
+			veh.Headsign = t.TripHeadsign
+			if veh.RouteID == "" {
+				veh.RouteID = t.RouteID
+			}
+			vehicles[id] = veh
+		}
+		if _, ok := v.routes[veh.RouteID]; veh.RouteID != "" && !ok {
+			missingRoutes = append(missingRoutes, veh.RouteID)
+		}
+	}
+	if len(missingRoutes) > 0 {
+		routes, err := v.lookup.GetRoutesByID(ctx, missingRoutes)
+		if err != nil {
+			v.logger.Printf("realtime: loading routes for vehicles: %v", err)
+		}
+		for _, r := range routes {
+			v.routes[r.RouteID] = r
+		}
+	}
+
+	for id, veh := range vehicles {
+		if r, ok := v.routes[veh.RouteID]; ok {
+			veh.RouteShortName = r.RouteShortName
+			veh.RouteColor = r.RouteColor
+			veh.RouteTextColor = r.RouteTextColor
+			veh.RouteType = r.RouteType
+			vehicles[id] = veh
+		}
+	}
+}
+
+// All returns the current vehicles.
+func (v *Vehicles) All() []models.Vehicle {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	out := make([]models.Vehicle, 0, len(v.vehicles))
+	for _, veh := range v.vehicles {
+		out = append(out, veh)
+	}
+	return out
+}
+
+// Subscribe returns the current vehicles and a channel receiving every
+// later change. The channel is closed if the subscriber falls behind;
+// cancel must be called once the subscriber is done.
+func (v *Vehicles) Subscribe() (snapshot []models.Vehicle, events <-chan VehicleEvent, cancel func()) {
+	ch := make(chan VehicleEvent, 8)
+
+	v.mu.Lock()
+	snapshot = make([]models.Vehicle, 0, len(v.vehicles))
+	for _, veh := range v.vehicles {
+		snapshot = append(snapshot, veh)
+	}
+	v.subscribers[ch] = struct{}{}
+	v.mu.Unlock()
+
+	cancel = func() {
+		v.mu.Lock()
+		if _, ok := v.subscribers[ch]; ok {
+			delete(v.subscribers, ch)
+			close(ch)
+		}
+		v.mu.Unlock()
+	}
+	return snapshot, ch, cancel
+}
@@ -0,0 +1,199 @@
+package realtime
+
+import (
+	"context"
+	"io"
+	"log"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	gtfsrt "github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/Hajdudev/ecoDatabase/models"
+)
+
+// fakeLookup serves one trip and two routes and counts the lookups.
+type fakeLookup struct {
+	tripLookups, routeLookups atomic.Int32
+}
+
+func (l *fakeLookup) GetTripsByID(ctx context.Context, ids []string) ([]models.Trip, error) {
+	l.tripLookups.Add(1)
+	var out []models.Trip
+	for _, id := range ids {
+		if id == "T1" {
+			out = append(out, models.Trip{TripID: "T1", RouteID: "R1", TripHeadsign: "Market"})
+		}
+	}
+	return out, nil
+}
+
+func (l *fakeLookup) GetRoutesByID(ctx context.Context, ids []string) ([]models.Route, error) {
+	l.routeLookups.Add(1)
+	routes := map[string]models.Route{
+		"R1": {RouteID: "R1", RouteShortName: "1", RouteColor: "FF0000", RouteTextColor: "FFFFFF", RouteType: 3},
+		"R2": {RouteID: "R2", RouteShortName: "2", RouteColor: "00FF00", RouteType: 0},
+	}
+	var out []models.Route
+	for _, id := range ids {
+		if r, ok := routes[id]; ok {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+func vehicleEntity(id, tripID, routeID string, lat, lon float32) *gtfsrt.FeedEntity {
+	vp := &gtfsrt.VehiclePosition{
+		Vehicle:  &gtfsrt.VehicleDescriptor{Id: proto.String(id)},
+		Position: &gtfsrt.Position{Latitude: proto.Float32(lat), Longitude: proto.Float32(lon)},
+	}
+	if tripID != "" || routeID != "" {
+		vp.Trip = &gtfsrt.TripDescriptor{}
+		if tripID != "" {
+			vp.Trip.TripId = proto.String(tripID)
+		}
+		if routeID != "" {
+			vp.Trip.RouteId = proto.String(routeID)
+		}
+	}
+	return &gtfsrt.FeedEntity{Id: proto.String(id), Vehicle: vp}
+}
+
+func newTestVehicles(lookup TripRouteLookup) *Vehicles {
+	return NewVehicles(lookup, log.New(io.Discard, "", 0))
+}
+
+// applyFeed writes entities to a feed file and applies it, as the poller
+// does.
+func applyFeed(t *testing.T, v *Vehicles, entities ...*gtfsrt.FeedEntity) {
+	t.Helper()
+	v.Apply(readFeed(t, writeFeed(t, "", entities...)))
+}
+
+func TestVehiclesApplyEvents(t *testing.T) {
+	v := newTestVehicles(&fakeLookup{})
+	_, events, cancel := v.Subscribe()
+	defer cancel()
+
+	tests := []struct {
+		name     string
+		entities []*gtfsrt.FeedEntity
+		updated  []string
+		removed  []string
+	}{
+		{
+			name:     "added",
+			entities: []*gtfsrt.FeedEntity{vehicleEntity("V1", "", "", 48.1, 17.1), vehicleEntity("V2", "", "", 48.2, 17.2)},
+			updated:  []string{"V1", "V2"},
+		},
+		{
+			name:     "moved",
+			entities: []*gtfsrt.FeedEntity{vehicleEntity("V1", "", "", 48.15, 17.1), vehicleEntity("V2", "", "", 48.2, 17.2)},
+			updated:  []string{"V1"},
+		},
+		{
+			name:     "removed",
+			entities: []*gtfsrt.FeedEntity{vehicleEntity("V1", "", "", 48.15, 17.1)},
+			removed:  []string{"V2"},
+		},
+		{
+			name:     "unchanged",
+			entities: []*gtfsrt.FeedEntity{vehicleEntity("V1", "", "", 48.15, 17.1)},
+		},
+	}
+	for _, tc := range tests {
+		applyFeed(t, v, tc.entities...)
+
+		var updated, removed []string
+		select {
+		case event := <-events:
+			for _, veh := range event.Updated {
+				updated = append(updated, veh.VehicleID)
+			}
+			slices.Sort(updated)
+			removed = event.Removed
+		default:
+		}
+		if !slices.Equal(updated, tc.updated) || !slices.Equal(removed, tc.removed) {
+			t.Errorf("%s: updated %v removed %v, want %v and %v", tc.name, updated, removed, tc.updated, tc.removed)
+		}
+	}
+}
+
+func TestVehiclesJoin(t *testing.T) {
+	lookup := &fakeLookup{}
+	v := newTestVehicles(lookup)
+	entities := []*gtfsrt.FeedEntity{
+		// Route from the trip.
+		vehicleEntity("V1", "T1", "", 48.1, 17.1),
+		// Route given by the feed.
+		vehicleEntity("V2", "", "R2", 48.1, 17.1),
+		// Unknown trip: the feed's data stays as it is.
+		vehicleEntity("V3", "NOPE", "", 48.1, 17.1),
+	}
+	applyFeed(t, v, entities...)
+
+	byID := make(map[string]models.Vehicle)
+	for _, veh := range v.All() {
+		byID[veh.VehicleID] = veh
+	}
+	if v1 := byID["V1"]; v1.RouteID != "R1" || v1.Headsign != "Market" || v1.RouteShortName != "1" ||
+		v1.RouteColor != "FF0000" || v1.RouteTextColor != "FFFFFF" || v1.RouteType != 3 {
+		t.Errorf("V1 joined as %+v", v1)
+	}
+	if v2 := byID["V2"]; v2.RouteShortName != "2" || v2.Headsign != "" {
+		t.Errorf("V2 joined as %+v", v2)
+	}
+	if v3 := byID["V3"]; v3.RouteID != "" || v3.RouteShortName != "" {
+		t.Errorf("V3 joined as %+v", v3)
+	}
+
+	// Known trips and routes come from the cache on the next update,
+	// until ResetStatic drops it.
+	trips, routes := lookup.tripLookups.Load(), lookup.routeLookups.Load()
+	applyFeed(t, v, entities[:2]...)
+	if lookup.tripLookups.Load() != trips || lookup.routeLookups.Load() != routes {
+		t.Error("cached trips or routes were looked up again")
+	}
+	v.ResetStatic()
+	applyFeed(t, v, entities[:2]...)
+	if lookup.tripLookups.Load() != trips+1 || lookup.routeLookups.Load() != routes+1 {
+		t.Error("ResetStatic did not drop the cached trips and routes")
+	}
+}
+
+func TestVehiclesSlowSubscriber(t *testing.T) {
+	v := newTestVehicles(&fakeLookup{})
+	_, slow, cancelSlow := v.Subscribe()
+	defer cancelSlow()
+	_, fast, cancelFast := v.Subscribe()
+	defer cancelFast()
+
+	// The slow subscriber never reads; once its buffer is full the next
+	// update closes it instead of blocking Apply, while the subscriber
+	// that keeps up gets every update.
+	const updates = 20
+	for i := range updates {
+		applyFeed(t, v, vehicleEntity("V1", "", "", 48+float32(i)/100, 17))
+		select {
+		case _, ok := <-fast:
+			if !ok {
+				t.Fatalf("the reading subscriber was closed after %d updates", i)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("update %d did not reach the reading subscriber", i)
+		}
+	}
+
+	buffered := 0
+	for range slow {
+		buffered++
+	}
+	if buffered == 0 || buffered >= updates {
+		t.Errorf("the slow subscriber got %d updates before being closed", buffered)
+	}
+}
@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"github.com/Hajdudev/ecoDatabase/internal/api"
 	"github.com/Hajdudev/ecoDatabase/internal/app"
 	"github.com/go-chi/chi/v5"
 )
@@ -9,7 +10,38 @@ func SetupRoutes(app *app.Application) *chi.Mux {
 	r := chi.NewRouter()
 
 	r.Get("/health", app.HealthCheck)
-	r.Get("/find/route", app.DatabaseHandler.FindRoute)
-	r.Get("/names", app.DatabaseHandler.StopNames)
+	// Every route reading the feed sees a single feed version for the
+	// whole request, the active one unless ?feed_version= asks for
+	// another.
+	r.Group(func(r chi.Router) {
+		r.Use(api.FeedVersion(app.Database, app.ActiveVersion))
+		r.Get("/stops/search", app.DatabaseHandler.SearchStops)
+		r.Get("/stops/nearby", app.DatabaseHandler.NearbyStops)
+		r.Get("/vehicles", app.DatabaseHandler.Vehicles)
+		r.Get("/vehicles/stream", app.DatabaseHandler.VehicleStream)
+		r.Get("/alerts", app.DatabaseHandler.Alerts)
+		r.Get("/tiles/{z}/{x}/{y}.mvt", app.DatabaseHandler.Tile)
+		r.Get("/find/route", app.DatabaseHandler.FindRoute)
+		r.Get("/names", app.DatabaseHandler.StopNames)
+		r.Get("/stops/{id}/departures", app.DatabaseHandler.StopDepartures)
+		r.Get("/trips/{trip_id}", app.DatabaseHandler.TripDetail)
+		r.Get("/trips/{trip_id}/shape", app.DatabaseHandler.TripShape)
+		r.Get("/routes", app.DatabaseHandler.Routes)
+		r.Get("/routes/{id}", app.DatabaseHandler.RouteDetail)
+		r.Get("/routes/{id}/timetable", app.DatabaseHandler.RouteTimetable)
+	})
+
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(api.RequireAdmin(app.AdminToken))
+		r.Get("/alerts", app.DatabaseHandler.ManualAlerts)
+		r.Post("/alerts", app.DatabaseHandler.CreateAlert)
+		r.Put("/alerts/{id}", app.DatabaseHandler.UpdateAlert)
+		r.Delete("/alerts/{id}", app.DatabaseHandler.DeleteAlert)
+		r.Get("/cache", api.CacheStats(app.Cache))
+		r.Get("/feeds", api.FeedVersions(app.Database))
+		r.Post("/feeds/{id}/activate", api.ActivateFeedVersion(app.Database, app.FeedChanged))
+		r.Post("/feeds/rollback", api.RollbackFeedVersion(app.Database, app.FeedChanged))
+		r.Delete("/feeds/{id}", api.DeleteFeedVersion(app.Database))
+	})
 	return r
 }
@@ -0,0 +1,106 @@
+package schedule
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/Hajdudev/ecoDatabase/models"
+)
+
+// MergeStopSequences merges the stop patterns of a direction into one
+// list. It starts from the first pattern and inserts each stop the others
+// add after the stop they visit before it, so short turns and branches
+// keep their position along the line.
+func MergeStopSequences(sequences [][]string) []string {
+	if len(sequences) == 0 {
+		return nil
+	}
+	merged := append([]string(nil), sequences[0]...)
+	for _, seq := range sequences[1:] {
+		insertAt := 0
+		for _, id := range seq {
+			// Prefer a visit after the previous stop, which keeps loops
+			// that pass a stop twice in order.
+			i := indexFrom(merged, id, insertAt)
+			if i < 0 {
+				i = indexFrom(merged, id, 0)
+			}
+			if i >= 0 {
+				insertAt = i + 1
+				continue
+			}
+			merged = slices.Insert(merged, insertAt, id)
+			insertAt++
+		}
+	}
+	return merged
+}
+
+func indexFrom(list []string, id string, from int) int {
+	if i := slices.Index(list[from:], id); i >= 0 {
+		return from + i
+	}
+	return -1
+}
+
+// Directions groups trips by direction_id. Only the StopID of the
+// returned stops is set. stopTimes must be ordered by trip and
+// stop_sequence.
+func Directions(trips []models.Trip, stopTimes []models.StopTime) []models.RouteDirection {
+	patterns := make(map[string][]string)
+	for start := 0; start < len(stopTimes); {
+		end := start
+		for end < len(stopTimes) && stopTimes[end].TripID == stopTimes[start].TripID {
+			end++
+		}
+		for _, st := range stopTimes[start:end] {
+			patterns[st.TripID] = append(patterns[st.TripID], st.StopID)
+		}
+		start = end
+	}
+
+	type direction struct {
+		trips     int
+		headsigns map[string]int
+		patterns  map[string]int
+		stops     map[string][]string
+	}
+	byID := make(map[int]*direction)
+	for _, t := range trips {
+		d, ok := byID[t.DirectionID]
+		if !ok {
+			d = &direction{headsigns: make(map[string]int), patterns: make(map[string]int), stops: make(map[string][]string)}
+			byID[t.DirectionID] = d
+		}
+		d.trips++
+		if t.TripHeadsign != "" {
+			d.headsigns[t.TripHeadsign]++
+		}
+		if stops := patterns[t.TripID]; len(stops) > 0 {
+			key := strings.Join(stops, "\x00")
+			d.patterns[key]++
+			d.stops[key] = stops
+		}
+	}
+
+	out := make([]models.RouteDirection, 0, len(byID))
+	for id, d := range byID {
+		rd := models.RouteDirection{
+			DirectionID: id,
+			Headsigns:   byCount(d.headsigns),
+			TripCount:   d.trips,
+			Stops:       []models.Stop{},
+		}
+		var sequences [][]string
+		for _, key := range byCount(d.patterns) {
+			sequences = append(sequences, d.stops[key])
+		}
+		for _, id := range MergeStopSequences(sequences) {
+			rd.Stops = append(rd.Stops, models.Stop{StopID: id})
+		}
+		out = append(out, rd)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].DirectionID < out[j].DirectionID })
+	return out
+}
@@ -0,0 +1,282 @@
+// Package schedule lays out route timetables as printable grids.
+package schedule
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/Hajdudev/ecoDatabase/internal/gtfs"
+	"github.com/Hajdudev/ecoDatabase/models"
+)
+
+// column is a trip with the grid row of each of its stop times.
+type column struct {
+	trip      models.Trip
+	stopTimes []models.StopTime
+	rows      []int
+	seconds   []int
+	pattern   string
+}
+
+// BuildGrids lays out trips as one grid per direction_id. Trips visiting
+// the same stops share one pattern; the stops of all patterns are merged
+// into the rows, and every pattern that passes a row without calling there
+// gets a footnote. stopTimes must be ordered by trip and stop_sequence.
+func BuildGrids(trips []models.Trip, stopTimes []models.StopTime, stops map[string]models.Stop) []models.TimetableGrid {
+	byTrip := make(map[string][]models.StopTime)
+	for start := 0; start < len(stopTimes); {
+		end := start
+		for end < len(stopTimes) && stopTimes[end].TripID == stopTimes[start].TripID {
+			end++
+		}
+		byTrip[stopTimes[start].TripID] = stopTimes[start:end]
+		start = end
+	}
+
+	directions := make(map[int][]models.Trip)
+	for _, t := range trips {
+		if len(byTrip[t.TripID]) > 0 {
+			directions[t.DirectionID] = append(directions[t.DirectionID], t)
+		}
+	}
+
+	grids := make([]models.TimetableGrid, 0, len(directions))
+	for id, dirTrips := range directions {
+		grids = append(grids, buildGrid(id, dirTrips, byTrip, stops))
+	}
+	sort.Slice(grids, func(i, j int) bool { return grids[i].DirectionID < grids[j].DirectionID })
+	return grids
+}
+
+func buildGrid(directionID int, trips []models.Trip, byTrip map[string][]models.StopTime, stops map[string]models.Stop) models.TimetableGrid {
+	grid := models.TimetableGrid{DirectionID: directionID}
+
+	patternCount := make(map[string]int)
+	patternStops := make(map[string][]string)
+	headsigns := make(map[string]int)
+	columns := make([]*column, len(trips))
+	for i, t := range trips {
+		c := &column{trip: t, stopTimes: byTrip[t.TripID]}
+		ids := make([]string, len(c.stopTimes))
+		for j, st := range c.stopTimes {
+			ids[j] = st.StopID
+		}
+		c.pattern = strings.Join(ids, "\x00")
+		patternCount[c.pattern]++
+		patternStops[c.pattern] = ids
+		if t.TripHeadsign != "" {
+			headsigns[t.TripHeadsign]++
+		}
+		columns[i] = c
+	}
+
+	patterns := byCount(patternCount)
+	sequences := make([][]string, len(patterns))
+	for i, p := range patterns {
+		sequences[i] = patternStops[p]
+	}
+	rows := MergeStopSequences(sequences)
+	for _, id := range rows {
+		s := stops[id]
+		grid.Stops = append(grid.Stops, models.TimetableStop{StopID: id, StopName: s.StopName, PlatformCode: s.PlatformCode})
+	}
+	if h := byCount(headsigns); len(h) > 0 {
+		grid.Headsign = h[0]
+	}
+
+	patternRows := make(map[string][]int)
+	for _, p := range patterns {
+		patternRows[p] = align(rows, patternStops[p])
+	}
+	for _, c := range columns {
+		c.rows = patternRows[c.pattern]
+		for _, st := range c.stopTimes {
+			t, err := gtfs.ParseTime(st.DepartureTime)
+			if err != nil {
+				t = -1
+			}
+			c.seconds = append(c.seconds, t)
+		}
+	}
+	sortColumns(columns, patternRows[patterns[0]][0])
+
+	footnotes := make(map[string]string)
+	for _, c := range columns {
+		tt := models.TimetableTrip{
+			TripID:    c.trip.TripID,
+			Headsign:  c.trip.TripHeadsign,
+			Footnotes: []string{},
+			Times:     make([]string, len(rows)),
+		}
+		for j, st := range c.stopTimes {
+			t := st.DepartureTime
+			if j == len(c.stopTimes)-1 {
+				t = st.ArrivalTime
+			}
+			tt.Times[c.rows[j]] = clock(t)
+		}
+
+		if text := skippedText(grid.Stops, c.rows); text != "" {
+			symbol, ok := footnotes[text]
+			if !ok {
+				symbol = footnoteSymbol(len(footnotes))
+				footnotes[text] = symbol
+				grid.Footnotes = append(grid.Footnotes, models.TimetableFootnote{Symbol: symbol, Text: text})
+			}
+			tt.Footnotes = append(tt.Footnotes, symbol)
+		}
+		grid.Trips = append(grid.Trips, tt)
+	}
+	if grid.Footnotes == nil {
+		grid.Footnotes = []models.TimetableFootnote{}
+	}
+	return grid
+}
+
+// align returns the row of each stop of a pattern, following the rows in
+// order so a stop visited twice lands on the right row.
+func align(rows []string, pattern []string) []int {
+	out := make([]int, len(pattern))
+	next := 0
+	for i, id := range pattern {
+		r := slices.Index(rows[next:], id)
+		if r >= 0 {
+			r += next
+		} else {
+			r = slices.Index(rows, id)
+		}
+		out[i] = r
+		next = r + 1
+	}
+	return out
+}
+
+// sortColumns orders columns by their time at row ref, then by trip_id.
+// A column that does not call at ref is placed by the time at its first
+// row, moved back by the usual running time from ref to that row.
+func sortColumns(columns []*column, ref int) {
+	sort.Slice(columns, func(i, j int) bool { return columns[i].trip.TripID < columns[j].trip.TripID })
+	offsets := rowOffsets(columns, ref)
+	keys := make(map[*column]int, len(columns))
+	for _, c := range columns {
+		keys[c], _ = c.key(offsets)
+	}
+	sort.SliceStable(columns, func(i, j int) bool { return keys[columns[i]] < keys[columns[j]] })
+}
+
+// rowOffsets estimates the running time from row ref to every row called
+// at by a timed stop, as the median over the columns that also call at a
+// row whose offset is already known. Columns sharing no row with the
+// others are placed from the first row of the first such column.
+func rowOffsets(columns []*column, ref int) map[int]int {
+	offsets := map[int]int{ref: 0}
+	for {
+		samples := make(map[int][]int)
+		unplaced := -1
+		for _, c := range columns {
+			base, ok := c.key(offsets)
+			if !ok {
+				if unplaced < 0 {
+					unplaced = c.firstTimed()
+					if unplaced >= 0 {
+						unplaced = c.rows[unplaced]
+					}
+				}
+				continue
+			}
+			for i, r := range c.rows {
+				if _, known := offsets[r]; !known && c.seconds[i] >= 0 {
+					samples[r] = append(samples[r], c.seconds[i]-base)
+				}
+			}
+		}
+		if len(samples) == 0 {
+			if unplaced < 0 {
+				return offsets
+			}
+			offsets[unplaced] = 0
+			continue
+		}
+		for r, s := range samples {
+			slices.Sort(s)
+			offsets[r] = s[len(s)/2]
+		}
+	}
+}
+
+// key returns the time of c at the reference row of offsets, taken from
+// its first timed stop at a row with a known offset.
+func (c *column) key(offsets map[int]int) (int, bool) {
+	for i, r := range c.rows {
+		if off, ok := offsets[r]; ok && c.seconds[i] >= 0 {
+			return c.seconds[i] - off, true
+		}
+	}
+	if i := c.firstTimed(); i >= 0 {
+		return c.seconds[i], false
+	}
+	return 0, false
+}
+
+// firstTimed returns the index of the first stop time of c with a time,
+// or -1.
+func (c *column) firstTimed() int {
+	return slices.IndexFunc(c.seconds, func(t int) bool { return t >= 0 })
+}
+
+// skippedText describes the rows between the first and the last stop of a
+// trip that it does not call at.
+func skippedText(stops []models.TimetableStop, rows []int) string {
+	served := make(map[int]bool, len(rows))
+	first, last := rows[0], rows[0]
+	for _, r := range rows {
+		served[r] = true
+		first, last = min(first, r), max(last, r)
+	}
+
+	var names []string
+	for r := first + 1; r < last; r++ {
+		if !served[r] {
+			names = append(names, stops[r].StopName)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	return "Does not stop at " + strings.Join(names, ", ")
+}
+
+// footnoteSymbol returns a, b, ..., z, aa, ab, ...
+func footnoteSymbol(n int) string {
+	if n < 26 {
+		return string(rune('a' + n))
+	}
+	return footnoteSymbol(n/26-1) + footnoteSymbol(n%26)
+}
+
+// clock formats a GTFS time as HH:MM on a 24 hour clock.
+func clock(t string) string {
+	seconds, err := gtfs.ParseTime(t)
+	if err != nil {
+		return t
+	}
+	seconds %= gtfs.SecondsPerDay
+	return fmt.Sprintf("%02d:%02d", seconds/3600, seconds%3600/60)
+}
+
+// byCount returns the keys of counts, the highest count first.
+func byCount(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
@@ -0,0 +1,145 @@
+package schedule
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/Hajdudev/ecoDatabase/models"
+)
+
+// trip returns a trip with one stop time per pair of stop id and time.
+func trip(id string, stopsAndTimes ...string) (models.Trip, []models.StopTime) {
+	var sts []models.StopTime
+	for i := 0; i < len(stopsAndTimes); i += 2 {
+		t := stopsAndTimes[i+1]
+		sts = append(sts, models.StopTime{
+			TripID:        id,
+			StopID:        stopsAndTimes[i],
+			StopSequence:  i / 2,
+			ArrivalTime:   t,
+			DepartureTime: t,
+		})
+	}
+	return models.Trip{TripID: id}, sts
+}
+
+func TestBuildGridsOrder(t *testing.T) {
+	stops := map[string]models.Stop{
+		"A": {StopID: "A", StopName: "A"},
+		"B": {StopID: "B", StopName: "B"},
+		"C": {StopID: "C", StopName: "C"},
+		"D": {StopID: "D", StopName: "D"},
+	}
+	type input struct {
+		id    string
+		times []string
+	}
+	tests := []struct {
+		name  string
+		trips []input
+		want  []string
+		rows  []string
+	}{
+		{
+			name: "same pattern",
+			trips: []input{
+				{"T2", []string{"A", "09:00:00", "B", "09:10:00"}},
+				{"T1", []string{"A", "08:00:00", "B", "08:10:00"}},
+			},
+			want: []string{"T1", "T2"},
+			rows: []string{"A", "B"},
+		},
+		{
+			name: "equal times by trip id",
+			trips: []input{
+				{"b", []string{"A", "08:00:00", "B", "08:10:00"}},
+				{"a", []string{"A", "08:00:00", "B", "08:12:00"}},
+			},
+			want: []string{"a", "b"},
+			rows: []string{"A", "B"},
+		},
+		{
+			// Y shares no stop with X; it is placed by the running time
+			// from A to C of the full trips.
+			name: "short turns without a common stop",
+			trips: []input{
+				{"X", []string{"A", "08:00:00", "B", "08:10:00"}},
+				{"Y", []string{"C", "08:05:00", "D", "08:15:00"}},
+				{"Z1", []string{"A", "07:50:00", "B", "08:00:00", "C", "08:10:00", "D", "08:20:00"}},
+				{"Z2", []string{"A", "08:20:00", "B", "08:30:00", "C", "08:40:00", "D", "08:50:00"}},
+			},
+			want: []string{"Y", "Z1", "X", "Z2"},
+			rows: []string{"A", "B", "C", "D"},
+		},
+		{
+			name: "untimed first row",
+			trips: []input{
+				{"P", []string{"A", "08:00:00", "B", "", "C", "08:20:00"}},
+				{"Q", []string{"B", "07:55:00", "C", "08:05:00"}},
+				{"R", []string{"A", "07:30:00", "B", "07:40:00", "C", "07:50:00"}},
+			},
+			want: []string{"R", "Q", "P"},
+			rows: []string{"A", "B", "C"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// The order must not depend on the order of the input.
+			for _, reversed := range []bool{false, true} {
+				in := slices.Clone(tc.trips)
+				if reversed {
+					slices.Reverse(in)
+				}
+				var trips []models.Trip
+				var stopTimes []models.StopTime
+				for _, tr := range in {
+					tp, sts := trip(tr.id, tr.times...)
+					trips = append(trips, tp)
+					stopTimes = append(stopTimes, sts...)
+				}
+
+				grids := BuildGrids(trips, stopTimes, stops)
+				if len(grids) != 1 {
+					t.Fatalf("got %d grids, want 1", len(grids))
+				}
+				var got, rows []string
+				for _, tt := range grids[0].Trips {
+					got = append(got, tt.TripID)
+				}
+				for _, s := range grids[0].Stops {
+					rows = append(rows, s.StopID)
+				}
+				if !slices.Equal(got, tc.want) {
+					t.Errorf("reversed=%v: trips %v, want %v", reversed, got, tc.want)
+				}
+				if !slices.Equal(rows, tc.rows) {
+					t.Errorf("reversed=%v: rows %v, want %v", reversed, rows, tc.rows)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildGridsFootnotes(t *testing.T) {
+	stops := map[string]models.Stop{
+		"A": {StopID: "A", StopName: "Alpha"},
+		"B": {StopID: "B", StopName: "Beta"},
+		"C": {StopID: "C", StopName: "Gamma"},
+	}
+	t1, st1 := trip("T1", "A", "08:00:00", "B", "08:10:00", "C", "08:20:00")
+	t2, st2 := trip("T2", "A", "09:00:00", "C", "25:15:00")
+	grids := BuildGrids([]models.Trip{t1, t2}, append(st1, st2...), stops)
+
+	g := grids[0]
+	if len(g.Footnotes) != 1 || g.Footnotes[0].Text != "Does not stop at Beta" {
+		t.Fatalf("footnotes = %+v", g.Footnotes)
+	}
+	express := g.Trips[1]
+	if !slices.Equal(express.Footnotes, []string{"a"}) {
+		t.Errorf("T2 footnotes = %v, want [a]", express.Footnotes)
+	}
+	if want := []string{"09:00", "", "01:15"}; !slices.Equal(express.Times, want) {
+		t.Errorf("T2 times = %v, want %v", express.Times, want)
+	}
+}
@@ -0,0 +1,65 @@
+package schedule
+
+import (
+	"html/template"
+	"io"
+
+	"github.com/Hajdudev/ecoDatabase/models"
+)
+
+// page renders a RouteTimetable as a standalone page that prints one
+// direction per sheet.
+var page = template.Must(template.New("timetable").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{with .Route}}{{or .RouteShortName .RouteLongName}}{{end}} timetable {{.Date}}</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; font-size: 11px; margin: 16px; color: #111; }
+h1 { font-size: 20px; margin: 0 0 4px; }
+h1 .badge { display: inline-block; padding: 2px 8px; border-radius: 4px; margin-right: 8px; }
+h2 { font-size: 14px; margin: 24px 0 8px; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #bbb; padding: 2px 4px; text-align: center; white-space: nowrap; }
+th.stop { text-align: left; font-weight: normal; }
+tbody tr:nth-child(even) { background: #f3f3f3; }
+td.empty { color: #999; }
+.notes { margin-top: 8px; }
+section { page-break-after: always; }
+section:last-child { page-break-after: auto; }
+@media print { body { margin: 0; } }
+</style>
+</head>
+<body>
+{{$route := .Route}}
+<h1><span class="badge" style="background:#{{or $route.RouteColor "dddddd"}};color:#{{or $route.RouteTextColor "000000"}}">{{$route.RouteShortName}}</span>{{$route.RouteLongName}}</h1>
+<div>Timetable for {{.Date}}</div>
+{{range .Grids}}
+<section>
+<h2>Direction {{.DirectionID}}{{with .Headsign}}: {{.}}{{end}}</h2>
+{{if .Trips}}
+{{$trips := .Trips}}
+<table>
+<thead>
+<tr><th class="stop">Stop</th>{{range $trips}}<th>{{range .Footnotes}}{{.}}{{end}}</th>{{end}}</tr>
+</thead>
+<tbody>
+{{range $i, $stop := .Stops}}
+<tr><th class="stop">{{$stop.StopName}}{{with $stop.PlatformCode}} ({{.}}){{end}}</th>{{range $trips}}{{with index .Times $i}}<td>{{.}}</td>{{else}}<td class="empty">|</td>{{end}}{{end}}</tr>
+{{end}}
+</tbody>
+</table>
+{{with .Footnotes}}<div class="notes">{{range .}}<div><b>{{.Symbol}}</b> {{.Text}}</div>{{end}}</div>{{end}}
+{{else}}
+<p>No trips on this date.</p>
+{{end}}
+</section>
+{{end}}
+</body>
+</html>
+`))
+
+// RenderHTML writes tt as a printable HTML page.
+func RenderHTML(w io.Writer, tt models.RouteTimetable) error {
+	return page.Execute(w, tt)
+}
@@ -0,0 +1,195 @@
+package search
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Hajdudev/ecoDatabase/internal/gtfs"
+	"github.com/Hajdudev/ecoDatabase/models"
+)
+
+// Match scores, from best to worst. Popularity adds at most
+// popularityWeight on top, so it only reorders matches of similar quality.
+const (
+	scoreExact       = 1.0
+	scorePrefix      = 0.9
+	scoreWordPrefix  = 0.8
+	scoreSubstring   = 0.7
+	scoreTypo        = 0.6
+	scoreTrigram     = 0.5
+	minTrigram       = 0.3
+	popularityWeight = 0.2
+)
+
+// Index answers autocomplete queries over stop names. Stops sharing a
+// name are merged into one entry, the way /names lists them.
+type Index struct {
+	entries       []entry
+	maxDepartures int
+}
+
+type entry struct {
+	name       string
+	normalized string
+	words      [][]rune
+	trigrams   map[string]bool
+	stopIDs    []string
+	lat, lon   float64
+	hasStation bool
+	departures int
+}
+
+// NewIndex builds an index over stops. departures holds the number of
+// stop_times per stop_id and is used to rank busy stops first.
+func NewIndex(stops []models.Stop, departures map[string]int) *Index {
+	byName := make(map[string]*entry)
+	var order []string
+	for _, s := range stops {
+		if s.LocationType != gtfs.LocationStop && s.LocationType != gtfs.LocationStation {
+			continue
+		}
+		e, ok := byName[s.StopName]
+		if !ok {
+			normalized := Normalize(s.StopName)
+			e = &entry{
+				name:       s.StopName,
+				normalized: normalized,
+				trigrams:   trigrams(normalized),
+				lat:        s.StopLat,
+				lon:        s.StopLon,
+			}
+			for _, w := range strings.Fields(normalized) {
+				e.words = append(e.words, []rune(w))
+			}
+			byName[s.StopName] = e
+			order = append(order, s.StopName)
+		}
+		// A station's coordinates describe the whole group better than
+		// those of any one platform.
+		if s.LocationType == gtfs.LocationStation && !e.hasStation {
+			e.lat, e.lon, e.hasStation = s.StopLat, s.StopLon, true
+		}
+		e.stopIDs = append(e.stopIDs, s.StopID)
+		e.departures += departures[s.StopID]
+	}
+
+	idx := &Index{entries: make([]entry, 0, len(order))}
+	for _, name := range order {
+		e := byName[name]
+		idx.entries = append(idx.entries, *e)
+		idx.maxDepartures = max(idx.maxDepartures, e.departures)
+	}
+	return idx
+}
+
+// Search returns the entries matching q ordered by rank, skipping the
+// first offset and returning at most limit, plus the total number of
+// matches.
+func (idx *Index) Search(q string, limit, offset int) ([]models.StopSearchResult, int) {
+	query := Normalize(q)
+	if query == "" {
+		return nil, 0
+	}
+	queryRunes := []rune(query)
+	queryTrigrams := trigrams(query)
+
+	type hit struct {
+		entry *entry
+		score float64
+	}
+	var hits []hit
+	for i := range idx.entries {
+		e := &idx.entries[i]
+		quality := matchQuality(e, query, queryRunes, queryTrigrams)
+		if quality == 0 {
+			continue
+		}
+		hits = append(hits, hit{entry: e, score: quality + idx.popularity(e)})
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].score != hits[j].score {
+			return hits[i].score > hits[j].score
+		}
+		return hits[i].entry.name < hits[j].entry.name
+	})
+
+	total := len(hits)
+	if offset >= total {
+		return []models.StopSearchResult{}, total
+	}
+	hits = hits[offset:min(offset+limit, total)]
+
+	results := make([]models.StopSearchResult, len(hits))
+	for i, h := range hits {
+		results[i] = models.StopSearchResult{
+			Marker: models.Marker{
+				Name: h.entry.name,
+				Lat:  strconv.FormatFloat(h.entry.lat, 'f', -1, 64),
+				Lon:  strconv.FormatFloat(h.entry.lon, 'f', -1, 64),
+			},
+			StopIDs:    h.entry.stopIDs,
+			Departures: h.entry.departures,
+			Score:      math.Round(h.score*1000) / 1000,
+		}
+	}
+	return results, total
+}
+
+func (idx *Index) popularity(e *entry) float64 {
+	if idx.maxDepartures == 0 {
+		return 0
+	}
+	return popularityWeight * math.Log1p(float64(e.departures)) / math.Log1p(float64(idx.maxDepartures))
+}
+
+func matchQuality(e *entry, query string, queryRunes []rune, queryTrigrams map[string]bool) float64 {
+	switch {
+	case e.normalized == query:
+		return scoreExact
+	case strings.HasPrefix(e.normalized, query):
+		return scorePrefix
+	}
+	for _, w := range e.words {
+		if strings.HasPrefix(string(w), query) {
+			return scoreWordPrefix
+		}
+	}
+	if strings.Contains(e.normalized, query) {
+		return scoreSubstring
+	}
+
+	// Typos: compare the query with the start of each word, allowing one
+	// edit for short queries and two for longer ones. Prefixes one letter
+	// shorter or longer catch dropped and doubled letters.
+	if allowed := typoBudget(len(queryRunes)); allowed > 0 {
+		for _, w := range e.words {
+			for n := len(queryRunes) - 1; n <= len(queryRunes)+1; n++ {
+				if n > len(w) {
+					break
+				}
+				if editDistance(queryRunes, w[:n]) <= allowed {
+					return scoreTypo
+				}
+			}
+		}
+	}
+
+	if sim := similarity(queryTrigrams, e.trigrams); sim >= minTrigram {
+		return scoreTrigram * sim
+	}
+	return 0
+}
+
+func typoBudget(n int) int {
+	switch {
+	case n >= 8:
+		return 2
+	case n >= 4:
+		return 1
+	default:
+		return 0
+	}
+}
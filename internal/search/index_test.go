@@ -0,0 +1,138 @@
+package search
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/Hajdudev/ecoDatabase/models"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := map[string]string{
+		"Námestie  SNP":      "namestie snp",
+		"Hlavná stanica (1)": "hlavna stanica 1",
+		"  Špitálska-ulica ": "spitalska ulica",
+		"ŽST Petržalka":      "zst petrzalka",
+		"":                   "",
+	}
+	for in, want := range tests {
+		if got := Normalize(in); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"kitten", "sitting", 3},
+		{"stanica", "stnaica", 2},
+		{"most", "most", 0},
+	}
+	for _, tc := range tests {
+		if got := editDistance([]rune(tc.a), []rune(tc.b)); got != tc.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func testIndex() *Index {
+	stops := []models.Stop{
+		{StopID: "1", StopName: "Most SNP"},
+		{StopID: "2", StopName: "Mostová"},
+		{StopID: "3", StopName: "Nový most"},
+		{StopID: "4", StopName: "Hlavná stanica"},
+		{StopID: "5", StopName: "Autobusová stanica"},
+		{StopID: "6", StopName: "Námestie SNP"},
+		// Platforms of one station share its name and merge with it.
+		{StopID: "7", StopName: "Trnavské mýto", LocationType: 1, StopLat: 48.15, StopLon: 17.13},
+		{StopID: "7a", StopName: "Trnavské mýto", StopLat: 48.151, StopLon: 17.131},
+		{StopID: "7b", StopName: "Trnavské mýto", StopLat: 48.149, StopLon: 17.129},
+		// Entrances are not searchable.
+		{StopID: "8", StopName: "Most SNP vchod", LocationType: 2},
+	}
+	departures := map[string]int{"1": 10, "2": 10, "3": 10, "4": 500, "5": 20, "6": 5, "7a": 100, "7b": 100}
+	return NewIndex(stops, departures)
+}
+
+func names(results []models.StopSearchResult) []string {
+	var out []string
+	for _, r := range results {
+		out = append(out, r.Name)
+	}
+	return out
+}
+
+func TestSearchRanking(t *testing.T) {
+	idx := testIndex()
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		// Exact before prefix before word prefix.
+		{"most snp", []string{"Most SNP"}},
+		{"most", []string{"Most SNP", "Mostová", "Nový most"}},
+		// Diacritics and case do not matter.
+		{"MOSTOVA", []string{"Mostová"}},
+		// Equal match quality: the busier stop goes first.
+		{"stanica", []string{"Hlavná stanica", "Autobusová stanica"}},
+		// A typo still finds the stop.
+		{"hlavan", []string{"Hlavná stanica"}},
+		{"trnavske myto", []string{"Trnavské mýto"}},
+	}
+	for _, tc := range tests {
+		// Weaker fuzzy matches may follow; only the ranking of the
+		// expected ones is checked.
+		results, _ := idx.Search(tc.query, 10, 0)
+		got := names(results)
+		if len(got) > len(tc.want) {
+			got = got[:len(tc.want)]
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("Search(%q) = %q, want %q first", tc.query, names(results), tc.want)
+		}
+	}
+}
+
+func TestSearchNoMatch(t *testing.T) {
+	if results, total := testIndex().Search("xyz", 10, 0); len(results) != 0 || total != 0 {
+		t.Errorf("got %q, total %d", names(results), total)
+	}
+}
+
+func TestSearchMergesStation(t *testing.T) {
+	results, _ := testIndex().Search("trnavske", 10, 0)
+	if len(results) != 1 {
+		t.Fatalf("got %d results, want 1", len(results))
+	}
+	r := results[0]
+	if !slices.Equal(r.StopIDs, []string{"7", "7a", "7b"}) {
+		t.Errorf("stop ids %v", r.StopIDs)
+	}
+	if r.Departures != 200 {
+		t.Errorf("departures %d, want 200", r.Departures)
+	}
+	// The station's position stands for the group.
+	if r.Lat != "48.15" || r.Lon != "17.13" {
+		t.Errorf("position %s,%s, want the station's", r.Lat, r.Lon)
+	}
+}
+
+func TestSearchPaging(t *testing.T) {
+	idx := testIndex()
+	all, total := idx.Search("most", 10, 0)
+	page, pageTotal := idx.Search("most", 1, 1)
+	if total != pageTotal {
+		t.Errorf("total %d, paged total %d", total, pageTotal)
+	}
+	if len(page) != 1 || page[0].Name != all[1].Name {
+		t.Errorf("page %q, want [%q]", names(page), all[1].Name)
+	}
+	if rest, _ := idx.Search("most", 10, total); len(rest) != 0 {
+		t.Errorf("offset past the end gave %q", names(rest))
+	}
+}
@@ -0,0 +1,84 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/Hajdudev/ecoDatabase/models"
+)
+
+// ManualAlerts returns the stored manual alerts ordered by id.
+func (pg *PostgresStore) ManualAlerts(ctx context.Context) ([]models.Alert, error) {
+	rows, err := pg.db.Query(ctx, `SELECT alert FROM manual_alerts ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var alerts []models.Alert
+	for rows.Next() {
+		var raw []byte
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		var alert models.Alert
+		if err := json.Unmarshal(raw, &alert); err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts, rows.Err()
+}
+
+// PutManualAlert stores alert, replacing the alert with the same id.
+func (pg *PostgresStore) PutManualAlert(ctx context.Context, alert models.Alert) error {
+	raw, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	_, err = pg.db.Exec(ctx, `
+		INSERT INTO manual_alerts (id, alert) VALUES ($1, $2)
+		ON CONFLICT (id) DO UPDATE SET alert = excluded.alert, updated_at = now()`, alert.ID, raw)
+	return err
+}
+
+// DeleteManualAlert removes the alert id and reports whether it existed.
+func (pg *PostgresStore) DeleteManualAlert(ctx context.Context, id string) (bool, error) {
+	tag, err := pg.db.Exec(ctx, `DELETE FROM manual_alerts WHERE id = $1`, id)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (s *SQLiteStore) ManualAlerts(ctx context.Context) ([]models.Alert, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT alert FROM manual_alerts ORDER BY id`)
+	return collect(rows, err, func(rows *sql.Rows, alert *models.Alert) error {
+		var raw string
+		if err := rows.Scan(&raw); err != nil {
+			return err
+		}
+		return json.Unmarshal([]byte(raw), alert)
+	})
+}
+
+func (s *SQLiteStore) PutManualAlert(ctx context.Context, alert models.Alert) error {
+	raw, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO manual_alerts (id, alert) VALUES (?, ?)
+		ON CONFLICT (id) DO UPDATE SET alert = excluded.alert, updated_at = CURRENT_TIMESTAMP`, alert.ID, string(raw))
+	return err
+}
+
+func (s *SQLiteStore) DeleteManualAlert(ctx context.Context, id string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM manual_alerts WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,48 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Hajdudev/ecoDatabase/models"
+)
+
+func TestManualAlerts(t *testing.T) {
+	ctx := context.Background()
+	db := migratedSQLite(t)
+
+	alert := models.Alert{
+		ID:               "a1",
+		Source:           "manual",
+		InformedEntities: []models.AlertEntity{{StopID: "A1"}},
+		HeaderText:       []models.LocalizedText{{Text: "Closed"}},
+	}
+	if err := db.PutManualAlert(ctx, alert); err != nil {
+		t.Fatal(err)
+	}
+	alert.HeaderText[0].Text = "Closed until noon"
+	if err := db.PutManualAlert(ctx, alert); err != nil {
+		t.Fatal(err)
+	}
+
+	alerts, err := db.ManualAlerts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 1 || alerts[0].HeaderText[0].Text != "Closed until noon" || alerts[0].InformedEntities[0].StopID != "A1" {
+		t.Fatalf("ManualAlerts = %+v", alerts)
+	}
+
+	for _, want := range []bool{true, false} {
+		found, err := db.DeleteManualAlert(ctx, "a1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != want {
+			t.Errorf("DeleteManualAlert found = %v, want %v", found, want)
+		}
+	}
+	if alerts, err := db.ManualAlerts(ctx); err != nil || len(alerts) != 0 {
+		t.Errorf("after delete: %d alerts, err %v", len(alerts), err)
+	}
+}
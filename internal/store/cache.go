@@ -0,0 +1,334 @@
+package store
+
+import (
+	"container/list"
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Hajdudev/ecoDatabase/internal/gtfs"
+	"github.com/Hajdudev/ecoDatabase/models"
+	"golang.org/x/sync/singleflight"
+)
+
+// CacheOptions configures a CachedStore.
+type CacheOptions struct {
+	// Size bounds the number of cached results.
+	Size int
+	// TTL is how long results are kept per DatabaseStore method. Methods
+	// without an entry are never cached.
+	TTL map[string]time.Duration
+}
+
+// DefaultCacheOptions caches the lookups the handlers repeat on every
+// request. The bulk loads behind the planner and the tiles are left out,
+// since their callers keep what they build from them.
+var DefaultCacheOptions = CacheOptions{
+	Size: 10000,
+	TTL: map[string]time.Duration{
+		"GetStopsNames":          time.Hour,
+		"GetAllStops":            time.Hour,
+		"GetAllRoutes":           time.Hour,
+		"GetStopDepartureCounts": time.Hour,
+		"GetShapeRoutes":         time.Hour,
+		"GetStopInfo":            10 * time.Minute,
+		"ResolveStops":           10 * time.Minute,
+		"GetActiveServices":      10 * time.Minute,
+		"GetServiceCalendar":     10 * time.Minute,
+		"GetTripsByID":           10 * time.Minute,
+		"GetRoutesByID":          10 * time.Minute,
+		"GetStopsByID":           10 * time.Minute,
+		"GetStopTimesByTrip":     10 * time.Minute,
+		"GetStopTimesByTrips":    10 * time.Minute,
+		"GetShape":               10 * time.Minute,
+		"GetTripsByRoute":        10 * time.Minute,
+		"GetStopTimesByRoute":    10 * time.Minute,
+	},
+}
+
+// CachedStore wraps a DatabaseStore with a size-bounded LRU cache of
+// results. Identical calls running at the same time share one query, and
+// every cached result is dropped when Invalidate is called, which the
+// server does when WatchFeed sees another feed version activated. Results
+// for a version named with gtfs.WithFeedVersion are kept apart from those
+// for the active version.
+//
+// Cached slices and maps are shared between callers, which must treat them
+// as read-only.
+type CachedStore struct {
+	inner DatabaseStore
+	opts  CacheOptions
+	group singleflight.Group
+
+	mu         sync.Mutex
+	entries    map[string]*list.Element
+	lru        *list.List // of *cacheEntry, most recently used first
+	generation uint64
+
+	stats map[string]*methodStats
+}
+
+var _ DatabaseStore = (*CachedStore)(nil)
+
+type cacheEntry struct {
+	key     string
+	value   any
+	expires time.Time
+}
+
+type methodStats struct {
+	hits, misses atomic.Uint64
+}
+
+// CacheStats are the hit and miss counts of one method.
+type CacheStats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+}
+
+func NewCachedStore(inner DatabaseStore, opts CacheOptions) *CachedStore {
+	c := &CachedStore{
+		inner:   inner,
+		opts:    opts,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		stats:   make(map[string]*methodStats),
+	}
+	for method := range opts.TTL {
+		c.stats[method] = &methodStats{}
+	}
+	return c
+}
+
+// Stats returns the hit and miss counts per cached method.
+func (c *CachedStore) Stats() map[string]CacheStats {
+	stats := make(map[string]CacheStats, len(c.stats))
+	for method, s := range c.stats {
+		stats[method] = CacheStats{Hits: s.hits.Load(), Misses: s.misses.Load()}
+	}
+	return stats
+}
+
+// Len returns the number of cached results, including expired ones that
+// have not been evicted yet.
+func (c *CachedStore) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Invalidate drops every cached result. Queries already running when it is
+// called still return to their callers but are not cached.
+func (c *CachedStore) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.generation++
+}
+
+// cached returns the result of load for method and args, from the cache
+// when possible. A load shared by several callers runs detached from
+// their contexts, so one caller going away does not fail the others; each
+// caller still stops waiting when its own ctx is done.
+func cached[T any](c *CachedStore, ctx context.Context, method string, args []string, load func(context.Context) (T, error)) (T, error) {
+	ttl, ok := c.opts.TTL[method]
+	if !ok || ttl <= 0 || c.opts.Size <= 0 {
+		return load(ctx)
+	}
+	stats := c.stats[method]
+
+	var version string
+	if v, ok := gtfs.FeedVersion(ctx); ok {
+		version = strconv.Itoa(v)
+	}
+	key := version + "\x00" + method + "\x00" + strings.Join(args, "\x00")
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*cacheEntry)
+		if time.Now().Before(entry.expires) {
+			c.lru.MoveToFront(el)
+			c.mu.Unlock()
+			stats.hits.Add(1)
+			return entry.value.(T), nil
+		}
+		c.lru.Remove(el)
+		delete(c.entries, key)
+	}
+	generation := c.generation
+	c.mu.Unlock()
+	stats.misses.Add(1)
+
+	// The generation is part of the flight key so that a call made after
+	// Invalidate never joins a query started before it.
+	flight := c.group.DoChan(strconv.FormatUint(generation, 10)+"\x00"+key, func() (any, error) {
+		value, err := load(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, err
+		}
+		c.put(key, value, ttl, generation)
+		return value, nil
+	})
+
+	var zero T
+	select {
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	case res := <-flight:
+		if res.Err != nil {
+			return zero, res.Err
+		}
+		return res.Val.(T), nil
+	}
+}
+
+func (c *CachedStore) put(key string, value any, ttl time.Duration, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+
+	entry := &cacheEntry{key: key, value: value, expires: time.Now().Add(ttl)}
+	if el, ok := c.entries[key]; ok {
+		el.Value = entry
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.opts.Size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (c *CachedStore) GetUserByID(ctx context.Context, id string) (*models.User, error) {
+	return cached(c, ctx, "GetUserByID", []string{id}, func(ctx context.Context) (*models.User, error) {
+		return c.inner.GetUserByID(ctx, id)
+	})
+}
+
+func (c *CachedStore) GetStopInfo(ctx context.Context, stopID string) (*models.Stop, error) {
+	return cached(c, ctx, "GetStopInfo", []string{stopID}, func(ctx context.Context) (*models.Stop, error) {
+		return c.inner.GetStopInfo(ctx, stopID)
+	})
+}
+
+func (c *CachedStore) ResolveStops(ctx context.Context, key string) ([]models.Stop, error) {
+	return cached(c, ctx, "ResolveStops", []string{key}, func(ctx context.Context) ([]models.Stop, error) {
+		return c.inner.ResolveStops(ctx, key)
+	})
+}
+
+func (c *CachedStore) GetActiveServices(ctx context.Context, date string) ([]string, error) {
+	return cached(c, ctx, "GetActiveServices", []string{date}, func(ctx context.Context) ([]string, error) {
+		return c.inner.GetActiveServices(ctx, date)
+	})
+}
+
+type serviceCalendar struct {
+	calendars  []models.Calendar
+	exceptions []models.CalendarDate
+}
+
+func (c *CachedStore) GetServiceCalendar(ctx context.Context, serviceID string) ([]models.Calendar, []models.CalendarDate, error) {
+	sc, err := cached(c, ctx, "GetServiceCalendar", []string{serviceID}, func(ctx context.Context) (serviceCalendar, error) {
+		calendars, exceptions, err := c.inner.GetServiceCalendar(ctx, serviceID)
+		return serviceCalendar{calendars, exceptions}, err
+	})
+	return sc.calendars, sc.exceptions, err
+}
+
+func (c *CachedStore) GetStopsNames(ctx context.Context) ([]models.Marker, error) {
+	return cached(c, ctx, "GetStopsNames", nil, c.inner.GetStopsNames)
+}
+
+func (c *CachedStore) GetAllStops(ctx context.Context) ([]models.Stop, error) {
+	return cached(c, ctx, "GetAllStops", nil, c.inner.GetAllStops)
+}
+
+func (c *CachedStore) GetStopDepartureCounts(ctx context.Context) (map[string]int, error) {
+	return cached(c, ctx, "GetStopDepartureCounts", nil, c.inner.GetStopDepartureCounts)
+}
+
+func (c *CachedStore) GetTripsByService(ctx context.Context, serviceIDs []string) ([]models.Trip, error) {
+	return cached(c, ctx, "GetTripsByService", serviceIDs, func(ctx context.Context) ([]models.Trip, error) {
+		return c.inner.GetTripsByService(ctx, serviceIDs)
+	})
+}
+
+func (c *CachedStore) GetStopTimesByService(ctx context.Context, serviceIDs []string) ([]models.StopTime, error) {
+	return cached(c, ctx, "GetStopTimesByService", serviceIDs, func(ctx context.Context) ([]models.StopTime, error) {
+		return c.inner.GetStopTimesByService(ctx, serviceIDs)
+	})
+}
+
+func (c *CachedStore) GetStopTimesAfterMidnight(ctx context.Context, serviceIDs []string) ([]models.StopTime, error) {
+	return cached(c, ctx, "GetStopTimesAfterMidnight", serviceIDs, func(ctx context.Context) ([]models.StopTime, error) {
+		return c.inner.GetStopTimesAfterMidnight(ctx, serviceIDs)
+	})
+}
+
+func (c *CachedStore) GetTripsByID(ctx context.Context, ids []string) ([]models.Trip, error) {
+	return cached(c, ctx, "GetTripsByID", ids, func(ctx context.Context) ([]models.Trip, error) {
+		return c.inner.GetTripsByID(ctx, ids)
+	})
+}
+
+func (c *CachedStore) GetRoutesByID(ctx context.Context, ids []string) ([]models.Route, error) {
+	return cached(c, ctx, "GetRoutesByID", ids, func(ctx context.Context) ([]models.Route, error) {
+		return c.inner.GetRoutesByID(ctx, ids)
+	})
+}
+
+func (c *CachedStore) GetStopsByID(ctx context.Context, ids []string) ([]models.Stop, error) {
+	return cached(c, ctx, "GetStopsByID", ids, func(ctx context.Context) ([]models.Stop, error) {
+		return c.inner.GetStopsByID(ctx, ids)
+	})
+}
+
+func (c *CachedStore) GetStopTimesByTrip(ctx context.Context, tripID string) ([]models.StopTime, error) {
+	return cached(c, ctx, "GetStopTimesByTrip", []string{tripID}, func(ctx context.Context) ([]models.StopTime, error) {
+		return c.inner.GetStopTimesByTrip(ctx, tripID)
+	})
+}
+
+func (c *CachedStore) GetStopTimesByTrips(ctx context.Context, tripIDs []string) ([]models.StopTime, error) {
+	return cached(c, ctx, "GetStopTimesByTrips", tripIDs, func(ctx context.Context) ([]models.StopTime, error) {
+		return c.inner.GetStopTimesByTrips(ctx, tripIDs)
+	})
+}
+
+func (c *CachedStore) GetShape(ctx context.Context, shapeID string) ([]models.Shape, error) {
+	return cached(c, ctx, "GetShape", []string{shapeID}, func(ctx context.Context) ([]models.Shape, error) {
+		return c.inner.GetShape(ctx, shapeID)
+	})
+}
+
+func (c *CachedStore) GetAllRoutes(ctx context.Context) ([]models.Route, error) {
+	return cached(c, ctx, "GetAllRoutes", nil, c.inner.GetAllRoutes)
+}
+
+func (c *CachedStore) GetAllShapes(ctx context.Context) ([]models.Shape, error) {
+	return cached(c, ctx, "GetAllShapes", nil, c.inner.GetAllShapes)
+}
+
+func (c *CachedStore) GetShapeRoutes(ctx context.Context) (map[string][]string, error) {
+	return cached(c, ctx, "GetShapeRoutes", nil, c.inner.GetShapeRoutes)
+}
+
+func (c *CachedStore) GetTripsByRoute(ctx context.Context, routeID string) ([]models.Trip, error) {
+	return cached(c, ctx, "GetTripsByRoute", []string{routeID}, func(ctx context.Context) ([]models.Trip, error) {
+		return c.inner.GetTripsByRoute(ctx, routeID)
+	})
+}
+
+func (c *CachedStore) GetStopTimesByRoute(ctx context.Context, routeID string) ([]models.StopTime, error) {
+	return cached(c, ctx, "GetStopTimesByRoute", []string{routeID}, func(ctx context.Context) ([]models.StopTime, error) {
+		return c.inner.GetStopTimesByRoute(ctx, routeID)
+	})
+}
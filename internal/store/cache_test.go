@@ -0,0 +1,247 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Hajdudev/ecoDatabase/internal/gtfs"
+	"github.com/Hajdudev/ecoDatabase/models"
+)
+
+// countingStore counts the GetStopInfo and GetAllShapes calls reaching it.
+// When block is set, GetStopInfo signals started and waits for block to
+// be closed.
+type countingStore struct {
+	DatabaseStore
+
+	calls   atomic.Int32
+	err     error
+	started chan struct{}
+	block   chan struct{}
+}
+
+func (s *countingStore) GetStopInfo(ctx context.Context, stopID string) (*models.Stop, error) {
+	s.calls.Add(1)
+	if s.block != nil {
+		s.started <- struct{}{}
+		select {
+		case <-s.block:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	v, _ := gtfs.FeedVersion(ctx)
+	return &models.Stop{StopID: stopID, StopName: stopID, LocationType: v}, nil
+}
+
+func (s *countingStore) GetAllShapes(ctx context.Context) ([]models.Shape, error) {
+	s.calls.Add(1)
+	return nil, nil
+}
+
+func newBlockingStore() *countingStore {
+	return &countingStore{started: make(chan struct{}, 16), block: make(chan struct{})}
+}
+
+func testCacheOptions() CacheOptions {
+	return CacheOptions{Size: 10, TTL: map[string]time.Duration{"GetStopInfo": time.Hour}}
+}
+
+func TestCachedStoreHits(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingStore{}
+	c := NewCachedStore(inner, testCacheOptions())
+
+	for _, id := range []string{"A", "A", "B", "A"} {
+		s, err := c.GetStopInfo(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.StopID != id {
+			t.Fatalf("GetStopInfo(%q) returned %q", id, s.StopID)
+		}
+	}
+	if n := inner.calls.Load(); n != 2 {
+		t.Errorf("%d calls reached the store, want 2", n)
+	}
+	if got := c.Stats()["GetStopInfo"]; got != (CacheStats{Hits: 2, Misses: 2}) {
+		t.Errorf("stats %+v, want 2 hits and 2 misses", got)
+	}
+
+	// Methods without a TTL are passed through.
+	for range 2 {
+		if _, err := c.GetAllShapes(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := inner.calls.Load(); n != 4 {
+		t.Errorf("%d calls reached the store, want 4", n)
+	}
+}
+
+func TestCachedStoreErrorsNotCached(t *testing.T) {
+	inner := &countingStore{err: errors.New("boom")}
+	c := NewCachedStore(inner, testCacheOptions())
+	for range 2 {
+		if _, err := c.GetStopInfo(context.Background(), "A"); !errors.Is(err, inner.err) {
+			t.Fatalf("got %v, want the store's error", err)
+		}
+	}
+	if n := inner.calls.Load(); n != 2 {
+		t.Errorf("%d calls reached the store, want 2", n)
+	}
+	if c.Len() != 0 {
+		t.Errorf("%d results cached", c.Len())
+	}
+}
+
+func TestCachedStoreExpiry(t *testing.T) {
+	inner := &countingStore{}
+	opts := testCacheOptions()
+	opts.TTL["GetStopInfo"] = 10 * time.Millisecond
+	c := NewCachedStore(inner, opts)
+
+	c.GetStopInfo(context.Background(), "A")
+	time.Sleep(20 * time.Millisecond)
+	c.GetStopInfo(context.Background(), "A")
+	if n := inner.calls.Load(); n != 2 {
+		t.Errorf("%d calls reached the store, want 2", n)
+	}
+}
+
+func TestCachedStoreEviction(t *testing.T) {
+	inner := &countingStore{}
+	opts := testCacheOptions()
+	opts.Size = 2
+	c := NewCachedStore(inner, opts)
+
+	// A is used again before C is added, so B is the one evicted.
+	for _, id := range []string{"A", "B", "A", "C"} {
+		c.GetStopInfo(context.Background(), id)
+	}
+	if c.Len() != 2 {
+		t.Errorf("%d results cached, want 2", c.Len())
+	}
+	c.GetStopInfo(context.Background(), "A")
+	if n := inner.calls.Load(); n != 3 {
+		t.Errorf("A was evicted: %d calls, want 3", n)
+	}
+	c.GetStopInfo(context.Background(), "B")
+	if n := inner.calls.Load(); n != 4 {
+		t.Errorf("B was kept: %d calls, want 4", n)
+	}
+}
+
+func TestCachedStorePerFeedVersion(t *testing.T) {
+	inner := &countingStore{}
+	c := NewCachedStore(inner, testCacheOptions())
+	for _, version := range []int{1, 2, 1, 2} {
+		s, err := c.GetStopInfo(gtfs.WithFeedVersion(context.Background(), version), "A")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.LocationType != version {
+			t.Errorf("version %d got the result of version %d", version, s.LocationType)
+		}
+	}
+	if n := inner.calls.Load(); n != 2 {
+		t.Errorf("%d calls reached the store, want one per version", n)
+	}
+}
+
+func TestCachedStoreInvalidate(t *testing.T) {
+	ctx := context.Background()
+	inner := newBlockingStore()
+	c := NewCachedStore(inner, testCacheOptions())
+
+	// A query running while the cache is invalidated still returns, but
+	// its result is not cached.
+	done := make(chan error)
+	go func() {
+		_, err := c.GetStopInfo(ctx, "A")
+		done <- err
+	}()
+	<-inner.started
+	c.Invalidate()
+	close(inner.block)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if c.Len() != 0 {
+		t.Fatalf("%d results cached across Invalidate", c.Len())
+	}
+
+	c.GetStopInfo(ctx, "A")
+	c.GetStopInfo(ctx, "A")
+	c.Invalidate()
+	c.GetStopInfo(ctx, "A")
+	if n := inner.calls.Load(); n != 3 {
+		t.Errorf("%d calls reached the store, want 3", n)
+	}
+}
+
+func TestCachedStoreSharesQueries(t *testing.T) {
+	inner := newBlockingStore()
+	c := NewCachedStore(inner, testCacheOptions())
+
+	const callers = 8
+	var wg sync.WaitGroup
+	errs := make([]error, callers)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = c.GetStopInfo(context.Background(), "A")
+		}()
+	}
+	<-inner.started
+	close(inner.block)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := inner.calls.Load(); n != 1 {
+		t.Errorf("%d calls reached the store, want 1", n)
+	}
+}
+
+func TestCachedStoreCancelledCaller(t *testing.T) {
+	inner := newBlockingStore()
+	c := NewCachedStore(inner, testCacheOptions())
+
+	// The caller that starts the query gives up, but the query goes on and
+	// its result is cached for the next caller.
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := c.GetStopInfo(ctx, "A")
+		done <- err
+	}()
+	<-inner.started
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	close(inner.block)
+
+	s, err := c.GetStopInfo(context.Background(), "A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.StopID != "A" {
+		t.Errorf("got stop %q", s.StopID)
+	}
+	if n := inner.calls.Load(); n != 1 {
+		t.Errorf("%d calls reached the store, want 1", n)
+	}
+}
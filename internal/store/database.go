@@ -3,24 +3,69 @@ package store
 import (
 	"context"
 	"fmt"
+	"log"
 	"os"
+	"strings"
 
+	"github.com/Hajdudev/ecoDatabase/internal/gtfs"
+	"github.com/Hajdudev/ecoDatabase/models"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
 )
 
-func Open() (*pgxpool.Pool, error) {
+// Database is a DatabaseStore backed by a database that GTFS feeds are
+// imported into, each as a numbered feed version. Queries read the active
+// version unless the context names another with gtfs.WithFeedVersion.
+type Database interface {
+	DatabaseStore
+	// ImportFeed stores feed as a new, inactive feed version. A feed with
+	// the hash of a stored version is rejected with ErrFeedAlreadyImported.
+	ImportFeed(ctx context.Context, feed *gtfs.Feed, logger *log.Logger) (*models.FeedVersion, error)
+	FeedVersions(ctx context.Context) ([]models.FeedVersion, error)
+	ActivateFeedVersion(ctx context.Context, id int) error
+	// ActiveFeedVersion returns the id of the active version, or 0 when
+	// no version is active.
+	ActiveFeedVersion(ctx context.Context) (int, error)
+	// RollbackFeedVersion activates the version that was active before
+	// the current one and returns its id.
+	RollbackFeedVersion(ctx context.Context) (int, error)
+	DeleteFeedVersion(ctx context.Context, id int) error
+	// FeedStamp returns a value that changes whenever another feed
+	// version is activated.
+	FeedStamp(ctx context.Context) (string, error)
+	ManualAlerts(ctx context.Context) ([]models.Alert, error)
+	PutManualAlert(ctx context.Context, alert models.Alert) error
+	DeleteManualAlert(ctx context.Context, id string) (bool, error)
+	Close()
+}
+
+var (
+	_ Database = (*PostgresStore)(nil)
+	_ Database = (*SQLiteStore)(nil)
+)
+
+// Open connects to DATABASE_URL. Its scheme selects the backend:
+// postgres:// or postgresql:// for Postgres, and sqlite: for a SQLite file,
+// as in sqlite:///var/lib/eco/gtfs.db or sqlite:gtfs.db.
+func Open() (Database, error) {
 	_ = godotenv.Load()
 
 	dbURL := os.Getenv("DATABASE_URL")
 	if dbURL == "" {
 		return nil, fmt.Errorf("DATABASE_URL is not set")
 	}
-	dbpool, err := pgxpool.New(context.Background(), dbURL)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Unable to create connection pool: %v\n", err)
-		os.Exit(1)
-	}
 
-	return dbpool, nil
+	scheme, rest, _ := strings.Cut(dbURL, ":")
+	switch scheme {
+	case "postgres", "postgresql":
+		dbpool, err := pgxpool.New(context.Background(), dbURL)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create connection pool: %w", err)
+		}
+		return NewPostgresStore(dbpool), nil
+	case "sqlite":
+		return OpenSQLite(strings.TrimPrefix(rest, "//"))
+	default:
+		return nil, fmt.Errorf("unsupported DATABASE_URL scheme %q, expected postgres or sqlite", scheme)
+	}
 }
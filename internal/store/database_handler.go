@@ -5,8 +5,9 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/Hajdudev/ecoDatabase/internal/gtfs"
 	"github.com/Hajdudev/ecoDatabase/models"
-	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -22,37 +23,110 @@ func NewPostgresStore(db *pgxpool.Pool) *PostgresStore {
 	return &PostgresStore{db: db}
 }
 
+// Close closes the connection pool.
+func (pg *PostgresStore) Close() {
+	pg.db.Close()
+}
+
 type DatabaseStore interface {
-	GetUserByID(id string) (*models.User, error)
-	GetRoutesById(firstID []string, secondID []string, ch chan<- map[string]models.TripHash) error
-	GetStopInfo(stopID string, ch chan<- models.Stop) error
-	GetStopTimesInfo(firstID []string, secondID []string, date string, ch chan<- []models.TempStop) error
-	GetStopsID(name string, ch chan<- []string) error
-	GetCalendarType(date string, ch chan<- string) error
-	GetStopsNames() ([]models.Marker, error)
+	GetUserByID(ctx context.Context, id string) (*models.User, error)
+	GetStopInfo(ctx context.Context, stopID string) (*models.Stop, error)
+	ResolveStops(ctx context.Context, key string) ([]models.Stop, error)
+	GetActiveServices(ctx context.Context, date string) ([]string, error)
+	GetServiceCalendar(ctx context.Context, serviceID string) ([]models.Calendar, []models.CalendarDate, error)
+	GetStopsNames(ctx context.Context) ([]models.Marker, error)
+	GetAllStops(ctx context.Context) ([]models.Stop, error)
+	GetStopDepartureCounts(ctx context.Context) (map[string]int, error)
+	GetTripsByService(ctx context.Context, serviceIDs []string) ([]models.Trip, error)
+	GetStopTimesByService(ctx context.Context, serviceIDs []string) ([]models.StopTime, error)
+	GetStopTimesAfterMidnight(ctx context.Context, serviceIDs []string) ([]models.StopTime, error)
+	GetTripsByID(ctx context.Context, ids []string) ([]models.Trip, error)
+	GetRoutesByID(ctx context.Context, ids []string) ([]models.Route, error)
+	GetStopsByID(ctx context.Context, ids []string) ([]models.Stop, error)
+	GetStopTimesByTrip(ctx context.Context, tripID string) ([]models.StopTime, error)
+	GetStopTimesByTrips(ctx context.Context, tripIDs []string) ([]models.StopTime, error)
+	GetShape(ctx context.Context, shapeID string) ([]models.Shape, error)
+	GetAllRoutes(ctx context.Context) ([]models.Route, error)
+	GetAllShapes(ctx context.Context) ([]models.Shape, error)
+	GetShapeRoutes(ctx context.Context) (map[string][]string, error)
+	GetTripsByRoute(ctx context.Context, routeID string) ([]models.Trip, error)
+	GetStopTimesByRoute(ctx context.Context, routeID string) ([]models.StopTime, error)
+}
+
+// GetActiveServices returns every service_id running on date, combining the
+// weekly patterns in calendar with the exceptions in calendar_dates.
+func (pg *PostgresStore) GetActiveServices(ctx context.Context, date string) ([]string, error) {
+	day, err := gtfs.ParseDate(date)
+	if err != nil {
+		return nil, err
+	}
+
+	calendarQuery := `
+		SELECT service_id, monday, tuesday, wednesday, thursday, friday, saturday, sunday, start_date, end_date
+		FROM calendar
+		WHERE feed_version = ` + feedVersion + ` AND start_date <= $2 AND end_date >= $2
+	`
+	rows, err := pg.db.Query(ctx, calendarQuery, versionArg(ctx), day)
+	if err != nil {
+		return nil, err
+	}
+	calendars, err := pgx.CollectRows(rows, pgx.RowToStructByName[models.Calendar])
+	if err != nil {
+		return nil, err
+	}
+
+	datesQuery := `SELECT service_id, date, exception_type FROM calendar_dates WHERE feed_version = ` + feedVersion + ` AND date = $2`
+	rows, err = pg.db.Query(ctx, datesQuery, versionArg(ctx), day)
+	if err != nil {
+		return nil, err
+	}
+	exceptions, err := pgx.CollectRows(rows, pgx.RowToStructByName[models.CalendarDate])
+	if err != nil {
+		return nil, err
+	}
+
+	return gtfs.ActiveServices(day, calendars, exceptions), nil
 }
 
-func (pg *PostgresStore) GetCalendarType(date string, ch chan<- string) error {
-	query := `SELECT service_id FROM calendar_dates WHERE date = $1`
-	var serviceID string
-	err := pg.db.QueryRow(context.Background(), query, date).Scan(&serviceID)
+// GetServiceCalendar returns the calendar and calendar_dates rows of one
+// service.
+func (pg *PostgresStore) GetServiceCalendar(ctx context.Context, serviceID string) ([]models.Calendar, []models.CalendarDate, error) {
+	calendarQuery := `
+		SELECT service_id, monday, tuesday, wednesday, thursday, friday, saturday, sunday, start_date, end_date
+		FROM calendar
+		WHERE feed_version = ` + feedVersion + ` AND service_id = $2
+	`
+	rows, err := pg.db.Query(ctx, calendarQuery, versionArg(ctx), serviceID)
+	if err != nil {
+		return nil, nil, err
+	}
+	calendars, err := pgx.CollectRows(rows, pgx.RowToStructByName[models.Calendar])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	datesQuery := `SELECT service_id, date, exception_type FROM calendar_dates WHERE feed_version = ` + feedVersion + ` AND service_id = $2`
+	rows, err = pg.db.Query(ctx, datesQuery, versionArg(ctx), serviceID)
+	if err != nil {
+		return nil, nil, err
+	}
+	exceptions, err := pgx.CollectRows(rows, pgx.RowToStructByName[models.CalendarDate])
 	if err != nil {
-		ch <- ""
-		return err
+		return nil, nil, err
 	}
-	ch <- serviceID
-	return nil
+
+	return calendars, exceptions, nil
 }
 
-func (pg *PostgresStore) GetStopInfo(stopID string, ch chan<- models.Stop) error {
+func (pg *PostgresStore) GetStopInfo(ctx context.Context, stopID string) (*models.Stop, error) {
 	query := `
 		SELECT stop_id, stop_code, stop_name, stop_desc, stop_lat, stop_lon
 		FROM stops
-		WHERE stop_id = $1
+		WHERE feed_version = ` + feedVersion + ` AND stop_id = $2
 	`
 	var stop models.Stop
 
-	err := pg.db.QueryRow(context.Background(), query, stopID).Scan(
+	err := pg.db.QueryRow(ctx, query, versionArg(ctx), stopID).Scan(
 		&stop.StopID,
 		&stop.StopCode,
 		&stop.StopName,
@@ -61,17 +135,15 @@ func (pg *PostgresStore) GetStopInfo(stopID string, ch chan<- models.Stop) error
 		&stop.StopLon,
 	)
 	if err != nil {
-		ch <- models.Stop{}
-		return err
+		return nil, err
 	}
 
-	ch <- stop
-	return nil
+	return &stop, nil
 }
 
-func (pg *PostgresStore) GetStopsNames() ([]models.Marker, error) {
-	query := `SELECT DISTINCT ON (stop_name) stop_name, stop_lat, stop_lon FROM stops`
-	rows, err := pg.db.Query(context.Background(), query)
+func (pg *PostgresStore) GetStopsNames(ctx context.Context) ([]models.Marker, error) {
+	query := `SELECT DISTINCT ON (stop_name) stop_name, stop_lat, stop_lon FROM stops WHERE feed_version = ` + feedVersion
+	rows, err := pg.db.Query(ctx, query, versionArg(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -93,155 +165,41 @@ func (pg *PostgresStore) GetStopsNames() ([]models.Marker, error) {
 	return stops, nil
 }
 
-func (pg *PostgresStore) GetStopTimesInfo(firstID []string, secondID []string, date string, ch chan<- []models.TempStop) error {
+// ResolveStops returns the platforms key refers to. key may be a stop_id,
+// a stop_code, a stop or station name or a parent_station id.
+func (pg *PostgresStore) ResolveStops(ctx context.Context, key string) ([]models.Stop, error) {
 	query := `
-SELECT 
-    t1.trip_id,
-    t1.stop_id AS from_stop_id,
-    t1.departure_time AS from_departure_time,
-    t2.stop_id AS to_stop_id,
-    t2.departure_time AS to_departure_time
-FROM 
-    stop_times t1
-JOIN 
-    stop_times t2 ON t1.trip_id = t2.trip_id
-JOIN 
-    trips tr ON t1.trip_id = tr.trip_id
-WHERE 
-    t1.stop_id = ANY($1)
-    AND t2.stop_id = ANY($2)
-    AND tr.service_id = $3
+		WITH version AS (
+			SELECT ` + feedVersion + ` AS id
+		), matched AS (
+			SELECT stop_id FROM stops
+			WHERE feed_version = (SELECT id FROM version)
+			  AND (stop_id = $2 OR stop_code = $2 OR stop_name = $2)
+		)
+		SELECT ` + stopColumns + `
+		FROM stops
+		WHERE feed_version = (SELECT id FROM version)
+		  AND (stop_id IN (SELECT stop_id FROM matched)
+		   OR parent_station IN (SELECT stop_id FROM matched)
+		   OR parent_station = $2)
 	`
-
-	firstArray := pgtype.Array[string]{
-		Elements: firstID,
-		Dims:     []pgtype.ArrayDimension{{Length: int32(len(firstID)), LowerBound: 1}},
-		Valid:    true,
-	}
-
-	secondArray := pgtype.Array[string]{
-		Elements: secondID,
-		Dims:     []pgtype.ArrayDimension{{Length: int32(len(secondID)), LowerBound: 1}},
-		Valid:    true,
-	}
-
-	rows, err := pg.db.Query(context.Background(), query, &firstArray, &secondArray, date)
-	if err != nil {
-		ch <- nil
-		return err
-	}
-	defer rows.Close()
-
-	var trips []models.TempStop
-	for rows.Next() {
-		var trip models.TempStop
-		if err := rows.Scan(&trip.TripID, &trip.FromStopID, &trip.FromDepartureTime, &trip.ToStopID, &trip.ToDepartureTime); err != nil {
-			ch <- nil
-			return err
-		}
-		trips = append(trips, trip)
-	}
-
-	if err := rows.Err(); err != nil {
-		ch <- nil
-		return err
-	}
-
-	ch <- trips
-	return nil
-}
-
-func (pg *PostgresStore) GetStopsID(name string, ch chan<- []string) error {
-	query := `SELECT stop_id FROM stops WHERE stop_name = $1`
-	rows, err := pg.db.Query(context.Background(), query, name)
+	rows, err := pg.db.Query(ctx, query, versionArg(ctx), key)
 	if err != nil {
-		ch <- nil
-		return err
-	}
-	defer rows.Close()
-
-	var ids []string
-	for rows.Next() {
-		var id string
-		if err := rows.Scan(&id); err != nil {
-			ch <- nil
-			return err
-		}
-		ids = append(ids, id)
-	}
-
-	if err := rows.Err(); err != nil {
-		ch <- nil
-		return err
-	}
-
-	ch <- ids
-	return nil
-}
-
-func (pg *PostgresStore) GetRoutesById(firstID []string, secondID []string, ch chan<- map[string]models.TripHash) error {
-	query := `
-    SELECT trip_id, trip_headsign, service_id
-    FROM trips
-    WHERE trip_id IN (
-        SELECT st1.trip_id
-        FROM stop_times st1
-        JOIN stop_times st2
-          ON st1.trip_id = st2.trip_id
-         AND st1.stop_id = ANY($1)
-         AND st2.stop_id = ANY($2)
-         AND st1.stop_sequence < st2.stop_sequence
-    )
-  `
-
-	firstArray := pgtype.Array[string]{
-		Elements: firstID,
-		Dims:     []pgtype.ArrayDimension{{Length: int32(len(firstID)), LowerBound: 1}},
-		Valid:    true,
-	}
-
-	secondArray := pgtype.Array[string]{
-		Elements: secondID,
-		Dims:     []pgtype.ArrayDimension{{Length: int32(len(secondID)), LowerBound: 1}},
-		Valid:    true,
+		return nil, err
 	}
-
-	rows, err := pg.db.Query(context.Background(), query, &firstArray, &secondArray)
+	candidates, err := pgx.CollectRows(rows, pgx.RowToStructByName[models.Stop])
 	if err != nil {
-		fmt.Printf("Error querying database: %v\n", err)
-		ch <- nil
-		return err
-	}
-	defer rows.Close()
-
-	trips := make(map[string]models.TripHash)
-	for rows.Next() {
-		var tripID string
-		var trip models.TripHash
-		if err := rows.Scan(&tripID, &trip.Headsign, &trip.ServiceID); err != nil {
-			fmt.Printf("Error scanning row: %v\n", err)
-			ch <- nil
-			return err
-		}
-		trips[tripID] = trip
-	}
-
-	if err := rows.Err(); err != nil {
-		fmt.Printf("Error during rows iteration: %v\n", err)
-		ch <- nil
-		return err
+		return nil, err
 	}
-
-	ch <- trips
-	return nil
+	return gtfs.ResolveStops(key, candidates), nil
 }
 
-func (pg *PostgresStore) GetUserByID(id string) (*models.User, error) {
+func (pg *PostgresStore) GetUserByID(ctx context.Context, id string) (*models.User, error) {
 	query := "SELECT id, created_at, email, name, image, recent_rides FROM users WHERE id = $1"
 
 	var user models.User
 	var recentRidesBytes []string
-	err := pg.db.QueryRow(context.Background(), query, id).Scan(
+	err := pg.db.QueryRow(ctx, query, id).Scan(
 		&user.ID,
 		&user.CreatedAt,
 		&user.Email,
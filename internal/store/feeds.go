@@ -0,0 +1,409 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Hajdudev/ecoDatabase/internal/gtfs"
+	"github.com/Hajdudev/ecoDatabase/models"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	// ErrFeedVersionNotFound is returned for a feed version that was never
+	// imported.
+	ErrFeedVersionNotFound = errors.New("feed version not found")
+	// ErrNoPreviousFeedVersion is returned by RollbackFeedVersion when no
+	// earlier activation of another version is left to roll back to.
+	ErrNoPreviousFeedVersion = errors.New("no previously active feed version")
+	// ErrFeedVersionActive is returned by DeleteFeedVersion for the active
+	// version.
+	ErrFeedVersionActive = errors.New("feed version is active")
+	// ErrFeedAlreadyImported is returned by ImportFeed for a feed whose
+	// hash matches a version that is already stored.
+	ErrFeedAlreadyImported = errors.New("feed already imported")
+)
+
+const feedVersionColumns = `id, source, hash, imported_at, start_date, end_date, active, activated_at`
+
+// feedStampQuery identifies the active version and when it was activated,
+// so that activating the same version again still changes the stamp.
+const feedStampQuery = `SELECT id, activated_at FROM feed_versions WHERE active`
+
+func feedStamp(id int, activatedAt *time.Time) string {
+	if activatedAt == nil {
+		return fmt.Sprint(id)
+	}
+	return fmt.Sprintf("%d@%d", id, activatedAt.UnixNano())
+}
+
+// FeedStamp returns the active feed version and its activation time, or
+// an empty string when no version is active.
+func (pg *PostgresStore) FeedStamp(ctx context.Context) (string, error) {
+	var id int
+	var activatedAt *time.Time
+	err := pg.db.QueryRow(ctx, feedStampQuery).Scan(&id, &activatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return feedStamp(id, activatedAt), nil
+}
+
+func (pg *PostgresStore) ActiveFeedVersion(ctx context.Context) (int, error) {
+	var id int
+	err := pg.db.QueryRow(ctx, `SELECT id FROM feed_versions WHERE active`).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	return id, err
+}
+
+func (pg *PostgresStore) FeedVersions(ctx context.Context) ([]models.FeedVersion, error) {
+	rows, err := pg.db.Query(ctx, `SELECT `+feedVersionColumns+` FROM feed_versions ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByName[models.FeedVersion])
+}
+
+// previousActivationQuery finds the activation to roll back to from the
+// current one, $1 with version $2: the latest earlier one of another
+// version that was not rolled back itself.
+const previousActivationQuery = `
+SELECT id, feed_version FROM feed_activations
+WHERE NOT rolled_back AND id < $1 AND feed_version <> $2
+ORDER BY id DESC LIMIT 1`
+
+const currentActivationQuery = `SELECT id, feed_version FROM feed_activations WHERE NOT rolled_back ORDER BY id DESC LIMIT 1`
+
+// ActivateFeedVersion makes version id the one queries read by default.
+// The switch is a single transaction, so readers see either version.
+func (pg *PostgresStore) ActivateFeedVersion(ctx context.Context, id int) error {
+	tx, err := pg.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := pgActivate(ctx, tx, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO feed_activations (feed_version) VALUES ($1)`, id); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (pg *PostgresStore) RollbackFeedVersion(ctx context.Context) (int, error) {
+	tx, err := pg.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var current, version, previous, previousVersion int
+	err = tx.QueryRow(ctx, currentActivationQuery).Scan(&current, &version)
+	if err == nil {
+		err = tx.QueryRow(ctx, previousActivationQuery, current, version).Scan(&previous, &previousVersion)
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrNoPreviousFeedVersion
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE feed_activations SET rolled_back = true WHERE id > $1 AND NOT rolled_back`, previous); err != nil {
+		return 0, err
+	}
+	if err := pgActivate(ctx, tx, previousVersion); err != nil {
+		return 0, err
+	}
+	return previousVersion, tx.Commit(ctx)
+}
+
+// DeleteFeedVersion removes version id and all of its rows. The active
+// version cannot be deleted.
+func (pg *PostgresStore) DeleteFeedVersion(ctx context.Context, id int) error {
+	tx, err := pg.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Keeps the version from being activated while it is deleted.
+	if _, err := tx.Exec(ctx, `LOCK TABLE feed_activations IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return err
+	}
+	var active bool
+	err = tx.QueryRow(ctx, `SELECT active FROM feed_versions WHERE id = $1`, id).Scan(&active)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrFeedVersionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if active {
+		return ErrFeedVersionActive
+	}
+
+	for _, t := range gtfs.Tables {
+		if _, err := tx.Exec(ctx, fmt.Sprintf("DELETE FROM %s WHERE feed_version = $1", t.Name), id); err != nil {
+			return err
+		}
+	}
+	for _, q := range []string{`DELETE FROM feed_activations WHERE feed_version = $1`, `DELETE FROM feed_versions WHERE id = $1`} {
+		if _, err := tx.Exec(ctx, q, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// pgActivate switches the active version to id. It locks
+// feed_activations first, so that concurrent activations and rollbacks
+// run one after the other.
+func pgActivate(ctx context.Context, tx pgx.Tx, id int) error {
+	if _, err := tx.Exec(ctx, `LOCK TABLE feed_activations IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE feed_versions SET active = false WHERE active`); err != nil {
+		return err
+	}
+	tag, err := tx.Exec(ctx, `UPDATE feed_versions SET active = true, activated_at = now() WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrFeedVersionNotFound
+	}
+	return nil
+}
+
+func (s *SQLiteStore) FeedStamp(ctx context.Context) (string, error) {
+	var id int
+	var activatedAt *time.Time
+	err := s.db.QueryRowContext(ctx, feedStampQuery).Scan(&id, sqliteNullTime{&activatedAt})
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return feedStamp(id, activatedAt), nil
+}
+
+func (s *SQLiteStore) ActiveFeedVersion(ctx context.Context) (int, error) {
+	var id int
+	err := s.db.QueryRowContext(ctx, `SELECT id FROM feed_versions WHERE active`).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return id, err
+}
+
+func (s *SQLiteStore) FeedVersions(ctx context.Context) ([]models.FeedVersion, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+feedVersionColumns+` FROM feed_versions ORDER BY id`)
+	return collect(rows, err, func(rows *sql.Rows, v *models.FeedVersion) error {
+		return rows.Scan(&v.ID, &v.Source, &v.Hash, sqliteTime{&v.ImportedAt}, sqliteNullTime{&v.StartDate},
+			sqliteNullTime{&v.EndDate}, &v.Active, sqliteNullTime{&v.ActivatedAt})
+	})
+}
+
+func (s *SQLiteStore) ActivateFeedVersion(ctx context.Context, id int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := sqliteActivate(ctx, tx, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO feed_activations (feed_version) VALUES (?)`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) RollbackFeedVersion(ctx context.Context) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var current, version, previous, previousVersion int
+	err = tx.QueryRowContext(ctx, currentActivationQuery).Scan(&current, &version)
+	if err == nil {
+		err = tx.QueryRowContext(ctx, previousActivationQuery, current, version).Scan(&previous, &previousVersion)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNoPreviousFeedVersion
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE feed_activations SET rolled_back = true WHERE id > ? AND NOT rolled_back`, previous); err != nil {
+		return 0, err
+	}
+	if err := sqliteActivate(ctx, tx, previousVersion); err != nil {
+		return 0, err
+	}
+	return previousVersion, tx.Commit()
+}
+
+func (s *SQLiteStore) DeleteFeedVersion(ctx context.Context, id int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var active bool
+	err = tx.QueryRowContext(ctx, `SELECT active FROM feed_versions WHERE id = ?`, id).Scan(&active)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrFeedVersionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if active {
+		return ErrFeedVersionActive
+	}
+
+	for _, t := range gtfs.Tables {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE feed_version = ?", t.Name), id); err != nil {
+			return err
+		}
+	}
+	for _, q := range []string{`DELETE FROM feed_activations WHERE feed_version = ?`, `DELETE FROM feed_versions WHERE id = ?`} {
+		if _, err := tx.ExecContext(ctx, q, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func sqliteActivate(ctx context.Context, tx *sql.Tx, id int) error {
+	if _, err := tx.ExecContext(ctx, `UPDATE feed_versions SET active = false WHERE active`); err != nil {
+		return err
+	}
+	// CURRENT_TIMESTAMP only has whole seconds, too coarse for FeedStamp.
+	activate := `UPDATE feed_versions SET active = true, activated_at = strftime('%Y-%m-%d %H:%M:%f', 'now') WHERE id = ?`
+	res, err := tx.ExecContext(ctx, activate, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrFeedVersionNotFound
+	}
+	return nil
+}
+
+// RollbackFeedVersion activates the version that was active before the
+// current one and returns it. Rolling back again goes back one more
+// activation, skipping the ones already rolled back.
+func RollbackFeedVersion(ctx context.Context, db Database) (*models.FeedVersion, error) {
+	id, err := db.RollbackFeedVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return FindFeedVersion(ctx, db, id)
+}
+
+// FindFeedVersion returns version id of db.
+func FindFeedVersion(ctx context.Context, db Database, id int) (*models.FeedVersion, error) {
+	versions, err := db.FeedVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range versions {
+		if versions[i].ID == id {
+			return &versions[i], nil
+		}
+	}
+	return nil, ErrFeedVersionNotFound
+}
+
+// ActiveVersion keeps the id of the active feed version in memory, so
+// requests do not each ask the database for it. The server refreshes it
+// whenever it activates a version or WatchFeed sees another process do so.
+type ActiveVersion struct {
+	db Database
+
+	mu sync.Mutex // serialises refreshes
+	id atomic.Int64
+}
+
+func NewActiveVersion(db Database) *ActiveVersion {
+	a := &ActiveVersion{db: db}
+	a.id.Store(-1)
+	return a
+}
+
+// Get returns the id of the active version, or 0 when none is active. It
+// only reads the database while the id is unknown: before the first
+// refresh and after a failed one.
+func (a *ActiveVersion) Get(ctx context.Context) (int, error) {
+	if id := a.id.Load(); id >= 0 {
+		return int(id), nil
+	}
+	return a.Refresh(ctx)
+}
+
+// Refresh reads the active version from the database.
+func (a *ActiveVersion) Refresh(ctx context.Context) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	id, err := a.db.ActiveFeedVersion(ctx)
+	if err != nil {
+		a.id.Store(-1)
+		return 0, err
+	}
+	a.id.Store(int64(id))
+	return id, nil
+}
+
+// WatchFeed calls stamp every interval until ctx is done and calls
+// onChange whenever the returned value changes, which is how a server
+// notices a feed version activated by another process.
+func WatchFeed(ctx context.Context, interval time.Duration, stamp func(context.Context) (string, error), logger *log.Logger, onChange func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last, err := stamp(ctx)
+	if err != nil {
+		logger.Printf("feed: reading feed stamp: %v", err)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current, err := stamp(ctx)
+		if err != nil {
+			logger.Printf("feed: reading feed stamp: %v", err)
+			continue
+		}
+		if current != last {
+			logger.Printf("feed: active feed version changed")
+			onChange()
+			last = current
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Hajdudev/ecoDatabase/internal/gtfs"
+)
+
+// feedInfo returns a feed_info.txt override that makes a feed differ from
+// the fixture, and from other feeds with another version.
+func feedInfo(version string) map[string]string {
+	return map[string]string{
+		"feed_info.txt": "feed_publisher_name,feed_publisher_url,feed_lang,feed_version\nTest,https://example.com,en," + version + "\n",
+	}
+}
+
+// importVersions imports one feed version per name and activates each in
+// turn, so the last one ends up active.
+func importVersions(t *testing.T, db Database, names ...string) []int {
+	t.Helper()
+	ctx := context.Background()
+	var ids []int
+	for _, name := range names {
+		v, err := db.ImportFeed(ctx, testFeed(t, feedInfo(name)), discardLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.ActivateFeedVersion(ctx, v.ID); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, v.ID)
+	}
+	return ids
+}
+
+func activeVersion(t *testing.T, db Database) int {
+	t.Helper()
+	versions, err := db.FeedVersions(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	active := 0
+	for _, v := range versions {
+		if v.Active {
+			if active != 0 {
+				t.Fatalf("versions %d and %d are both active", active, v.ID)
+			}
+			active = v.ID
+		}
+	}
+	return active
+}
+
+func TestRollbackFeedVersion(t *testing.T) {
+	ctx := context.Background()
+	db := migratedSQLite(t)
+	ids := importVersions(t, db, "v1", "v2", "v3")
+
+	// Rolling back twice in a row walks back two activations instead of
+	// swapping between the last two.
+	for _, want := range []int{ids[1], ids[0]} {
+		v, err := RollbackFeedVersion(ctx, db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.ID != want || !v.Active {
+			t.Fatalf("rolled back to %d (active %v), want %d", v.ID, v.Active, want)
+		}
+		if got := activeVersion(t, db); got != want {
+			t.Fatalf("active version %d, want %d", got, want)
+		}
+	}
+	if _, err := RollbackFeedVersion(ctx, db); !errors.Is(err, ErrNoPreviousFeedVersion) {
+		t.Fatalf("rollback past the first activation: %v, want ErrNoPreviousFeedVersion", err)
+	}
+
+	// A new activation after rolling back is rolled back to the version
+	// active before it.
+	if err := db.ActivateFeedVersion(ctx, ids[2]); err != nil {
+		t.Fatal(err)
+	}
+	v, err := RollbackFeedVersion(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.ID != ids[0] {
+		t.Fatalf("rolled back to %d, want %d", v.ID, ids[0])
+	}
+}
+
+func TestRollbackFeedVersionRepeatedActivation(t *testing.T) {
+	ctx := context.Background()
+	db := migratedSQLite(t)
+	ids := importVersions(t, db, "v1", "v2")
+	if err := db.ActivateFeedVersion(ctx, ids[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := RollbackFeedVersion(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.ID != ids[0] {
+		t.Fatalf("rolled back to %d, want %d", v.ID, ids[0])
+	}
+}
+
+func TestImportFeedDuplicate(t *testing.T) {
+	ctx := context.Background()
+	db := migratedSQLite(t)
+	feed := testFeed(t, nil)
+	if _, err := db.ImportFeed(ctx, feed, discardLogger()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ImportFeed(ctx, feed, discardLogger()); !errors.Is(err, ErrFeedAlreadyImported) {
+		t.Fatalf("importing the same feed again: %v, want ErrFeedAlreadyImported", err)
+	}
+	versions, err := db.FeedVersions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 {
+		t.Errorf("%d feed versions, want 1", len(versions))
+	}
+}
+
+func TestImportFeedTripTimes(t *testing.T) {
+	const header = "trip_id,arrival_time,departure_time,stop_id,stop_sequence\n"
+	tests := []struct {
+		name      string
+		stopTimes string
+		err       string
+	}{
+		{
+			name:      "untimed stop between timed ones",
+			stopTimes: header + "T1,8:00:00,8:00:00,A1,1\nT1,,,M,2\nT1,8:10:00,8:10:00,B,3\n",
+		},
+		{
+			name:      "untimed first stop",
+			stopTimes: header + "T4,10:00:00,10:00:00,B,1\nT1,,,A1,1\nT1,8:10:00,8:10:00,B,2\n",
+			err:       "line 3: trip T1 has no time at its first stop",
+		},
+		{
+			name:      "untimed last stop, listed out of order",
+			stopTimes: header + "T1,,,B,3\nT1,8:00:00,8:00:00,A1,1\nT1,8:05:00,,M,2\n",
+			err:       "line 2: trip T1 has no time at its last stop",
+		},
+	}
+	loaders := map[string]func(feed *gtfs.Feed) error{
+		"memory": func(feed *gtfs.Feed) error {
+			_, err := LoadMemoryStore(feed)
+			return err
+		},
+		"sqlite": func(feed *gtfs.Feed) error {
+			_, err := migratedSQLite(t).ImportFeed(context.Background(), feed, discardLogger())
+			return err
+		},
+	}
+	for _, tc := range tests {
+		for name, load := range loaders {
+			err := load(testFeed(t, map[string]string{"stop_times.txt": tc.stopTimes}))
+			switch {
+			case tc.err == "" && err != nil:
+				t.Errorf("%s, %s: %v", tc.name, name, err)
+			case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+				t.Errorf("%s, %s: got %v, want %q", tc.name, name, err, tc.err)
+			}
+		}
+	}
+}
+
+func TestDeleteFeedVersion(t *testing.T) {
+	ctx := context.Background()
+	db := migratedSQLite(t)
+	ids := importVersions(t, db, "v1", "v2")
+
+	if err := db.DeleteFeedVersion(ctx, ids[1]); !errors.Is(err, ErrFeedVersionActive) {
+		t.Fatalf("deleting the active version: %v, want ErrFeedVersionActive", err)
+	}
+	if err := db.DeleteFeedVersion(ctx, ids[1]+1); !errors.Is(err, ErrFeedVersionNotFound) {
+		t.Fatalf("deleting an unknown version: %v, want ErrFeedVersionNotFound", err)
+	}
+	if err := db.DeleteFeedVersion(ctx, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := FindFeedVersion(ctx, db, ids[0]); !errors.Is(err, ErrFeedVersionNotFound) {
+		t.Errorf("deleted version still listed: %v", err)
+	}
+	stops, err := db.GetAllStops(gtfs.WithFeedVersion(ctx, ids[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stops) != 0 {
+		t.Errorf("deleted version still has %d stops", len(stops))
+	}
+	if stops, err := db.GetAllStops(ctx); err != nil || len(stops) == 0 {
+		t.Errorf("active version has %d stops, err %v", len(stops), err)
+	}
+	// With its activation gone, there is nothing left to roll back to.
+	if _, err := RollbackFeedVersion(ctx, db); !errors.Is(err, ErrNoPreviousFeedVersion) {
+		t.Errorf("rollback after deleting the previous version: %v", err)
+	}
+}
+
+func TestActiveVersion(t *testing.T) {
+	ctx := context.Background()
+	db := migratedSQLite(t)
+	active := NewActiveVersion(db)
+	if id, err := active.Get(ctx); err != nil || id != 0 {
+		t.Fatalf("Get without versions = %d, %v", id, err)
+	}
+
+	ids := importVersions(t, db, "v1", "v2")
+	// The id stays in memory until it is refreshed.
+	if id, _ := active.Get(ctx); id != 0 {
+		t.Errorf("Get read the database again: %d", id)
+	}
+	if id, err := active.Refresh(ctx); err != nil || id != ids[1] {
+		t.Errorf("Refresh = %d, %v, want %d", id, err, ids[1])
+	}
+	if id, _ := active.Get(ctx); id != ids[1] {
+		t.Errorf("Get after Refresh = %d, want %d", id, ids[1])
+	}
+
+	// After a failed refresh the next Get reads the database.
+	db.Close()
+	if _, err := active.Refresh(ctx); err == nil {
+		t.Fatal("Refresh on a closed database succeeded")
+	}
+	if _, err := active.Get(ctx); err == nil {
+		t.Error("Get after a failed Refresh served a stale id")
+	}
+}
+
+func TestImportFeedConcurrentDuplicate(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "test.db")
+	if _, err := MigrateUp(ctx, openTestSQLite(t, path)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two servers importing the same feed at once store it only once.
+	const importers = 2
+	errs := make([]error, importers)
+	var wg sync.WaitGroup
+	for i := range importers {
+		db := openTestSQLite(t, path)
+		feed := testFeed(t, nil)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = db.ImportFeed(ctx, feed, discardLogger())
+		}()
+	}
+	wg.Wait()
+
+	imported := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			imported++
+		case !errors.Is(err, ErrFeedAlreadyImported):
+			t.Errorf("import failed: %v", err)
+		}
+	}
+	if imported != 1 {
+		t.Errorf("%d imports succeeded, want 1", imported)
+	}
+}
+
+func TestUniqueFeedHashMigration(t *testing.T) {
+	ctx := context.Background()
+	db := migratedSQLite(t)
+	if _, err := MigrateDown(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	// Duplicates stored before the index existed, and legacy versions
+	// without a hash.
+	for _, hash := range []string{"", "", "abc", "abc", "def"} {
+		if _, err := db.db.ExecContext(ctx, `INSERT INTO feed_versions (hash) VALUES (?)`, hash); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := MigrateUp(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := db.FeedVersions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hashes []string
+	for _, v := range versions {
+		hashes = append(hashes, v.Hash)
+	}
+	slices.Sort(hashes)
+	if want := []string{"", "", "", "abc", "def"}; !slices.Equal(hashes, want) {
+		t.Errorf("hashes %q, want %q", hashes, want)
+	}
+}
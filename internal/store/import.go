@@ -0,0 +1,282 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Hajdudev/ecoDatabase/internal/gtfs"
+	"github.com/Hajdudev/ecoDatabase/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// checkTable reports whether t can be imported from feed, logging optional
+// files that are missing.
+func checkTable(feed *gtfs.Feed, t gtfs.Table, logger *log.Logger) error {
+	if !feed.Has(t.File) {
+		if t.Required {
+			return fmt.Errorf("feed is missing required file %s", t.File)
+		}
+		logger.Printf("import: %s not in feed, %s will be empty", t.File, t.Name)
+	}
+	return nil
+}
+
+// ImportFeed loads a GTFS feed into Postgres as a new, inactive feed
+// version next to the existing ones. It runs in a single transaction, so a
+// failed import leaves nothing behind; activate the version it returns
+// with ActivateFeedVersion.
+func (pg *PostgresStore) ImportFeed(ctx context.Context, feed *gtfs.Feed, logger *log.Logger) (*models.FeedVersion, error) {
+	hash, err := feed.Hash()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := pg.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// The unique index on hash makes a concurrent import of the same feed
+	// wait for this one and then insert nothing.
+	version := models.FeedVersion{Source: feed.Name(), Hash: hash}
+	insert := `INSERT INTO feed_versions (source, hash) VALUES ($1, $2)
+		ON CONFLICT (hash) WHERE hash <> '' DO NOTHING RETURNING id, imported_at`
+	err = tx.QueryRow(ctx, insert, version.Source, version.Hash).Scan(&version.ID, &version.ImportedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		var existing int
+		if err := tx.QueryRow(ctx, `SELECT id FROM feed_versions WHERE hash = $1`, hash).Scan(&existing); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w as feed version %d", ErrFeedAlreadyImported, existing)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var validity dateRange
+	for _, t := range gtfs.Tables {
+		if err := checkTable(feed, t, logger); err != nil {
+			return nil, err
+		}
+		if !feed.Has(t.File) {
+			continue
+		}
+
+		rows, err := feed.Rows(t.File)
+		if err != nil {
+			return nil, fmt.Errorf("loading %s: %w", t.File, err)
+		}
+		columns := append(t.Columns[:len(t.Columns):len(t.Columns)], "feed_version")
+		src := &copySource{rows: rows, table: t, version: version.ID, validity: &validity}
+		if t.Check != nil {
+			src.check = t.Check()
+		}
+		n, err := tx.CopyFrom(ctx, pgx.Identifier{t.Name}, columns, src)
+		rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("loading %s: %w", t.File, err)
+		}
+		logger.Printf("import: copied %d rows into %s", n, t.Name)
+	}
+
+	version.StartDate, version.EndDate = validity.start, validity.end
+	update := `UPDATE feed_versions SET start_date = $2, end_date = $3 WHERE id = $1`
+	if _, err := tx.Exec(ctx, update, version.ID, version.StartDate, version.EndDate); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	for _, t := range gtfs.Tables {
+		if _, err := pg.db.Exec(ctx, fmt.Sprintf("ANALYZE %s", t.Name)); err != nil {
+			return nil, err
+		}
+	}
+	return &version, nil
+}
+
+// ImportFeed loads a GTFS feed into SQLite as a new, inactive feed version,
+// like PostgresStore.ImportFeed.
+func (s *SQLiteStore) ImportFeed(ctx context.Context, feed *gtfs.Feed, logger *log.Logger) (*models.FeedVersion, error) {
+	hash, err := feed.Hash()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	version := models.FeedVersion{Source: feed.Name(), Hash: hash}
+	insert := `INSERT INTO feed_versions (source, hash) VALUES (?, ?)
+		ON CONFLICT (hash) WHERE hash <> '' DO NOTHING RETURNING id, imported_at`
+	err = tx.QueryRowContext(ctx, insert, version.Source, version.Hash).Scan(&version.ID, sqliteTime{&version.ImportedAt})
+	if errors.Is(err, sql.ErrNoRows) {
+		var existing int
+		if err := tx.QueryRowContext(ctx, `SELECT id FROM feed_versions WHERE hash = ?`, hash).Scan(&existing); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w as feed version %d", ErrFeedAlreadyImported, existing)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var validity dateRange
+	for _, t := range gtfs.Tables {
+		if err := checkTable(feed, t, logger); err != nil {
+			return nil, err
+		}
+		if !feed.Has(t.File) {
+			continue
+		}
+		n, err := insertSQLiteRows(ctx, tx, feed, t, version.ID, &validity)
+		if err != nil {
+			return nil, fmt.Errorf("loading %s: %w", t.File, err)
+		}
+		logger.Printf("import: inserted %d rows into %s", n, t.Name)
+	}
+
+	version.StartDate, version.EndDate = validity.start, validity.end
+	update := `UPDATE feed_versions SET start_date = ?, end_date = ? WHERE id = ?`
+	if _, err := tx.ExecContext(ctx, update, sqliteDate(version.StartDate), sqliteDate(version.EndDate), version.ID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	if _, err := s.db.ExecContext(ctx, "ANALYZE"); err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+func insertSQLiteRows(ctx context.Context, tx *sql.Tx, feed *gtfs.Feed, t gtfs.Table, version int, validity *dateRange) (int64, error) {
+	rows, err := feed.Rows(t.File)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	placeholders := strings.Repeat("?, ", len(t.Columns)) + "?"
+	insert := fmt.Sprintf("INSERT INTO %s (%s, feed_version) VALUES (%s)", t.Name, strings.Join(t.Columns, ", "), placeholders)
+	stmt, err := tx.PrepareContext(ctx, insert)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	var check gtfs.RowCheck
+	if t.Check != nil {
+		check = t.Check()
+	}
+	var n int64
+	for rows.Next() {
+		values, err := t.Values(rows.Record())
+		if err != nil {
+			return 0, fmt.Errorf("line %d: %w", rows.Line()+1, err)
+		}
+		if check != nil {
+			check.Add(rows.Line()+1, rows.Record())
+		}
+		validity.add(values)
+		for i, v := range values {
+			if d, ok := v.(time.Time); ok {
+				values[i] = d.Format(sqliteDateLayout)
+			}
+		}
+		if _, err := stmt.ExecContext(ctx, append(values, version)...); err != nil {
+			return 0, fmt.Errorf("line %d: %w", rows.Line()+1, err)
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if check != nil {
+		return n, check.Err()
+	}
+	return n, nil
+}
+
+// sqliteDate formats an optional date for SQLite.
+func sqliteDate(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.Format(sqliteDateLayout)
+}
+
+// dateRange tracks the first and last date seen in imported rows. Only
+// calendar and calendar_dates have date columns, so it ends up holding
+// the validity range of the feed.
+type dateRange struct {
+	start, end *time.Time
+}
+
+func (d *dateRange) add(values []any) {
+	for _, v := range values {
+		t, ok := v.(time.Time)
+		if !ok {
+			continue
+		}
+		if d.start == nil || t.Before(*d.start) {
+			d.start = &t
+		}
+		if d.end == nil || t.After(*d.end) {
+			d.end = &t
+		}
+	}
+}
+
+// copySource adapts a feed file to pgx.CopyFromSource, appending version
+// to every row. A failed check of the table fails the copy.
+type copySource struct {
+	rows     *gtfs.Rows
+	table    gtfs.Table
+	version  int
+	validity *dateRange
+	check    gtfs.RowCheck
+	values   []any
+	err      error
+}
+
+func (c *copySource) Next() bool {
+	if c.err != nil || !c.rows.Next() {
+		return false
+	}
+	c.values, c.err = c.table.Values(c.rows.Record())
+	if c.err != nil {
+		c.err = fmt.Errorf("line %d: %w", c.rows.Line()+1, c.err)
+		return false
+	}
+	if c.check != nil {
+		c.check.Add(c.rows.Line()+1, c.rows.Record())
+	}
+	c.validity.add(c.values)
+	c.values = append(c.values, c.version)
+	return true
+}
+
+func (c *copySource) Values() ([]any, error) {
+	return c.values, nil
+}
+
+func (c *copySource) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+	if err := c.rows.Err(); err != nil || c.check == nil {
+		return err
+	}
+	return c.check.Err()
+}
@@ -0,0 +1,434 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Hajdudev/ecoDatabase/internal/gtfs"
+	"github.com/Hajdudev/ecoDatabase/models"
+)
+
+// ErrNoUsers is returned by MemoryStore.GetUserByID; users only live in
+// Postgres.
+var ErrNoUsers = errors.New("users are not available in the memory store")
+
+// MemoryStore serves a GTFS feed from memory. The whole feed is read once
+// and indexed, so every lookup is a map access and no database is needed.
+// It is read-only after LoadMemoryStore returns and safe for concurrent
+// use.
+type MemoryStore struct {
+	stops       []models.Stop
+	stopByID    map[string]int
+	stopsByKey  map[string][]int // stop_id, stop_code and stop_name
+	children    map[string][]int
+	departures  map[string]int
+	stopMarkers []models.Marker
+
+	routes    []models.Route // ordered like GetAllRoutes
+	routeByID map[string]int
+
+	trips          []models.Trip
+	tripByID       map[string]int
+	tripsByService map[string][]int
+	tripsByRoute   map[string][]int
+	stopTimes      map[string][]models.StopTime // per trip, by stop_sequence
+	overnight      map[string]bool
+
+	calendars         []models.Calendar
+	calendarByService map[string][]models.Calendar
+	exceptionsByDate  map[time.Time][]models.CalendarDate
+	exceptionsByID    map[string][]models.CalendarDate
+
+	shapes      map[string][]models.Shape
+	shapeIDs    []string
+	shapeRoutes map[string][]string
+}
+
+var _ DatabaseStore = (*MemoryStore)(nil)
+
+// LoadMemoryStore reads every table of feed into a MemoryStore.
+func LoadMemoryStore(feed *gtfs.Feed) (*MemoryStore, error) {
+	m := &MemoryStore{
+		stopByID:          make(map[string]int),
+		stopsByKey:        make(map[string][]int),
+		children:          make(map[string][]int),
+		departures:        make(map[string]int),
+		routeByID:         make(map[string]int),
+		tripByID:          make(map[string]int),
+		tripsByService:    make(map[string][]int),
+		tripsByRoute:      make(map[string][]int),
+		stopTimes:         make(map[string][]models.StopTime),
+		overnight:         make(map[string]bool),
+		calendarByService: make(map[string][]models.Calendar),
+		exceptionsByDate:  make(map[time.Time][]models.CalendarDate),
+		exceptionsByID:    make(map[string][]models.CalendarDate),
+		shapes:            make(map[string][]models.Shape),
+		shapeRoutes:       make(map[string][]string),
+	}
+
+	var err error
+	if m.stops, err = readTable(feed, "stops.txt", true, gtfs.ParseStop); err != nil {
+		return nil, err
+	}
+	if m.routes, err = readTable(feed, "routes.txt", true, gtfs.ParseRoute); err != nil {
+		return nil, err
+	}
+	if m.trips, err = readTable(feed, "trips.txt", true, gtfs.ParseTrip); err != nil {
+		return nil, err
+	}
+	stopTimes, err := readTable(feed, "stop_times.txt", true, gtfs.ParseStopTime)
+	if err != nil {
+		return nil, err
+	}
+	if m.calendars, err = readTable(feed, "calendar.txt", false, gtfs.ParseCalendar); err != nil {
+		return nil, err
+	}
+	exceptions, err := readTable(feed, "calendar_dates.txt", false, gtfs.ParseCalendarDate)
+	if err != nil {
+		return nil, err
+	}
+	shapes, err := readTable(feed, "shapes.txt", false, gtfs.ParseShape)
+	if err != nil {
+		return nil, err
+	}
+
+	seenNames := make(map[string]bool)
+	for i, s := range m.stops {
+		m.stopByID[s.StopID] = i
+		m.stopsByKey[s.StopID] = append(m.stopsByKey[s.StopID], i)
+		if s.StopCode != "" && s.StopCode != s.StopID {
+			m.stopsByKey[s.StopCode] = append(m.stopsByKey[s.StopCode], i)
+		}
+		if s.StopName != s.StopID && s.StopName != s.StopCode {
+			m.stopsByKey[s.StopName] = append(m.stopsByKey[s.StopName], i)
+		}
+		if s.ParentStation != "" {
+			m.children[s.ParentStation] = append(m.children[s.ParentStation], i)
+		}
+		if !seenNames[s.StopName] {
+			seenNames[s.StopName] = true
+			m.stopMarkers = append(m.stopMarkers, models.Marker{
+				Name: s.StopName,
+				Lat:  strconv.FormatFloat(s.StopLat, 'f', -1, 64),
+				Lon:  strconv.FormatFloat(s.StopLon, 'f', -1, 64),
+			})
+		}
+	}
+
+	sort.SliceStable(m.routes, func(i, j int) bool {
+		a, b := m.routes[i], m.routes[j]
+		if a.RouteSortOrder != b.RouteSortOrder {
+			return a.RouteSortOrder < b.RouteSortOrder
+		}
+		if a.RouteShortName != b.RouteShortName {
+			return a.RouteShortName < b.RouteShortName
+		}
+		return a.RouteID < b.RouteID
+	})
+	for i, r := range m.routes {
+		m.routeByID[r.RouteID] = i
+	}
+
+	shapeRoutes := make(map[string]map[string]bool)
+	for i, t := range m.trips {
+		m.tripByID[t.TripID] = i
+		m.tripsByService[t.ServiceID] = append(m.tripsByService[t.ServiceID], i)
+		m.tripsByRoute[t.RouteID] = append(m.tripsByRoute[t.RouteID], i)
+		if t.ShapeID != "" {
+			if shapeRoutes[t.ShapeID] == nil {
+				shapeRoutes[t.ShapeID] = make(map[string]bool)
+			}
+			shapeRoutes[t.ShapeID][t.RouteID] = true
+		}
+	}
+	for shapeID, routes := range shapeRoutes {
+		for routeID := range routes {
+			m.shapeRoutes[shapeID] = append(m.shapeRoutes[shapeID], routeID)
+		}
+		sort.Strings(m.shapeRoutes[shapeID])
+	}
+
+	for _, st := range stopTimes {
+		m.stopTimes[st.TripID] = append(m.stopTimes[st.TripID], st)
+		m.departures[st.StopID]++
+		// The parser pads times to HH:MM:SS, as the importer does.
+		if st.ArrivalTime >= "24:00:00" {
+			m.overnight[st.TripID] = true
+		}
+	}
+	for _, sts := range m.stopTimes {
+		sort.Slice(sts, func(i, j int) bool { return sts[i].StopSequence < sts[j].StopSequence })
+	}
+
+	for _, c := range m.calendars {
+		m.calendarByService[c.ServiceID] = append(m.calendarByService[c.ServiceID], c)
+	}
+	for _, e := range exceptions {
+		m.exceptionsByDate[e.Date] = append(m.exceptionsByDate[e.Date], e)
+		m.exceptionsByID[e.ServiceID] = append(m.exceptionsByID[e.ServiceID], e)
+	}
+
+	for _, p := range shapes {
+		m.shapes[p.ShapeID] = append(m.shapes[p.ShapeID], p)
+	}
+	for id, points := range m.shapes {
+		sort.Slice(points, func(i, j int) bool { return points[i].ShapePtSequence < points[j].ShapePtSequence })
+		m.shapeIDs = append(m.shapeIDs, id)
+	}
+	sort.Strings(m.shapeIDs)
+
+	return m, nil
+}
+
+// readTable parses every row of file. Missing optional files yield no rows.
+func readTable[T any](feed *gtfs.Feed, file string, required bool, parse func(gtfs.Record) (T, error)) ([]T, error) {
+	if !feed.Has(file) {
+		if required {
+			return nil, fmt.Errorf("feed is missing required file %s", file)
+		}
+		return nil, nil
+	}
+
+	rows, err := feed.Rows(file)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Run the check the importers run on the same file.
+	var check gtfs.RowCheck
+	for _, t := range gtfs.Tables {
+		if t.File == file && t.Check != nil {
+			check = t.Check()
+		}
+	}
+
+	var out []T
+	for rows.Next() {
+		v, err := parse(rows.Record())
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", file, rows.Line()+1, err)
+		}
+		if check != nil {
+			check.Add(rows.Line()+1, rows.Record())
+		}
+		out = append(out, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	if check != nil {
+		if err := check.Err(); err != nil {
+			return nil, fmt.Errorf("%s %w", file, err)
+		}
+	}
+	return out, nil
+}
+
+func (m *MemoryStore) GetUserByID(ctx context.Context, id string) (*models.User, error) {
+	return nil, ErrNoUsers
+}
+
+func (m *MemoryStore) GetStopInfo(ctx context.Context, stopID string) (*models.Stop, error) {
+	i, ok := m.stopByID[stopID]
+	if !ok {
+		return nil, fmt.Errorf("stop %q not found", stopID)
+	}
+	stop := m.stops[i]
+	return &stop, nil
+}
+
+// ResolveStops gathers the same candidates as the Postgres query: stops
+// matching key by id, code or name, their children, and the children of
+// key itself.
+func (m *MemoryStore) ResolveStops(ctx context.Context, key string) ([]models.Stop, error) {
+	seen := make(map[int]bool)
+	var candidates []models.Stop
+	add := func(i int) {
+		if !seen[i] {
+			seen[i] = true
+			candidates = append(candidates, m.stops[i])
+		}
+	}
+	for _, i := range m.stopsByKey[key] {
+		add(i)
+		for _, c := range m.children[m.stops[i].StopID] {
+			add(c)
+		}
+	}
+	for _, c := range m.children[key] {
+		add(c)
+	}
+	return gtfs.ResolveStops(key, candidates), nil
+}
+
+func (m *MemoryStore) GetActiveServices(ctx context.Context, date string) ([]string, error) {
+	day, err := gtfs.ParseDate(date)
+	if err != nil {
+		return nil, err
+	}
+	return gtfs.ActiveServices(day, m.calendars, m.exceptionsByDate[day]), nil
+}
+
+func (m *MemoryStore) GetServiceCalendar(ctx context.Context, serviceID string) ([]models.Calendar, []models.CalendarDate, error) {
+	return m.calendarByService[serviceID], m.exceptionsByID[serviceID], nil
+}
+
+func (m *MemoryStore) GetStopsNames(ctx context.Context) ([]models.Marker, error) {
+	return m.stopMarkers, nil
+}
+
+func (m *MemoryStore) GetAllStops(ctx context.Context) ([]models.Stop, error) {
+	return m.stops, nil
+}
+
+func (m *MemoryStore) GetStopDepartureCounts(ctx context.Context) (map[string]int, error) {
+	return m.departures, nil
+}
+
+func (m *MemoryStore) GetStopsByID(ctx context.Context, ids []string) ([]models.Stop, error) {
+	var out []models.Stop
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if i, ok := m.stopByID[id]; ok && !seen[id] {
+			seen[id] = true
+			out = append(out, m.stops[i])
+		}
+	}
+	return out, nil
+}
+
+func (m *MemoryStore) GetTripsByService(ctx context.Context, serviceIDs []string) ([]models.Trip, error) {
+	var out []models.Trip
+	for _, id := range unique(serviceIDs) {
+		for _, i := range m.tripsByService[id] {
+			out = append(out, m.trips[i])
+		}
+	}
+	return out, nil
+}
+
+// GetStopTimesByService returns the stop times of every trip that belongs
+// to any of serviceIDs, ordered by trip and stop_sequence.
+func (m *MemoryStore) GetStopTimesByService(ctx context.Context, serviceIDs []string) ([]models.StopTime, error) {
+	return m.stopTimesOf(serviceIDs, func(string) bool { return true }), nil
+}
+
+// GetStopTimesAfterMidnight returns the stop times of the trips of
+// serviceIDs that are still running at 24:00:00 or later.
+func (m *MemoryStore) GetStopTimesAfterMidnight(ctx context.Context, serviceIDs []string) ([]models.StopTime, error) {
+	return m.stopTimesOf(serviceIDs, func(tripID string) bool { return m.overnight[tripID] }), nil
+}
+
+func (m *MemoryStore) stopTimesOf(serviceIDs []string, keep func(tripID string) bool) []models.StopTime {
+	var tripIDs []string
+	for _, id := range unique(serviceIDs) {
+		for _, i := range m.tripsByService[id] {
+			if keep(m.trips[i].TripID) {
+				tripIDs = append(tripIDs, m.trips[i].TripID)
+			}
+		}
+	}
+	sort.Strings(tripIDs)
+
+	var out []models.StopTime
+	for _, id := range tripIDs {
+		out = append(out, m.stopTimes[id]...)
+	}
+	return out
+}
+
+func (m *MemoryStore) GetTripsByID(ctx context.Context, ids []string) ([]models.Trip, error) {
+	var out []models.Trip
+	for _, id := range unique(ids) {
+		if i, ok := m.tripByID[id]; ok {
+			out = append(out, m.trips[i])
+		}
+	}
+	return out, nil
+}
+
+func (m *MemoryStore) GetStopTimesByTrip(ctx context.Context, tripID string) ([]models.StopTime, error) {
+	return m.stopTimes[tripID], nil
+}
+
+func (m *MemoryStore) GetStopTimesByTrips(ctx context.Context, tripIDs []string) ([]models.StopTime, error) {
+	ids := unique(tripIDs)
+	sort.Strings(ids)
+	var out []models.StopTime
+	for _, id := range ids {
+		out = append(out, m.stopTimes[id]...)
+	}
+	return out, nil
+}
+
+func (m *MemoryStore) GetAllRoutes(ctx context.Context) ([]models.Route, error) {
+	return m.routes, nil
+}
+
+func (m *MemoryStore) GetRoutesByID(ctx context.Context, ids []string) ([]models.Route, error) {
+	var out []models.Route
+	for _, id := range unique(ids) {
+		if i, ok := m.routeByID[id]; ok {
+			out = append(out, m.routes[i])
+		}
+	}
+	return out, nil
+}
+
+func (m *MemoryStore) GetTripsByRoute(ctx context.Context, routeID string) ([]models.Trip, error) {
+	var out []models.Trip
+	for _, i := range m.tripsByRoute[routeID] {
+		out = append(out, m.trips[i])
+	}
+	return out, nil
+}
+
+// GetStopTimesByRoute returns the stop times of every trip of a route,
+// ordered by trip and stop_sequence.
+func (m *MemoryStore) GetStopTimesByRoute(ctx context.Context, routeID string) ([]models.StopTime, error) {
+	var tripIDs []string
+	for _, i := range m.tripsByRoute[routeID] {
+		tripIDs = append(tripIDs, m.trips[i].TripID)
+	}
+	sort.Strings(tripIDs)
+
+	var out []models.StopTime
+	for _, id := range tripIDs {
+		out = append(out, m.stopTimes[id]...)
+	}
+	return out, nil
+}
+
+func (m *MemoryStore) GetShape(ctx context.Context, shapeID string) ([]models.Shape, error) {
+	return m.shapes[shapeID], nil
+}
+
+func (m *MemoryStore) GetAllShapes(ctx context.Context) ([]models.Shape, error) {
+	var out []models.Shape
+	for _, id := range m.shapeIDs {
+		out = append(out, m.shapes[id]...)
+	}
+	return out, nil
+}
+
+func (m *MemoryStore) GetShapeRoutes(ctx context.Context) (map[string][]string, error) {
+	return m.shapeRoutes, nil
+}
+
+// unique drops repeated ids, keeping the first occurrence.
+func unique(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	out := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
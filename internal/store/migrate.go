@@ -0,0 +1,336 @@
+package store
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// schemaVersionTable records the applied migrations, one row each.
+const schemaVersionTable = `
+CREATE TABLE IF NOT EXISTS schema_version (
+	version integer PRIMARY KEY,
+	name text NOT NULL,
+	applied_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`
+
+// Migration is one versioned schema change, read from
+// migrations/<dialect>/<version>_<name>.up.sql and the matching .down.sql.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus is a migration and when it was applied, if it was.
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// migrator is implemented by the backends that run migrations.
+// appliedMigrations creates schema_version when it does not exist yet.
+type migrator interface {
+	dialect() string
+	appliedMigrations(ctx context.Context) (map[int]time.Time, error)
+	// runMigration runs the up or down script of m and records it as
+	// applied or rolled back, in a single transaction. It holds a lock
+	// against other processes migrating the same database and reports
+	// false, without running anything, when one of them already applied
+	// or rolled back m.
+	runMigration(ctx context.Context, m Migration, up bool) (bool, error)
+}
+
+// migrationLock is the key of the Postgres advisory lock held while
+// migrating, an arbitrary constant shared by every process.
+const migrationLock = 7_263_519_004
+
+// loadMigrations returns the migrations of dialect ordered by version.
+func loadMigrations(dialect string) ([]Migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, e := range entries {
+		name := e.Name()
+		base, up := strings.CutSuffix(name, ".up.sql")
+		if !up {
+			var down bool
+			if base, down = strings.CutSuffix(name, ".down.sql"); !down {
+				return nil, fmt.Errorf("migration %s: expected a .up.sql or .down.sql file", name)
+			}
+		}
+		v, label, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(v)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: invalid version %q", name, v)
+		}
+		script, err := fs.ReadFile(migrationFiles, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		} else if m.Name != label {
+			return nil, fmt.Errorf("migration %d has two names, %s and %s", version, m.Name, label)
+		}
+		if up {
+			m.Up = string(script)
+		} else {
+			m.Down = string(script)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+func migratorOf(db Database) (migrator, error) {
+	m, ok := db.(migrator)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support migrations", db)
+	}
+	return m, nil
+}
+
+// MigrationStatuses lists every known migration with the time it was
+// applied, nil for pending ones.
+func MigrationStatuses(ctx context.Context, db Database) ([]MigrationStatus, error) {
+	m, err := migratorOf(db)
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := loadMigrations(m.dialect())
+	if err != nil {
+		return nil, err
+	}
+	applied, err := m.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, mig := range migrations {
+		statuses[i].Migration = mig
+		if at, ok := applied[mig.Version]; ok {
+			statuses[i].AppliedAt = &at
+		}
+	}
+	return statuses, nil
+}
+
+// MigrateUp applies every pending migration in version order and returns
+// the ones it applied. It stops at the first failure; the migrations
+// before it stay applied.
+func MigrateUp(ctx context.Context, db Database) ([]Migration, error) {
+	m, err := migratorOf(db)
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := MigrationStatuses(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, s := range statuses {
+		if s.AppliedAt != nil {
+			continue
+		}
+		ran, err := m.runMigration(ctx, s.Migration, true)
+		if err != nil {
+			return done, fmt.Errorf("migration %d_%s: %w", s.Version, s.Name, err)
+		}
+		if ran {
+			done = append(done, s.Migration)
+		}
+	}
+	return done, nil
+}
+
+// MigrateDown rolls back the most recently applied migration and returns
+// it, or nil when nothing is applied.
+func MigrateDown(ctx context.Context, db Database) (*Migration, error) {
+	m, err := migratorOf(db)
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := MigrationStatuses(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(statuses) - 1; i >= 0; i-- {
+		s := statuses[i]
+		if s.AppliedAt == nil {
+			continue
+		}
+		ran, err := m.runMigration(ctx, s.Migration, false)
+		if err != nil {
+			return nil, fmt.Errorf("migration %d_%s: %w", s.Version, s.Name, err)
+		}
+		if !ran {
+			// Another process rolled it back meanwhile.
+			return nil, nil
+		}
+		return &s.Migration, nil
+	}
+	return nil, nil
+}
+
+func (pg *PostgresStore) dialect() string {
+	return "postgres"
+}
+
+func (pg *PostgresStore) appliedMigrations(ctx context.Context) (map[int]time.Time, error) {
+	// CREATE TABLE IF NOT EXISTS can still fail when another process
+	// creates the table at the same time.
+	err := pgx.BeginFunc(ctx, pg.db, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationLock); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, schemaVersionTable)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	rows, err := pg.db.Query(ctx, `SELECT version, applied_at FROM schema_version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+func (pg *PostgresStore) runMigration(ctx context.Context, m Migration, up bool) (bool, error) {
+	tx, err := pg.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationLock); err != nil {
+		return false, err
+	}
+	var applied bool
+	err = tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM schema_version WHERE version = $1)`, m.Version).Scan(&applied)
+	if err != nil {
+		return false, err
+	}
+	if applied == up {
+		return false, nil
+	}
+
+	if up {
+		if _, err := tx.Exec(ctx, m.Up); err != nil {
+			return false, err
+		}
+		_, err = tx.Exec(ctx, `INSERT INTO schema_version (version, name) VALUES ($1, $2)`, m.Version, m.Name)
+	} else {
+		if _, err := tx.Exec(ctx, m.Down); err != nil {
+			return false, err
+		}
+		_, err = tx.Exec(ctx, `DELETE FROM schema_version WHERE version = $1`, m.Version)
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit(ctx)
+}
+
+func (s *SQLiteStore) dialect() string {
+	return "sqlite"
+}
+
+func (s *SQLiteStore) appliedMigrations(ctx context.Context) (map[int]time.Time, error) {
+	if _, err := s.db.ExecContext(ctx, schemaVersionTable); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT version, applied_at FROM schema_version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, sqliteTime{&at}); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// runMigration relies on the transaction taking the write lock when it
+// begins, see OpenSQLite.
+func (s *SQLiteStore) runMigration(ctx context.Context, m Migration, up bool) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var applied bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM schema_version WHERE version = ?)`, m.Version).Scan(&applied)
+	if err != nil {
+		return false, err
+	}
+	if applied == up {
+		return false, nil
+	}
+
+	if up {
+		if _, err := tx.ExecContext(ctx, m.Up); err != nil {
+			return false, err
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO schema_version (version, name) VALUES (?, ?)`, m.Version, m.Name)
+	} else {
+		if _, err := tx.ExecContext(ctx, m.Down); err != nil {
+			return false, err
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM schema_version WHERE version = ?`, m.Version)
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	var versions [2][]int
+	for i, dialect := range []string{"postgres", "sqlite"} {
+		migrations, err := loadMigrations(dialect)
+		if err != nil {
+			t.Fatalf("%s: %v", dialect, err)
+		}
+		for j, m := range migrations {
+			if m.Version != j+1 {
+				t.Errorf("%s: migration %d has version %d", dialect, j, m.Version)
+			}
+			versions[i] = append(versions[i], m.Version)
+		}
+	}
+	if len(versions[0]) != len(versions[1]) {
+		t.Errorf("postgres has migrations %v, sqlite %v", versions[0], versions[1])
+	}
+}
+
+func openTestSQLite(t *testing.T, path string) *SQLiteStore {
+	t.Helper()
+	db, err := OpenSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+	return db
+}
+
+// migratedSQLite returns an empty, fully migrated SQLite database.
+func migratedSQLite(t *testing.T) *SQLiteStore {
+	t.Helper()
+	db := openTestSQLite(t, filepath.Join(t.TempDir(), "test.db"))
+	if _, err := MigrateUp(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestMigrateUpDown(t *testing.T) {
+	ctx := context.Background()
+	db := openTestSQLite(t, filepath.Join(t.TempDir(), "test.db"))
+
+	all, err := loadMigrations("sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done, err := MigrateUp(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != len(all) {
+		t.Fatalf("applied %d migrations, want %d", len(done), len(all))
+	}
+	if done, err := MigrateUp(ctx, db); err != nil || len(done) != 0 {
+		t.Fatalf("second MigrateUp applied %d migrations, err %v", len(done), err)
+	}
+
+	// Every down script must undo its up script.
+	for i := len(all) - 1; i >= 0; i-- {
+		m, err := MigrateDown(ctx, db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m == nil || m.Version != all[i].Version {
+			t.Fatalf("rolled back %v, want version %d", m, all[i].Version)
+		}
+	}
+	if m, err := MigrateDown(ctx, db); err != nil || m != nil {
+		t.Fatalf("MigrateDown with nothing applied = %v, %v", m, err)
+	}
+	if done, err := MigrateUp(ctx, db); err != nil || len(done) != len(all) {
+		t.Fatalf("MigrateUp after rolling back applied %d migrations, err %v", len(done), err)
+	}
+}
+
+func TestMigrateUpConcurrent(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "test.db")
+	all, err := loadMigrations("sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const instances = 4
+	applied := make([]int, instances)
+	errs := make([]error, instances)
+	var wg sync.WaitGroup
+	for i := range instances {
+		db := openTestSQLite(t, path)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			done, err := MigrateUp(ctx, db)
+			applied[i], errs[i] = len(done), err
+		}()
+	}
+	wg.Wait()
+
+	total := 0
+	for i := range instances {
+		if errs[i] != nil {
+			t.Errorf("instance %d: %v", i, errs[i])
+		}
+		total += applied[i]
+	}
+	if total != len(all) {
+		t.Errorf("instances applied %d migrations in total, want %d", total, len(all))
+	}
+}
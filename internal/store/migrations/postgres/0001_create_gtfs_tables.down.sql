@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS shapes;
+DROP TABLE IF EXISTS calendar_dates;
+DROP TABLE IF EXISTS calendar;
+DROP TABLE IF EXISTS stop_times;
+DROP TABLE IF EXISTS trips;
+DROP TABLE IF EXISTS routes;
+DROP TABLE IF EXISTS stops;
@@ -0,0 +1,10 @@
+-- Secondary indexes of the GTFS tables. stop_times is looked up both by
+-- stop, for departures, and by trip, for trip details and the planner.
+CREATE INDEX stops_stop_name_idx ON stops (stop_name);
+CREATE INDEX stops_parent_station_idx ON stops (parent_station);
+CREATE INDEX trips_service_id_idx ON trips (service_id);
+CREATE INDEX trips_route_id_idx ON trips (route_id);
+CREATE INDEX stop_times_stop_id_idx ON stop_times (stop_id);
+CREATE INDEX stop_times_trip_id_idx ON stop_times (trip_id, stop_sequence);
+CREATE INDEX calendar_dates_date_idx ON calendar_dates (date);
+CREATE INDEX shapes_shape_id_idx ON shapes (shape_id, shape_pt_sequence);
@@ -0,0 +1,8 @@
+CREATE TABLE users (
+	id bigserial PRIMARY KEY,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	email text NOT NULL UNIQUE,
+	name text NOT NULL DEFAULT '',
+	image text NOT NULL DEFAULT '',
+	recent_rides text[] NOT NULL DEFAULT '{}'
+);
@@ -0,0 +1,6 @@
+-- Every import adds a row, so the largest id tells running servers that
+-- the feed changed.
+CREATE TABLE feed_imports (
+	id bigserial PRIMARY KEY,
+	imported_at timestamptz NOT NULL DEFAULT now()
+);
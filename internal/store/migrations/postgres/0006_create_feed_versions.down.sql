@@ -0,0 +1,46 @@
+-- Only the active version survives.
+DELETE FROM stops WHERE feed_version IS DISTINCT FROM (SELECT id FROM feed_versions WHERE active);
+DELETE FROM routes WHERE feed_version IS DISTINCT FROM (SELECT id FROM feed_versions WHERE active);
+DELETE FROM trips WHERE feed_version IS DISTINCT FROM (SELECT id FROM feed_versions WHERE active);
+DELETE FROM stop_times WHERE feed_version IS DISTINCT FROM (SELECT id FROM feed_versions WHERE active);
+DELETE FROM calendar WHERE feed_version IS DISTINCT FROM (SELECT id FROM feed_versions WHERE active);
+DELETE FROM calendar_dates WHERE feed_version IS DISTINCT FROM (SELECT id FROM feed_versions WHERE active);
+DELETE FROM shapes WHERE feed_version IS DISTINCT FROM (SELECT id FROM feed_versions WHERE active);
+
+DROP INDEX stops_stop_name_idx;
+DROP INDEX stops_parent_station_idx;
+DROP INDEX trips_service_id_idx;
+DROP INDEX trips_route_id_idx;
+DROP INDEX stop_times_stop_id_idx;
+DROP INDEX stop_times_trip_id_idx;
+DROP INDEX calendar_dates_date_idx;
+DROP INDEX shapes_shape_id_idx;
+
+ALTER TABLE stops DROP CONSTRAINT stops_pkey, ADD PRIMARY KEY (stop_id);
+ALTER TABLE routes DROP CONSTRAINT routes_pkey, ADD PRIMARY KEY (route_id);
+ALTER TABLE trips DROP CONSTRAINT trips_pkey, ADD PRIMARY KEY (trip_id);
+ALTER TABLE calendar DROP CONSTRAINT calendar_pkey, ADD PRIMARY KEY (service_id);
+
+ALTER TABLE stops DROP COLUMN feed_version;
+ALTER TABLE routes DROP COLUMN feed_version;
+ALTER TABLE trips DROP COLUMN feed_version;
+ALTER TABLE stop_times DROP COLUMN feed_version;
+ALTER TABLE calendar DROP COLUMN feed_version;
+ALTER TABLE calendar_dates DROP COLUMN feed_version;
+ALTER TABLE shapes DROP COLUMN feed_version;
+
+CREATE INDEX stops_stop_name_idx ON stops (stop_name);
+CREATE INDEX stops_parent_station_idx ON stops (parent_station);
+CREATE INDEX trips_service_id_idx ON trips (service_id);
+CREATE INDEX trips_route_id_idx ON trips (route_id);
+CREATE INDEX stop_times_stop_id_idx ON stop_times (stop_id);
+CREATE INDEX stop_times_trip_id_idx ON stop_times (trip_id, stop_sequence);
+CREATE INDEX calendar_dates_date_idx ON calendar_dates (date);
+CREATE INDEX shapes_shape_id_idx ON shapes (shape_id, shape_pt_sequence);
+
+DROP TABLE feed_versions;
+
+CREATE TABLE feed_imports (
+	id bigserial PRIMARY KEY,
+	imported_at timestamptz NOT NULL DEFAULT now()
+);
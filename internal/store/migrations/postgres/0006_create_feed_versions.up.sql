@@ -0,0 +1,62 @@
+-- Every import becomes a numbered feed version stored next to the others.
+-- Queries read the active version unless they ask for another one.
+CREATE TABLE feed_versions (
+	id serial PRIMARY KEY,
+	source text NOT NULL DEFAULT '',
+	hash text NOT NULL DEFAULT '',
+	imported_at timestamptz NOT NULL DEFAULT now(),
+	start_date date,
+	end_date date,
+	active boolean NOT NULL DEFAULT false,
+	activated_at timestamptz
+);
+CREATE UNIQUE INDEX feed_versions_active_idx ON feed_versions (active) WHERE active;
+
+-- A feed imported before versioning becomes version 1.
+INSERT INTO feed_versions (source, active, activated_at, start_date, end_date)
+SELECT 'imported before feed versions', true, now(),
+	(SELECT min(d) FROM (SELECT start_date AS d FROM calendar UNION ALL SELECT date FROM calendar_dates) dates),
+	(SELECT max(d) FROM (SELECT end_date AS d FROM calendar UNION ALL SELECT date FROM calendar_dates) dates)
+WHERE EXISTS (SELECT 1 FROM stops);
+
+ALTER TABLE stops ADD COLUMN feed_version integer NOT NULL DEFAULT 1;
+ALTER TABLE routes ADD COLUMN feed_version integer NOT NULL DEFAULT 1;
+ALTER TABLE trips ADD COLUMN feed_version integer NOT NULL DEFAULT 1;
+ALTER TABLE stop_times ADD COLUMN feed_version integer NOT NULL DEFAULT 1;
+ALTER TABLE calendar ADD COLUMN feed_version integer NOT NULL DEFAULT 1;
+ALTER TABLE calendar_dates ADD COLUMN feed_version integer NOT NULL DEFAULT 1;
+ALTER TABLE shapes ADD COLUMN feed_version integer NOT NULL DEFAULT 1;
+
+ALTER TABLE stops ALTER COLUMN feed_version DROP DEFAULT;
+ALTER TABLE routes ALTER COLUMN feed_version DROP DEFAULT;
+ALTER TABLE trips ALTER COLUMN feed_version DROP DEFAULT;
+ALTER TABLE stop_times ALTER COLUMN feed_version DROP DEFAULT;
+ALTER TABLE calendar ALTER COLUMN feed_version DROP DEFAULT;
+ALTER TABLE calendar_dates ALTER COLUMN feed_version DROP DEFAULT;
+ALTER TABLE shapes ALTER COLUMN feed_version DROP DEFAULT;
+
+ALTER TABLE stops DROP CONSTRAINT stops_pkey, ADD PRIMARY KEY (feed_version, stop_id);
+ALTER TABLE routes DROP CONSTRAINT routes_pkey, ADD PRIMARY KEY (feed_version, route_id);
+ALTER TABLE trips DROP CONSTRAINT trips_pkey, ADD PRIMARY KEY (feed_version, trip_id);
+ALTER TABLE calendar DROP CONSTRAINT calendar_pkey, ADD PRIMARY KEY (feed_version, service_id);
+
+-- Every lookup is within one version, so the indexes lead with it.
+DROP INDEX stops_stop_name_idx;
+DROP INDEX stops_parent_station_idx;
+DROP INDEX trips_service_id_idx;
+DROP INDEX trips_route_id_idx;
+DROP INDEX stop_times_stop_id_idx;
+DROP INDEX stop_times_trip_id_idx;
+DROP INDEX calendar_dates_date_idx;
+DROP INDEX shapes_shape_id_idx;
+CREATE INDEX stops_stop_name_idx ON stops (feed_version, stop_name);
+CREATE INDEX stops_parent_station_idx ON stops (feed_version, parent_station);
+CREATE INDEX trips_service_id_idx ON trips (feed_version, service_id);
+CREATE INDEX trips_route_id_idx ON trips (feed_version, route_id);
+CREATE INDEX stop_times_stop_id_idx ON stop_times (feed_version, stop_id);
+CREATE INDEX stop_times_trip_id_idx ON stop_times (feed_version, trip_id, stop_sequence);
+CREATE INDEX calendar_dates_date_idx ON calendar_dates (feed_version, date);
+CREATE INDEX shapes_shape_id_idx ON shapes (feed_version, shape_id, shape_pt_sequence);
+
+-- feed_versions replaces the import log.
+DROP TABLE feed_imports;
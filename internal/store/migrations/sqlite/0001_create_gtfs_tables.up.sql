@@ -0,0 +1,87 @@
+-- The GTFS tables, one per feed struct in models. Migration 0005 adds
+-- the feed_version column that imports fill in.
+
+CREATE TABLE stops (
+	stop_id text PRIMARY KEY,
+	stop_code text NOT NULL DEFAULT '',
+	stop_name text NOT NULL DEFAULT '',
+	stop_desc text,
+	stop_lat double precision NOT NULL DEFAULT 0,
+	stop_lon double precision NOT NULL DEFAULT 0,
+	zone_id text NOT NULL DEFAULT '',
+	stop_url text NOT NULL DEFAULT '',
+	location_type integer NOT NULL DEFAULT 0,
+	parent_station text NOT NULL DEFAULT '',
+	stop_timezone text NOT NULL DEFAULT '',
+	wheelchair_boarding integer NOT NULL DEFAULT 0,
+	level_id text NOT NULL DEFAULT '',
+	platform_code text NOT NULL DEFAULT ''
+);
+
+CREATE TABLE routes (
+	route_id text PRIMARY KEY,
+	agency_id text NOT NULL DEFAULT '',
+	route_short_name text NOT NULL DEFAULT '',
+	route_long_name text NOT NULL DEFAULT '',
+	route_description text NOT NULL DEFAULT '',
+	route_type integer NOT NULL DEFAULT 0,
+	route_url text NOT NULL DEFAULT '',
+	route_color text NOT NULL DEFAULT '',
+	route_text_color text NOT NULL DEFAULT '',
+	route_sort_order bigint NOT NULL DEFAULT 0
+);
+
+CREATE TABLE trips (
+	route_id text NOT NULL,
+	service_id text NOT NULL,
+	trip_id text PRIMARY KEY,
+	trip_headsign text NOT NULL DEFAULT '',
+	trip_short_name text NOT NULL DEFAULT '',
+	direction_id integer NOT NULL DEFAULT 0,
+	block_id text NOT NULL DEFAULT '',
+	shape_id text NOT NULL DEFAULT '',
+	wheelchair_accessible integer NOT NULL DEFAULT 0,
+	bikes_allowed integer NOT NULL DEFAULT 0
+);
+
+-- Times are padded to HH:MM:SS and may pass 24:00:00, so they are kept as
+-- text rather than time.
+CREATE TABLE stop_times (
+	trip_id text NOT NULL,
+	arrival_time text NOT NULL,
+	departure_time text NOT NULL,
+	stop_id text NOT NULL,
+	stop_sequence integer NOT NULL,
+	stop_headsign text NOT NULL DEFAULT '',
+	pickup_type integer NOT NULL DEFAULT 0,
+	drop_off_type integer NOT NULL DEFAULT 0,
+	shape_dist_traveled double precision NOT NULL DEFAULT 0,
+	timepoint integer NOT NULL DEFAULT 0
+);
+
+CREATE TABLE calendar (
+	service_id text PRIMARY KEY,
+	monday boolean NOT NULL,
+	tuesday boolean NOT NULL,
+	wednesday boolean NOT NULL,
+	thursday boolean NOT NULL,
+	friday boolean NOT NULL,
+	saturday boolean NOT NULL,
+	sunday boolean NOT NULL,
+	start_date date NOT NULL,
+	end_date date NOT NULL
+);
+
+CREATE TABLE calendar_dates (
+	service_id text NOT NULL,
+	date date NOT NULL,
+	exception_type integer NOT NULL
+);
+
+CREATE TABLE shapes (
+	shape_id text NOT NULL,
+	shape_pt_lat double precision NOT NULL,
+	shape_pt_lon double precision NOT NULL,
+	shape_pt_sequence integer NOT NULL,
+	shape_dist_traveled double precision NOT NULL DEFAULT 0
+);
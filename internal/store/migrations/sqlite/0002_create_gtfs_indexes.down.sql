@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS shapes_shape_id_idx;
+DROP INDEX IF EXISTS calendar_dates_date_idx;
+DROP INDEX IF EXISTS stop_times_trip_id_idx;
+DROP INDEX IF EXISTS stop_times_stop_id_idx;
+DROP INDEX IF EXISTS trips_route_id_idx;
+DROP INDEX IF EXISTS trips_service_id_idx;
+DROP INDEX IF EXISTS stops_parent_station_idx;
+DROP INDEX IF EXISTS stops_stop_name_idx;
@@ -0,0 +1,9 @@
+-- SQLite has no arrays, so recent_rides holds a JSON array.
+CREATE TABLE users (
+	id integer PRIMARY KEY AUTOINCREMENT,
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	email text NOT NULL UNIQUE,
+	name text NOT NULL DEFAULT '',
+	image text NOT NULL DEFAULT '',
+	recent_rides text NOT NULL DEFAULT '[]'
+);
@@ -0,0 +1,7 @@
+-- Service alerts written through the admin API, shared by every server
+-- instance. alert is the models.Alert as JSON.
+CREATE TABLE manual_alerts (
+	id text PRIMARY KEY,
+	alert text NOT NULL,
+	updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,6 @@
+-- Every import adds a row, so the largest id tells running servers that
+-- the feed changed.
+CREATE TABLE feed_imports (
+	id integer PRIMARY KEY AUTOINCREMENT,
+	imported_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,150 @@
+-- Every import becomes a numbered feed version stored next to the others.
+-- Queries read the active version unless they ask for another one.
+CREATE TABLE feed_versions (
+	id integer PRIMARY KEY AUTOINCREMENT,
+	source text NOT NULL DEFAULT '',
+	hash text NOT NULL DEFAULT '',
+	imported_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	start_date date,
+	end_date date,
+	active boolean NOT NULL DEFAULT false,
+	activated_at timestamp
+);
+CREATE UNIQUE INDEX feed_versions_active_idx ON feed_versions (active) WHERE active;
+
+-- A feed imported before versioning becomes version 1.
+INSERT INTO feed_versions (source, active, activated_at, start_date, end_date)
+SELECT 'imported before feed versions', true, CURRENT_TIMESTAMP,
+	(SELECT min(d) FROM (SELECT start_date AS d FROM calendar UNION ALL SELECT date FROM calendar_dates)),
+	(SELECT max(d) FROM (SELECT end_date AS d FROM calendar UNION ALL SELECT date FROM calendar_dates))
+WHERE EXISTS (SELECT 1 FROM stops);
+
+-- SQLite cannot change a primary key, so every table is rebuilt with
+-- feed_version added; its indexes go with the old table and are created
+-- again below, leading with the version.
+CREATE TABLE stops_new (
+	stop_id text NOT NULL,
+	stop_code text NOT NULL DEFAULT '',
+	stop_name text NOT NULL DEFAULT '',
+	stop_desc text,
+	stop_lat double precision NOT NULL DEFAULT 0,
+	stop_lon double precision NOT NULL DEFAULT 0,
+	zone_id text NOT NULL DEFAULT '',
+	stop_url text NOT NULL DEFAULT '',
+	location_type integer NOT NULL DEFAULT 0,
+	parent_station text NOT NULL DEFAULT '',
+	stop_timezone text NOT NULL DEFAULT '',
+	wheelchair_boarding integer NOT NULL DEFAULT 0,
+	level_id text NOT NULL DEFAULT '',
+	platform_code text NOT NULL DEFAULT '',
+	feed_version integer NOT NULL,
+	PRIMARY KEY (feed_version, stop_id)
+);
+INSERT INTO stops_new SELECT stop_id, stop_code, stop_name, stop_desc, stop_lat, stop_lon, zone_id, stop_url, location_type, parent_station, stop_timezone, wheelchair_boarding, level_id, platform_code, 1 FROM stops;
+DROP TABLE stops;
+ALTER TABLE stops_new RENAME TO stops;
+
+CREATE TABLE routes_new (
+	route_id text NOT NULL,
+	agency_id text NOT NULL DEFAULT '',
+	route_short_name text NOT NULL DEFAULT '',
+	route_long_name text NOT NULL DEFAULT '',
+	route_description text NOT NULL DEFAULT '',
+	route_type integer NOT NULL DEFAULT 0,
+	route_url text NOT NULL DEFAULT '',
+	route_color text NOT NULL DEFAULT '',
+	route_text_color text NOT NULL DEFAULT '',
+	route_sort_order bigint NOT NULL DEFAULT 0,
+	feed_version integer NOT NULL,
+	PRIMARY KEY (feed_version, route_id)
+);
+INSERT INTO routes_new SELECT route_id, agency_id, route_short_name, route_long_name, route_description, route_type, route_url, route_color, route_text_color, route_sort_order, 1 FROM routes;
+DROP TABLE routes;
+ALTER TABLE routes_new RENAME TO routes;
+
+CREATE TABLE trips_new (
+	route_id text NOT NULL,
+	service_id text NOT NULL,
+	trip_id text NOT NULL,
+	trip_headsign text NOT NULL DEFAULT '',
+	trip_short_name text NOT NULL DEFAULT '',
+	direction_id integer NOT NULL DEFAULT 0,
+	block_id text NOT NULL DEFAULT '',
+	shape_id text NOT NULL DEFAULT '',
+	wheelchair_accessible integer NOT NULL DEFAULT 0,
+	bikes_allowed integer NOT NULL DEFAULT 0,
+	feed_version integer NOT NULL,
+	PRIMARY KEY (feed_version, trip_id)
+);
+INSERT INTO trips_new SELECT route_id, service_id, trip_id, trip_headsign, trip_short_name, direction_id, block_id, shape_id, wheelchair_accessible, bikes_allowed, 1 FROM trips;
+DROP TABLE trips;
+ALTER TABLE trips_new RENAME TO trips;
+
+CREATE TABLE stop_times_new (
+	trip_id text NOT NULL,
+	arrival_time text NOT NULL,
+	departure_time text NOT NULL,
+	stop_id text NOT NULL,
+	stop_sequence integer NOT NULL,
+	stop_headsign text NOT NULL DEFAULT '',
+	pickup_type integer NOT NULL DEFAULT 0,
+	drop_off_type integer NOT NULL DEFAULT 0,
+	shape_dist_traveled double precision NOT NULL DEFAULT 0,
+	timepoint integer NOT NULL DEFAULT 0,
+	feed_version integer NOT NULL
+);
+INSERT INTO stop_times_new SELECT trip_id, arrival_time, departure_time, stop_id, stop_sequence, stop_headsign, pickup_type, drop_off_type, shape_dist_traveled, timepoint, 1 FROM stop_times;
+DROP TABLE stop_times;
+ALTER TABLE stop_times_new RENAME TO stop_times;
+
+CREATE TABLE calendar_new (
+	service_id text NOT NULL,
+	monday boolean NOT NULL,
+	tuesday boolean NOT NULL,
+	wednesday boolean NOT NULL,
+	thursday boolean NOT NULL,
+	friday boolean NOT NULL,
+	saturday boolean NOT NULL,
+	sunday boolean NOT NULL,
+	start_date date NOT NULL,
+	end_date date NOT NULL,
+	feed_version integer NOT NULL,
+	PRIMARY KEY (feed_version, service_id)
+);
+INSERT INTO calendar_new SELECT service_id, monday, tuesday, wednesday, thursday, friday, saturday, sunday, start_date, end_date, 1 FROM calendar;
+DROP TABLE calendar;
+ALTER TABLE calendar_new RENAME TO calendar;
+
+CREATE TABLE calendar_dates_new (
+	service_id text NOT NULL,
+	date date NOT NULL,
+	exception_type integer NOT NULL,
+	feed_version integer NOT NULL
+);
+INSERT INTO calendar_dates_new SELECT service_id, date, exception_type, 1 FROM calendar_dates;
+DROP TABLE calendar_dates;
+ALTER TABLE calendar_dates_new RENAME TO calendar_dates;
+
+CREATE TABLE shapes_new (
+	shape_id text NOT NULL,
+	shape_pt_lat double precision NOT NULL,
+	shape_pt_lon double precision NOT NULL,
+	shape_pt_sequence integer NOT NULL,
+	shape_dist_traveled double precision NOT NULL DEFAULT 0,
+	feed_version integer NOT NULL
+);
+INSERT INTO shapes_new SELECT shape_id, shape_pt_lat, shape_pt_lon, shape_pt_sequence, shape_dist_traveled, 1 FROM shapes;
+DROP TABLE shapes;
+ALTER TABLE shapes_new RENAME TO shapes;
+
+CREATE INDEX stops_stop_name_idx ON stops (feed_version, stop_name);
+CREATE INDEX stops_parent_station_idx ON stops (feed_version, parent_station);
+CREATE INDEX trips_service_id_idx ON trips (feed_version, service_id);
+CREATE INDEX trips_route_id_idx ON trips (feed_version, route_id);
+CREATE INDEX stop_times_stop_id_idx ON stop_times (feed_version, stop_id);
+CREATE INDEX stop_times_trip_id_idx ON stop_times (feed_version, trip_id, stop_sequence);
+CREATE INDEX calendar_dates_date_idx ON calendar_dates (feed_version, date);
+CREATE INDEX shapes_shape_id_idx ON shapes (feed_version, shape_id, shape_pt_sequence);
+
+-- feed_versions replaces the import log.
+DROP TABLE feed_imports;
@@ -0,0 +1,14 @@
+-- Every activation of a feed version, in order, so that a rollback can
+-- walk back through them. Rolled back activations stay as a record but are
+-- skipped by the next rollback.
+CREATE TABLE feed_activations (
+	id integer PRIMARY KEY AUTOINCREMENT,
+	feed_version integer NOT NULL,
+	activated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	rolled_back boolean NOT NULL DEFAULT false
+);
+
+INSERT INTO feed_activations (feed_version, activated_at)
+SELECT id, activated_at FROM feed_versions
+WHERE activated_at IS NOT NULL
+ORDER BY active, activated_at;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS feed_versions_hash_idx;
@@ -0,0 +1,7 @@
+-- Importing the same feed twice is rejected by this index rather than by a
+-- check that two concurrent imports could both pass. Versions imported
+-- before hashes were recorded keep the empty hash and are exempt. Of any
+-- versions already sharing a hash, all but the first lose it.
+UPDATE feed_versions SET hash = ''
+WHERE hash <> '' AND id NOT IN (SELECT min(id) FROM feed_versions GROUP BY hash);
+CREATE UNIQUE INDEX feed_versions_hash_idx ON feed_versions (hash) WHERE hash <> '';
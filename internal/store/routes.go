@@ -0,0 +1,63 @@
+package store
+
+import (
+	"context"
+
+	"github.com/Hajdudev/ecoDatabase/models"
+	"github.com/jackc/pgx/v5"
+)
+
+const routeColumns = `route_id, agency_id, route_short_name, route_long_name, route_description, route_type,
+	route_url, route_color, route_text_color, route_sort_order`
+
+// GetAllRoutes returns every route ordered by route_sort_order and name.
+func (pg *PostgresStore) GetAllRoutes(ctx context.Context) ([]models.Route, error) {
+	query := `
+		SELECT ` + routeColumns + `
+		FROM routes
+		WHERE feed_version = ` + feedVersion + `
+		ORDER BY route_sort_order, route_short_name, route_id
+	`
+	rows, err := pg.db.Query(ctx, query, versionArg(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByName[models.Route])
+}
+
+// GetRoutesByID returns the routes with the given ids; unknown ids are skipped.
+func (pg *PostgresStore) GetRoutesByID(ctx context.Context, ids []string) ([]models.Route, error) {
+	query := `SELECT ` + routeColumns + ` FROM routes WHERE feed_version = ` + feedVersion + ` AND route_id = ANY($2)`
+	rows, err := pg.db.Query(ctx, query, versionArg(ctx), textArray(ids))
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByName[models.Route])
+}
+
+// GetTripsByRoute returns the trips of a route.
+func (pg *PostgresStore) GetTripsByRoute(ctx context.Context, routeID string) ([]models.Trip, error) {
+	query := `SELECT ` + tripColumns + ` FROM trips WHERE feed_version = ` + feedVersion + ` AND route_id = $2`
+	rows, err := pg.db.Query(ctx, query, versionArg(ctx), routeID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByName[models.Trip])
+}
+
+// GetStopTimesByRoute returns the stop times of every trip of a route,
+// ordered by trip and stop_sequence.
+func (pg *PostgresStore) GetStopTimesByRoute(ctx context.Context, routeID string) ([]models.StopTime, error) {
+	query := `
+		SELECT ` + stopTimeColumns + `
+		FROM stop_times st
+		WHERE st.feed_version = ` + feedVersion + `
+		  AND st.trip_id IN (SELECT trip_id FROM trips WHERE feed_version = st.feed_version AND route_id = $2)
+		ORDER BY st.trip_id, st.stop_sequence
+	`
+	rows, err := pg.db.Query(ctx, query, versionArg(ctx), routeID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByName[models.StopTime])
+}
@@ -0,0 +1,70 @@
+package store
+
+import (
+	"context"
+
+	"github.com/Hajdudev/ecoDatabase/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// GetShape returns the points of a shape ordered by shape_pt_sequence.
+func (pg *PostgresStore) GetShape(ctx context.Context, shapeID string) ([]models.Shape, error) {
+	query := `
+		SELECT shape_id, shape_pt_lat, shape_pt_lon, shape_pt_sequence, shape_dist_traveled
+		FROM shapes
+		WHERE feed_version = ` + feedVersion + ` AND shape_id = $2
+		ORDER BY shape_pt_sequence
+	`
+	rows, err := pg.db.Query(ctx, query, versionArg(ctx), shapeID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByName[models.Shape])
+}
+
+// GetAllShapes returns every shape point ordered by shape and
+// shape_pt_sequence.
+func (pg *PostgresStore) GetAllShapes(ctx context.Context) ([]models.Shape, error) {
+	query := `
+		SELECT shape_id, shape_pt_lat, shape_pt_lon, shape_pt_sequence, shape_dist_traveled
+		FROM shapes
+		WHERE feed_version = ` + feedVersion + `
+		ORDER BY shape_id, shape_pt_sequence
+	`
+	rows, err := pg.db.Query(ctx, query, versionArg(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByName[models.Shape])
+}
+
+// GetShapeRoutes maps every shape_id used by a trip to the routes of the
+// trips using it.
+func (pg *PostgresStore) GetShapeRoutes(ctx context.Context) (map[string][]string, error) {
+	query := `
+		SELECT DISTINCT shape_id, route_id
+		FROM trips
+		WHERE feed_version = ` + feedVersion + ` AND shape_id <> ''
+		ORDER BY shape_id, route_id
+	`
+	rows, err := pg.db.Query(ctx, query, versionArg(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	routes := make(map[string][]string)
+	for rows.Next() {
+		var shapeID, routeID string
+		if err := rows.Scan(&shapeID, &routeID); err != nil {
+			return nil, err
+		}
+		routes[shapeID] = append(routes[shapeID], routeID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return routes, nil
+}
@@ -0,0 +1,455 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Hajdudev/ecoDatabase/internal/gtfs"
+	"github.com/Hajdudev/ecoDatabase/models"
+	_ "modernc.org/sqlite"
+)
+
+// sqliteDateLayout is how dates are stored in SQLite, which has no date
+// type. The layout sorts correctly as text.
+const sqliteDateLayout = "2006-01-02"
+
+// SQLiteStore serves an imported GTFS feed from a SQLite file. It uses the
+// same tables as PostgresStore and a pure-Go driver, so no C toolchain or
+// database server is needed.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+var _ DatabaseStore = (*SQLiteStore)(nil)
+
+// OpenSQLite opens the SQLite database at path, creating the file if it
+// does not exist. The database runs in WAL mode so that an import does
+// not block readers. Transactions take the write lock when they begin, so
+// two processes writing at once wait for each other instead of failing
+// when the first one commits.
+func OpenSQLite(path string) (*SQLiteStore, error) {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	dsn := "file:" + path + sep + "_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+// Close closes the database.
+func (s *SQLiteStore) Close() {
+	s.db.Close()
+}
+
+// jsonArray encodes ids for use with json_each, the SQLite counterpart of
+// textArray.
+func jsonArray(ids []string) string {
+	if ids == nil {
+		ids = []string{}
+	}
+	b, _ := json.Marshal(ids)
+	return string(b)
+}
+
+// sqliteTime scans the text SQLite stores dates and timestamps as. The
+// driver already turns columns declared as date or timestamp into
+// time.Time, so both forms are accepted.
+type sqliteTime struct {
+	t *time.Time
+}
+
+func (st sqliteTime) Scan(src any) error {
+	var s string
+	switch v := src.(type) {
+	case time.Time:
+		*st.t = v
+		return nil
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into a time", src)
+	}
+	for _, layout := range []string{sqliteDateLayout, time.DateTime, time.RFC3339Nano} {
+		if t, err := time.Parse(layout, s); err == nil {
+			*st.t = t
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid time %q", s)
+}
+
+// sqliteNullTime is sqliteTime for a nullable column; NULL leaves *t nil.
+type sqliteNullTime struct {
+	t **time.Time
+}
+
+func (st sqliteNullTime) Scan(src any) error {
+	if src == nil {
+		*st.t = nil
+		return nil
+	}
+	var t time.Time
+	if err := (sqliteTime{&t}).Scan(src); err != nil {
+		return err
+	}
+	*st.t = &t
+	return nil
+}
+
+// collect scans every row of a query with scan, closing rows.
+func collect[T any](rows *sql.Rows, err error, scan func(*sql.Rows, *T) error) ([]T, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []T
+	for rows.Next() {
+		var v T
+		if err := scan(rows, &v); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// The scan functions read the columns of stopColumns, routeColumns,
+// tripColumns and stopTimeColumns, in that order.
+
+func scanStop(rows *sql.Rows, s *models.Stop) error {
+	return rows.Scan(&s.StopID, &s.StopCode, &s.StopName, &s.StopDesc, &s.StopLat, &s.StopLon, &s.ZoneID, &s.StopURL,
+		&s.LocationType, &s.ParentStation, &s.StopTimezone, &s.WheelchairBoarding, &s.LevelID, &s.PlatformCode)
+}
+
+func scanRoute(rows *sql.Rows, r *models.Route) error {
+	return rows.Scan(&r.RouteID, &r.AgencyID, &r.RouteShortName, &r.RouteLongName, &r.RouteDescription, &r.RouteType,
+		&r.RouteURL, &r.RouteColor, &r.RouteTextColor, &r.RouteSortOrder)
+}
+
+func scanTrip(rows *sql.Rows, t *models.Trip) error {
+	return rows.Scan(&t.RouteID, &t.ServiceID, &t.TripID, &t.TripHeadsign, &t.TripShortName, &t.DirectionID, &t.BlockID,
+		&t.ShapeID, &t.WheelchairAccessible, &t.BikesAllowed)
+}
+
+func scanStopTime(rows *sql.Rows, st *models.StopTime) error {
+	return rows.Scan(&st.TripID, &st.ArrivalTime, &st.DepartureTime, &st.StopID, &st.StopSequence, &st.StopHeadsign,
+		&st.PickupType, &st.DropOffType, &st.ShapeDistTraveled, &st.Timepoint)
+}
+
+func scanShape(rows *sql.Rows, sh *models.Shape) error {
+	return rows.Scan(&sh.ShapeID, &sh.ShapePtLat, &sh.ShapePtLon, &sh.ShapePtSequence, &sh.ShapeDistTraveled)
+}
+
+func scanCalendar(rows *sql.Rows, c *models.Calendar) error {
+	return rows.Scan(&c.ServiceID, &c.Monday, &c.Tuesday, &c.Wednesday, &c.Thursday, &c.Friday, &c.Saturday, &c.Sunday,
+		sqliteTime{&c.StartDate}, sqliteTime{&c.EndDate})
+}
+
+func scanCalendarDate(rows *sql.Rows, cd *models.CalendarDate) error {
+	return rows.Scan(&cd.ServiceID, sqliteTime{&cd.Date}, &cd.ExceptionType)
+}
+
+// sqliteFeedVersion is feedVersion for SQLite: every query passes
+// versionArg as ?1 and numbers its own parameters from ?2.
+const sqliteFeedVersion = `coalesce(?1, (SELECT id FROM feed_versions WHERE active))`
+
+const calendarColumns = `service_id, monday, tuesday, wednesday, thursday, friday, saturday, sunday, start_date, end_date`
+
+const shapeColumns = `shape_id, shape_pt_lat, shape_pt_lon, shape_pt_sequence, shape_dist_traveled`
+
+func (s *SQLiteStore) GetUserByID(ctx context.Context, id string) (*models.User, error) {
+	query := "SELECT id, created_at, email, name, image, recent_rides FROM users WHERE id = ?"
+
+	var user models.User
+	var recentRides string
+	err := s.db.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		sqliteTime{&user.CreatedAt},
+		&user.Email,
+		&user.Name,
+		&user.Image,
+		&recentRides,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(recentRides), &user.RecentRides); err != nil {
+		return nil, fmt.Errorf("recent_rides: %w", err)
+	}
+	return &user, nil
+}
+
+func (s *SQLiteStore) GetStopInfo(ctx context.Context, stopID string) (*models.Stop, error) {
+	query := `
+		SELECT stop_id, stop_code, stop_name, stop_desc, stop_lat, stop_lon
+		FROM stops
+		WHERE feed_version = ` + sqliteFeedVersion + ` AND stop_id = ?2
+	`
+	var stop models.Stop
+	err := s.db.QueryRowContext(ctx, query, versionArg(ctx), stopID).Scan(
+		&stop.StopID,
+		&stop.StopCode,
+		&stop.StopName,
+		&stop.StopDesc,
+		&stop.StopLat,
+		&stop.StopLon,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &stop, nil
+}
+
+// ResolveStops gathers the same candidates as PostgresStore.ResolveStops.
+func (s *SQLiteStore) ResolveStops(ctx context.Context, key string) ([]models.Stop, error) {
+	query := `
+		WITH version AS (
+			SELECT ` + sqliteFeedVersion + ` AS id
+		), matched AS (
+			SELECT stop_id FROM stops
+			WHERE feed_version = (SELECT id FROM version)
+			  AND (stop_id = ?2 OR stop_code = ?2 OR stop_name = ?2)
+		)
+		SELECT ` + stopColumns + `
+		FROM stops
+		WHERE feed_version = (SELECT id FROM version)
+		  AND (stop_id IN (SELECT stop_id FROM matched)
+		   OR parent_station IN (SELECT stop_id FROM matched)
+		   OR parent_station = ?2)
+	`
+	rows, err := s.db.QueryContext(ctx, query, versionArg(ctx), key)
+	candidates, err := collect(rows, err, scanStop)
+	if err != nil {
+		return nil, err
+	}
+	return gtfs.ResolveStops(key, candidates), nil
+}
+
+func (s *SQLiteStore) GetActiveServices(ctx context.Context, date string) ([]string, error) {
+	day, err := gtfs.ParseDate(date)
+	if err != nil {
+		return nil, err
+	}
+	d := day.Format(sqliteDateLayout)
+
+	query := `SELECT ` + calendarColumns + ` FROM calendar WHERE feed_version = ` + sqliteFeedVersion + ` AND start_date <= ?2 AND end_date >= ?2`
+	rows, err := s.db.QueryContext(ctx, query, versionArg(ctx), d)
+	calendars, err := collect(rows, err, scanCalendar)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `SELECT service_id, date, exception_type FROM calendar_dates WHERE feed_version = ` + sqliteFeedVersion + ` AND date = ?2`
+	rows, err = s.db.QueryContext(ctx, query, versionArg(ctx), d)
+	exceptions, err := collect(rows, err, scanCalendarDate)
+	if err != nil {
+		return nil, err
+	}
+
+	return gtfs.ActiveServices(day, calendars, exceptions), nil
+}
+
+func (s *SQLiteStore) GetServiceCalendar(ctx context.Context, serviceID string) ([]models.Calendar, []models.CalendarDate, error) {
+	query := `SELECT ` + calendarColumns + ` FROM calendar WHERE feed_version = ` + sqliteFeedVersion + ` AND service_id = ?2`
+	rows, err := s.db.QueryContext(ctx, query, versionArg(ctx), serviceID)
+	calendars, err := collect(rows, err, scanCalendar)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	query = `SELECT service_id, date, exception_type FROM calendar_dates WHERE feed_version = ` + sqliteFeedVersion + ` AND service_id = ?2`
+	rows, err = s.db.QueryContext(ctx, query, versionArg(ctx), serviceID)
+	exceptions, err := collect(rows, err, scanCalendarDate)
+	if err != nil {
+		return nil, nil, err
+	}
+	return calendars, exceptions, nil
+}
+
+// GetStopsNames returns one marker per stop name. SQLite has no DISTINCT
+// ON; a bare column in a GROUP BY query takes its value from any row of
+// the group, which matches what the Postgres query promises.
+func (s *SQLiteStore) GetStopsNames(ctx context.Context) ([]models.Marker, error) {
+	query := `SELECT stop_name, stop_lat, stop_lon FROM stops WHERE feed_version = ` + sqliteFeedVersion + ` GROUP BY stop_name`
+	rows, err := s.db.QueryContext(ctx, query, versionArg(ctx))
+	return collect(rows, err, func(rows *sql.Rows, m *models.Marker) error {
+		return rows.Scan(&m.Name, &m.Lat, &m.Lon)
+	})
+}
+
+func (s *SQLiteStore) GetAllStops(ctx context.Context) ([]models.Stop, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+stopColumns+` FROM stops WHERE feed_version = `+sqliteFeedVersion, versionArg(ctx))
+	return collect(rows, err, scanStop)
+}
+
+func (s *SQLiteStore) GetStopsByID(ctx context.Context, ids []string) ([]models.Stop, error) {
+	query := `SELECT ` + stopColumns + ` FROM stops WHERE feed_version = ` + sqliteFeedVersion + ` AND stop_id IN (SELECT value FROM json_each(?2))`
+	rows, err := s.db.QueryContext(ctx, query, versionArg(ctx), jsonArray(ids))
+	return collect(rows, err, scanStop)
+}
+
+func (s *SQLiteStore) GetStopDepartureCounts(ctx context.Context) (map[string]int, error) {
+	query := `SELECT stop_id, count(*) FROM stop_times WHERE feed_version = ` + sqliteFeedVersion + ` GROUP BY stop_id`
+	rows, err := s.db.QueryContext(ctx, query, versionArg(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var stopID string
+		var count int
+		if err := rows.Scan(&stopID, &count); err != nil {
+			return nil, err
+		}
+		counts[stopID] = count
+	}
+	return counts, rows.Err()
+}
+
+func (s *SQLiteStore) GetTripsByService(ctx context.Context, serviceIDs []string) ([]models.Trip, error) {
+	query := `SELECT ` + tripColumns + ` FROM trips WHERE feed_version = ` + sqliteFeedVersion + ` AND service_id IN (SELECT value FROM json_each(?2))`
+	rows, err := s.db.QueryContext(ctx, query, versionArg(ctx), jsonArray(serviceIDs))
+	return collect(rows, err, scanTrip)
+}
+
+func (s *SQLiteStore) GetStopTimesByService(ctx context.Context, serviceIDs []string) ([]models.StopTime, error) {
+	query := `
+		SELECT ` + stopTimeColumns + `
+		FROM stop_times st
+		WHERE st.feed_version = ` + sqliteFeedVersion + `
+		  AND st.trip_id IN (
+			SELECT trip_id FROM trips
+			WHERE feed_version = st.feed_version AND service_id IN (SELECT value FROM json_each(?2))
+		  )
+		ORDER BY st.trip_id, st.stop_sequence
+	`
+	rows, err := s.db.QueryContext(ctx, query, versionArg(ctx), jsonArray(serviceIDs))
+	return collect(rows, err, scanStopTime)
+}
+
+func (s *SQLiteStore) GetStopTimesAfterMidnight(ctx context.Context, serviceIDs []string) ([]models.StopTime, error) {
+	query := `
+		SELECT ` + stopTimeColumns + `
+		FROM stop_times st
+		WHERE st.feed_version = ` + sqliteFeedVersion + `
+		  AND st.trip_id IN (
+			SELECT s.trip_id
+			FROM stop_times s
+			JOIN trips t ON t.feed_version = s.feed_version AND t.trip_id = s.trip_id
+			WHERE s.feed_version = st.feed_version
+			  AND t.service_id IN (SELECT value FROM json_each(?2)) AND s.arrival_time >= '24:00:00'
+		  )
+		ORDER BY st.trip_id, st.stop_sequence
+	`
+	rows, err := s.db.QueryContext(ctx, query, versionArg(ctx), jsonArray(serviceIDs))
+	return collect(rows, err, scanStopTime)
+}
+
+func (s *SQLiteStore) GetStopTimesByTrip(ctx context.Context, tripID string) ([]models.StopTime, error) {
+	query := `SELECT ` + stopTimeColumns + ` FROM stop_times WHERE feed_version = ` + sqliteFeedVersion + ` AND trip_id = ?2 ORDER BY stop_sequence`
+	rows, err := s.db.QueryContext(ctx, query, versionArg(ctx), tripID)
+	return collect(rows, err, scanStopTime)
+}
+
+func (s *SQLiteStore) GetStopTimesByTrips(ctx context.Context, tripIDs []string) ([]models.StopTime, error) {
+	query := `SELECT ` + stopTimeColumns + ` FROM stop_times WHERE feed_version = ` + sqliteFeedVersion + ` AND trip_id IN (SELECT value FROM json_each(?2)) ORDER BY trip_id, stop_sequence`
+	rows, err := s.db.QueryContext(ctx, query, versionArg(ctx), jsonArray(tripIDs))
+	return collect(rows, err, scanStopTime)
+}
+
+func (s *SQLiteStore) GetTripsByID(ctx context.Context, ids []string) ([]models.Trip, error) {
+	query := `SELECT ` + tripColumns + ` FROM trips WHERE feed_version = ` + sqliteFeedVersion + ` AND trip_id IN (SELECT value FROM json_each(?2))`
+	rows, err := s.db.QueryContext(ctx, query, versionArg(ctx), jsonArray(ids))
+	return collect(rows, err, scanTrip)
+}
+
+func (s *SQLiteStore) GetAllRoutes(ctx context.Context) ([]models.Route, error) {
+	query := `
+		SELECT ` + routeColumns + `
+		FROM routes
+		WHERE feed_version = ` + sqliteFeedVersion + `
+		ORDER BY route_sort_order, route_short_name, route_id
+	`
+	rows, err := s.db.QueryContext(ctx, query, versionArg(ctx))
+	return collect(rows, err, scanRoute)
+}
+
+func (s *SQLiteStore) GetRoutesByID(ctx context.Context, ids []string) ([]models.Route, error) {
+	query := `SELECT ` + routeColumns + ` FROM routes WHERE feed_version = ` + sqliteFeedVersion + ` AND route_id IN (SELECT value FROM json_each(?2))`
+	rows, err := s.db.QueryContext(ctx, query, versionArg(ctx), jsonArray(ids))
+	return collect(rows, err, scanRoute)
+}
+
+func (s *SQLiteStore) GetTripsByRoute(ctx context.Context, routeID string) ([]models.Trip, error) {
+	query := `SELECT ` + tripColumns + ` FROM trips WHERE feed_version = ` + sqliteFeedVersion + ` AND route_id = ?2`
+	rows, err := s.db.QueryContext(ctx, query, versionArg(ctx), routeID)
+	return collect(rows, err, scanTrip)
+}
+
+func (s *SQLiteStore) GetStopTimesByRoute(ctx context.Context, routeID string) ([]models.StopTime, error) {
+	query := `
+		SELECT ` + stopTimeColumns + `
+		FROM stop_times st
+		WHERE st.feed_version = ` + sqliteFeedVersion + `
+		  AND st.trip_id IN (SELECT trip_id FROM trips WHERE feed_version = st.feed_version AND route_id = ?2)
+		ORDER BY st.trip_id, st.stop_sequence
+	`
+	rows, err := s.db.QueryContext(ctx, query, versionArg(ctx), routeID)
+	return collect(rows, err, scanStopTime)
+}
+
+func (s *SQLiteStore) GetShape(ctx context.Context, shapeID string) ([]models.Shape, error) {
+	query := `SELECT ` + shapeColumns + ` FROM shapes WHERE feed_version = ` + sqliteFeedVersion + ` AND shape_id = ?2 ORDER BY shape_pt_sequence`
+	rows, err := s.db.QueryContext(ctx, query, versionArg(ctx), shapeID)
+	return collect(rows, err, scanShape)
+}
+
+func (s *SQLiteStore) GetAllShapes(ctx context.Context) ([]models.Shape, error) {
+	query := `SELECT ` + shapeColumns + ` FROM shapes WHERE feed_version = ` + sqliteFeedVersion + ` ORDER BY shape_id, shape_pt_sequence`
+	rows, err := s.db.QueryContext(ctx, query, versionArg(ctx))
+	return collect(rows, err, scanShape)
+}
+
+func (s *SQLiteStore) GetShapeRoutes(ctx context.Context) (map[string][]string, error) {
+	query := `
+		SELECT DISTINCT shape_id, route_id
+		FROM trips
+		WHERE feed_version = ` + sqliteFeedVersion + ` AND shape_id <> ''
+		ORDER BY shape_id, route_id
+	`
+	rows, err := s.db.QueryContext(ctx, query, versionArg(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	routes := make(map[string][]string)
+	for rows.Next() {
+		var shapeID, routeID string
+		if err := rows.Scan(&shapeID, &routeID); err != nil {
+			return nil, err
+		}
+		routes[shapeID] = append(routes[shapeID], routeID)
+	}
+	return routes, rows.Err()
+}
@@ -0,0 +1,45 @@
+package store
+
+import (
+	"context"
+
+	"github.com/Hajdudev/ecoDatabase/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// GetStopsByID returns the stops with the given ids; unknown ids are skipped.
+func (pg *PostgresStore) GetStopsByID(ctx context.Context, ids []string) ([]models.Stop, error) {
+	query := `SELECT ` + stopColumns + ` FROM stops WHERE feed_version = ` + feedVersion + ` AND stop_id = ANY($2)`
+	rows, err := pg.db.Query(ctx, query, versionArg(ctx), textArray(ids))
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByName[models.Stop])
+}
+
+// GetStopDepartureCounts returns the number of stop_times rows per stop_id,
+// a cheap measure of how busy a stop is.
+func (pg *PostgresStore) GetStopDepartureCounts(ctx context.Context) (map[string]int, error) {
+	query := `SELECT stop_id, count(*) FROM stop_times WHERE feed_version = ` + feedVersion + ` GROUP BY stop_id`
+	rows, err := pg.db.Query(ctx, query, versionArg(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var stopID string
+		var count int
+		if err := rows.Scan(&stopID, &count); err != nil {
+			return nil, err
+		}
+		counts[stopID] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,503 @@
+package store
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Hajdudev/ecoDatabase/internal/gtfs"
+	"github.com/Hajdudev/ecoDatabase/models"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// testFeed zips testdata/feed into a temporary file, with the files of
+// overrides added or replaced, and opens it.
+func testFeed(t *testing.T, overrides map[string]string) *gtfs.Feed {
+	t.Helper()
+	entries, err := os.ReadDir(filepath.Join("testdata", "feed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	for _, e := range entries {
+		b, err := os.ReadFile(filepath.Join("testdata", "feed", e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[e.Name()] = string(b)
+	}
+	for name, content := range overrides {
+		files[name] = content
+	}
+
+	path := filepath.Join(t.TempDir(), "feed.zip")
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(out)
+	// Sorted, so that the same files always give the same hash.
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(w, files[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	feed, err := gtfs.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { feed.Close() })
+	return feed
+}
+
+func discardLogger() *log.Logger {
+	return log.New(io.Discard, "", 0)
+}
+
+// testStores returns the DatabaseStore implementations to run the
+// conformance suite against, each holding the testdata/feed fixture, with
+// the context to query them with. Postgres is only tested when
+// TEST_DATABASE_URL names a database the tests may import into.
+func testStores(t *testing.T) map[string]func(t *testing.T) (context.Context, DatabaseStore) {
+	stores := map[string]func(t *testing.T) (context.Context, DatabaseStore){
+		"memory": func(t *testing.T) (context.Context, DatabaseStore) {
+			m, err := LoadMemoryStore(testFeed(t, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return context.Background(), m
+		},
+		"sqlite": func(t *testing.T) (context.Context, DatabaseStore) {
+			db := migratedSQLite(t)
+			importVersions(t, db, "fixture")
+			return context.Background(), db
+		},
+		"postgres": func(t *testing.T) (context.Context, DatabaseStore) {
+			dsn := os.Getenv("TEST_DATABASE_URL")
+			if dsn == "" {
+				t.Skip("TEST_DATABASE_URL is not set")
+			}
+			ctx := context.Background()
+			pool, err := pgxpool.New(ctx, dsn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			db := NewPostgresStore(pool)
+			t.Cleanup(db.Close)
+			if _, err := MigrateUp(ctx, db); err != nil {
+				t.Fatal(err)
+			}
+
+			// The database may be shared, so the fixture goes in as its own
+			// inactive version, which is queried by id and deleted after.
+			version := fmt.Sprintf("test-%d", time.Now().UnixNano())
+			v, err := db.ImportFeed(ctx, testFeed(t, feedInfo(version)), discardLogger())
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { db.DeleteFeedVersion(context.Background(), v.ID) })
+			return gtfs.WithFeedVersion(ctx, v.ID), db
+		},
+	}
+	return stores
+}
+
+func stopIDsOf(stops []models.Stop) []string {
+	ids := []string{}
+	for _, s := range stops {
+		ids = append(ids, s.StopID)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func tripIDsOf(trips []models.Trip) []string {
+	ids := []string{}
+	for _, tr := range trips {
+		ids = append(ids, tr.TripID)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func routeIDsOf(routes []models.Route) []string {
+	ids := []string{}
+	for _, r := range routes {
+		ids = append(ids, r.RouteID)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// stopTimesOf describes stop times as trip/sequence/stop/departure, in the
+// order they were returned.
+func stopTimesOf(stopTimes []models.StopTime) []string {
+	out := []string{}
+	for _, st := range stopTimes {
+		out = append(out, fmt.Sprintf("%s/%d/%s/%s", st.TripID, st.StopSequence, st.StopID, st.DepartureTime))
+	}
+	return out
+}
+
+func TestDatabaseStore(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(ctx context.Context, s DatabaseStore) (any, error)
+		want any
+	}{
+		{
+			name: "services on a weekday",
+			run: func(ctx context.Context, s DatabaseStore) (any, error) {
+				return s.GetActiveServices(ctx, "2025-03-04")
+			},
+			want: []string{"WK"},
+		},
+		{
+			name: "services on a holiday",
+			run: func(ctx context.Context, s DatabaseStore) (any, error) {
+				return s.GetActiveServices(ctx, "20250303")
+			},
+			want: []string{"WE"},
+		},
+		{
+			name: "services outside the calendar",
+			run: func(ctx context.Context, s DatabaseStore) (any, error) {
+				return s.GetActiveServices(ctx, "2026-01-05")
+			},
+			want: []string{},
+		},
+		{
+			name: "service calendar",
+			run: func(ctx context.Context, s DatabaseStore) (any, error) {
+				calendars, exceptions, err := s.GetServiceCalendar(ctx, "WK")
+				if err != nil || len(calendars) != 1 || len(exceptions) != 1 {
+					return fmt.Sprintf("%d calendars, %d exceptions", len(calendars), len(exceptions)), err
+				}
+				c, e := calendars[0], exceptions[0]
+				return fmt.Sprintf("%s %v %v %s-%s, %s %s %d", c.ServiceID, c.Monday, c.Saturday,
+					c.StartDate.Format("20060102"), c.EndDate.Format("20060102"),
+					e.ServiceID, e.Date.Format("20060102"), e.ExceptionType), nil
+			},
+			want: "WK true false 20250101-20251231, WK 20250303 2",
+		},
+		{
+			name: "stop info",
+			run: func(ctx context.Context, s DatabaseStore) (any, error) {
+				stop, err := s.GetStopInfo(ctx, "A1")
+				if err != nil {
+					return nil, err
+				}
+				return fmt.Sprintf("%s %s %s %g,%g", stop.StopID, stop.StopName, stop.StopCode, stop.StopLat, stop.StopLon), nil
+			},
+			want: "A1 Central 100 48.1,17.1",
+		},
+		{
+			name: "unknown stop",
+			run: func(ctx context.Context, s DatabaseStore) (any, error) {
+				_, err := s.GetStopInfo(ctx, "NOPE")
+				return err != nil, nil
+			},
+			want: true,
+		},
+		{
+			name: "resolve station",
+			run: func(ctx context.Context, s DatabaseStore) (any, error) {
+				stops, err := s.ResolveStops(ctx, "ST")
+				return stopIDsOf(stops), err
+			},
+			want: []string{"A1", "A2"},
+		},
+		{
+			name: "resolve code",
+			run: func(ctx context.Context, s DatabaseStore) (any, error) {
+				stops, err := s.ResolveStops(ctx, "200")
+				return stopIDsOf(stops), err
+			},
+			want: []string{"B"},
+		},
+		{
+			name: "resolve name",
+			run: func(ctx context.Context, s DatabaseStore) (any, error) {
+				stops, err := s.ResolveStops(ctx, "Central")
+				return stopIDsOf(stops), err
+			},
+			want: []string{"A1", "A2"},
+		},
+		{
+			name: "resolve nothing",
+			run: func(ctx context.Context, s DatabaseStore) (any, error) {
+				stops, err := s.ResolveStops(ctx, "Nowhere")
+				return stopIDsOf(stops), err
+			},
+			want: []string{},
+		},
+		{
+			name: "stop names",
+			run: func(ctx context.Context, s DatabaseStore) (any, error) {
+				markers, err := s.GetStopsNames(ctx)
+				names := []string{}
+				for _, m := range markers {
+					names = append(names, m.Name)
+				}
+				slices.Sort(names)
+				return names, err
+			},
+			want: []string{"Castle", "Central", "Market", "Middle"},
+		},
+		{
+			name: "all stops",
+			run: func(ctx context.Context, s DatabaseStore) (any, error) {
+				stops, err := s.GetAllStops(ctx)
+				return stopIDsOf(stops), err
+			},
+			want: []string{"A1", "A2", "B", "C", "M", "ST"},
+		},
+		{
+			name: "stop details",
+			run: func(ctx context.Context, s DatabaseStore) (any, error) {
+				stops, err := s.GetStopsByID(ctx, []string{"A1"})
+				if err != nil || len(stops) != 1 {
+					return len(stops), err
+				}
+				stop := stops[0]
+				return fmt.Sprintf("%s %d %s %s", stop.StopID, stop.LocationType, stop.ParentStation, stop.PlatformCode), nil
+			},
+			want: "A1 0 ST 1",
+		},
+		{
+			name: "stops by id",
+			run: func(ctx context.Context, s DatabaseStore) (any, error) {
+				stops, err := s.GetStopsByID(ctx, []string{"B", "A1", "B", "NOPE"})
+				return stopIDsOf(stops), err
+			},
+			want: []string{"A1", "B"},
+		},
+		{
+			name: "departure counts",
+			run: func(ctx context.Context, s DatabaseStore) (any, error) {
+				return s.GetStopDepartureCounts(ctx)
+			},
+			want: map[string]int{"A1": 3, "A2": 1, "B": 3, "C": 1, "M": 2},
+		},
+		{
+			name: "trips by service",
+			run: func(ctx context.Context, s DatabaseStore) (any, error) {
+				trips, err := s.GetTripsByService(ctx, []string{"WK", "WE", "WK"})
+				return tripIDsOf(trips), err
+			},
+			want: []string{"T1", "T2", "T3", "T4"},
+		},
+		{
+			name: "trips without services",
+			run: func(ctx context.Context, s DatabaseStore) (any, error) {
+				trips, err := s.GetTripsByService(ctx, nil)
+				return tripIDsOf(trips), err
+			},
+			want: []string{},
+		},
+		{
+			name: "stop times by service",
+			run: func(ctx context.Context, s DatabaseStore) (any, error) {
+				stopTimes, err := s.GetStopTimesByService(ctx, []string{"WK"})
+				return stopTimesOf(stopTimes), err
+			},
+			want: []string{
+				"T1/1/A1/08:00:00", "T1/2/M/08:05:00", "T1/3/B/08:10:00",
+				"T2/1/A1/23:50:00", "T2/2/B/24:10:00",
+				"T4/1/B/10:00:00", "T4/2/M/10:05:00", "T4/3/A1/10:10:00",
+			},
+		},
+		{
+			name: "stop times after midnight",
+			run: func(ctx context.Context, s DatabaseStore) (any, error) {
+				stopTimes, err := s.GetStopTimesAfterMidnight(ctx, []string{"WK", "WE"})
+				return stopTimesOf(stopTimes), err
+			},
+			want: []string{"T2/1/A1/23:50:00", "T2/2/B/24:10:00"},
+		},
+		{
+			name: "trips by id",
+			run: func(ctx context.Context, s DatabaseStore) (any, error) {
+				trips, err := s.GetTripsByID(ctx, []string{"T3", "T1", "T3", "NOPE"})
+				return tripIDsOf(trips), err
+			},
+			want: []string{"T1", "T3"},
+		},
+		{
+			name: "trip details",
+			run: func(ctx context.Context, s DatabaseStore) (any, error) {
+				trips, err := s.GetTripsByID(ctx, []string{"T4"})
+				if err != nil || len(trips) != 1 {
+					return len(trips), err
+				}
+				tr := trips[0]
+				return fmt.Sprintf("%s %s %s %d %q", tr.RouteID, tr.ServiceID, tr.TripHeadsign, tr.DirectionID, tr.ShapeID), nil
+			},
+			want: `R1 WK Central 1 ""`,
+		},
+		{
+			name: "stop times by trip",
+			run: func(ctx context.Context, s DatabaseStore) (any, error) {
+				stopTimes, err := s.GetStopTimesByTrip(ctx, "T4")
+				return stopTimesOf(stopTimes), err
+			},
+			want: []string{"T4/1/B/10:00:00", "T4/2/M/10:05:00", "T4/3/A1/10:10:00"},
+		},
+		{
+			name: "stop times by trips",
+			run: func(ctx context.Context, s DatabaseStore) (any, error) {
+				stopTimes, err := s.GetStopTimesByTrips(ctx, []string{"T4", "NOPE", "T2", "T4"})
+				return stopTimesOf(stopTimes), err
+			},
+			want: []string{"T2/1/A1/23:50:00", "T2/2/B/24:10:00", "T4/1/B/10:00:00", "T4/2/M/10:05:00", "T4/3/A1/10:10:00"},
+		},
+		{
+			name: "routes by id",
+			run: func(ctx context.Context, s DatabaseStore) (any, error) {
+				routes, err := s.GetRoutesByID(ctx, []string{"R2", "NOPE", "R2"})
+				return routeIDsOf(routes), err
+			},
+			want: []string{"R2"},
+		},
+		{
+			name: "all routes",
+			run: func(ctx context.Context, s DatabaseStore) (any, error) {
+				routes, err := s.GetAllRoutes(ctx)
+				var out []string
+				for _, r := range routes {
+					out = append(out, fmt.Sprintf("%s %s %d %s", r.RouteID, r.RouteShortName, r.RouteType, r.RouteColor))
+				}
+				slices.Sort(out)
+				return out, err
+			},
+			want: []string{"R1 1 3 FF0000", "R2 2 0 00FF00"},
+		},
+		{
+			name: "trips by route",
+			run: func(ctx context.Context, s DatabaseStore) (any, error) {
+				trips, err := s.GetTripsByRoute(ctx, "R1")
+				return tripIDsOf(trips), err
+			},
+			want: []string{"T1", "T2", "T4"},
+		},
+		{
+			name: "stop times by route",
+			run: func(ctx context.Context, s DatabaseStore) (any, error) {
+				stopTimes, err := s.GetStopTimesByRoute(ctx, "R2")
+				return stopTimesOf(stopTimes), err
+			},
+			want: []string{"T3/1/A2/09:00:00", "T3/2/C/09:20:00"},
+		},
+		{
+			name: "shape",
+			run: func(ctx context.Context, s DatabaseStore) (any, error) {
+				points, err := s.GetShape(ctx, "S1")
+				var out []string
+				for _, p := range points {
+					out = append(out, fmt.Sprintf("%d %g,%g", p.ShapePtSequence, p.ShapePtLat, p.ShapePtLon))
+				}
+				return out, err
+			},
+			want: []string{"1 48.1,17.1", "2 48.15,17.15", "3 48.2,17.2"},
+		},
+		{
+			name: "all shapes",
+			run: func(ctx context.Context, s DatabaseStore) (any, error) {
+				points, err := s.GetAllShapes(ctx)
+				return len(points), err
+			},
+			want: 3,
+		},
+		{
+			name: "shape routes",
+			run: func(ctx context.Context, s DatabaseStore) (any, error) {
+				return s.GetShapeRoutes(ctx)
+			},
+			want: map[string][]string{"S1": {"R1"}},
+		},
+	}
+
+	stores := testStores(t)
+	for _, name := range slices.Sorted(maps.Keys(stores)) {
+		t.Run(name, func(t *testing.T) {
+			ctx, s := stores[name](t)
+			for _, tc := range tests {
+				t.Run(strings.ReplaceAll(tc.name, " ", "_"), func(t *testing.T) {
+					got, err := tc.run(ctx, s)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !reflect.DeepEqual(got, tc.want) {
+						t.Errorf("got %#v, want %#v", got, tc.want)
+					}
+				})
+			}
+		})
+	}
+}
+
+// TestDatabaseStoreFeedVersions checks that the database backends keep
+// feed versions apart: the context picks the version queried, and the
+// active one is used otherwise.
+func TestDatabaseStoreFeedVersions(t *testing.T) {
+	ctx := context.Background()
+	db := migratedSQLite(t)
+	ids := importVersions(t, db, "v1")
+	v2, err := db.ImportFeed(ctx, testFeed(t, map[string]string{
+		"feed_info.txt": feedInfo("v2")["feed_info.txt"],
+		"routes.txt":    "route_id,route_short_name,route_long_name,route_type\nR9,9,Elsewhere,3\n",
+	}), discardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		ctx  context.Context
+		want []string
+	}{
+		{ctx, []string{"R1", "R2"}},
+		{gtfs.WithFeedVersion(ctx, ids[0]), []string{"R1", "R2"}},
+		{gtfs.WithFeedVersion(ctx, v2.ID), []string{"R9"}},
+	} {
+		routes, err := db.GetAllRoutes(tc.ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := routeIDsOf(routes); !slices.Equal(got, tc.want) {
+			version, _ := gtfs.FeedVersion(tc.ctx)
+			t.Errorf("version %d: routes %v, want %v", version, got, tc.want)
+		}
+	}
+
+	if err := db.ActivateFeedVersion(ctx, v2.ID); err != nil {
+		t.Fatal(err)
+	}
+	routes, err := db.GetAllRoutes(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := routeIDsOf(routes); !slices.Equal(got, []string{"R9"}) {
+		t.Errorf("after activating version %d: routes %v", v2.ID, got)
+	}
+}
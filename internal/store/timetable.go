@@ -0,0 +1,135 @@
+package store
+
+import (
+	"context"
+
+	"github.com/Hajdudev/ecoDatabase/internal/gtfs"
+	"github.com/Hajdudev/ecoDatabase/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// textArray wraps ids for use as a text[] query parameter.
+func textArray(ids []string) *pgtype.Array[string] {
+	return &pgtype.Array[string]{
+		Elements: ids,
+		Dims:     []pgtype.ArrayDimension{{Length: int32(len(ids)), LowerBound: 1}},
+		Valid:    true,
+	}
+}
+
+// feedVersion selects the feed version every query reads: the one set
+// with gtfs.WithFeedVersion, always passed as $1 by versionArg, or else
+// the active one.
+const feedVersion = `coalesce($1::integer, (SELECT id FROM feed_versions WHERE active))`
+
+// versionArg returns the $1 argument of feedVersion.
+func versionArg(ctx context.Context) any {
+	if v, ok := gtfs.FeedVersion(ctx); ok {
+		return v
+	}
+	return nil
+}
+
+const stopColumns = `stop_id, stop_code, stop_name, stop_desc, stop_lat, stop_lon, zone_id, stop_url,
+	location_type, parent_station, stop_timezone, wheelchair_boarding, level_id, platform_code`
+
+const tripColumns = `route_id, service_id, trip_id, trip_headsign, trip_short_name, direction_id, block_id,
+	shape_id, wheelchair_accessible, bikes_allowed`
+
+const stopTimeColumns = `trip_id, arrival_time, departure_time, stop_id, stop_sequence, stop_headsign,
+	pickup_type, drop_off_type, shape_dist_traveled, timepoint`
+
+// GetAllStops returns every row of the stops table.
+func (pg *PostgresStore) GetAllStops(ctx context.Context) ([]models.Stop, error) {
+	rows, err := pg.db.Query(ctx, `SELECT `+stopColumns+` FROM stops WHERE feed_version = `+feedVersion, versionArg(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByName[models.Stop])
+}
+
+// GetTripsByService returns the trips that belong to any of serviceIDs.
+func (pg *PostgresStore) GetTripsByService(ctx context.Context, serviceIDs []string) ([]models.Trip, error) {
+	query := `SELECT ` + tripColumns + ` FROM trips WHERE feed_version = ` + feedVersion + ` AND service_id = ANY($2)`
+	rows, err := pg.db.Query(ctx, query, versionArg(ctx), textArray(serviceIDs))
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByName[models.Trip])
+}
+
+// GetStopTimesByService returns the stop times of every trip that belongs to
+// any of serviceIDs, ordered by trip and stop_sequence.
+func (pg *PostgresStore) GetStopTimesByService(ctx context.Context, serviceIDs []string) ([]models.StopTime, error) {
+	query := `
+		SELECT ` + stopTimeColumns + `
+		FROM stop_times st
+		WHERE st.feed_version = ` + feedVersion + `
+		  AND st.trip_id IN (
+			SELECT trip_id FROM trips WHERE feed_version = st.feed_version AND service_id = ANY($2)
+		  )
+		ORDER BY st.trip_id, st.stop_sequence
+	`
+	rows, err := pg.db.Query(ctx, query, versionArg(ctx), textArray(serviceIDs))
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByName[models.StopTime])
+}
+
+// GetStopTimesAfterMidnight returns the stop times of the trips of
+// serviceIDs that are still running at 24:00:00 or later, ordered by trip
+// and stop_sequence. The importer pads times to HH:MM:SS, so comparing
+// them as text is safe.
+func (pg *PostgresStore) GetStopTimesAfterMidnight(ctx context.Context, serviceIDs []string) ([]models.StopTime, error) {
+	query := `
+		SELECT ` + stopTimeColumns + `
+		FROM stop_times st
+		WHERE st.feed_version = ` + feedVersion + `
+		  AND st.trip_id IN (
+			SELECT s.trip_id
+			FROM stop_times s
+			JOIN trips t ON t.feed_version = s.feed_version AND t.trip_id = s.trip_id
+			WHERE s.feed_version = st.feed_version AND t.service_id = ANY($2) AND s.arrival_time >= '24:00:00'
+		  )
+		ORDER BY st.trip_id, st.stop_sequence
+	`
+	rows, err := pg.db.Query(ctx, query, versionArg(ctx), textArray(serviceIDs))
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByName[models.StopTime])
+}
+
+// GetStopTimesByTrip returns the stop times of one trip ordered by
+// stop_sequence.
+func (pg *PostgresStore) GetStopTimesByTrip(ctx context.Context, tripID string) ([]models.StopTime, error) {
+	query := `SELECT ` + stopTimeColumns + ` FROM stop_times WHERE feed_version = ` + feedVersion + ` AND trip_id = $2 ORDER BY stop_sequence`
+	rows, err := pg.db.Query(ctx, query, versionArg(ctx), tripID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByName[models.StopTime])
+}
+
+// GetStopTimesByTrips returns the stop times of several trips at once,
+// ordered by trip and stop_sequence; unknown ids are skipped.
+func (pg *PostgresStore) GetStopTimesByTrips(ctx context.Context, tripIDs []string) ([]models.StopTime, error) {
+	query := `SELECT ` + stopTimeColumns + ` FROM stop_times WHERE feed_version = ` + feedVersion + ` AND trip_id = ANY($2) ORDER BY trip_id, stop_sequence`
+	rows, err := pg.db.Query(ctx, query, versionArg(ctx), textArray(tripIDs))
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByName[models.StopTime])
+}
+
+// GetTripsByID returns the trips with the given ids; unknown ids are skipped.
+func (pg *PostgresStore) GetTripsByID(ctx context.Context, ids []string) ([]models.Trip, error) {
+	query := `SELECT ` + tripColumns + ` FROM trips WHERE feed_version = ` + feedVersion + ` AND trip_id = ANY($2)`
+	rows, err := pg.db.Query(ctx, query, versionArg(ctx), textArray(ids))
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByName[models.Trip])
+}
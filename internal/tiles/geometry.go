@@ -0,0 +1,109 @@
+package tiles
+
+import "math"
+
+// simplify reduces line with the Douglas-Peucker algorithm, keeping every
+// point further than tol from the simplified line.
+func simplify(line []vec, tol float64) []vec {
+	if len(line) < 3 {
+		return line
+	}
+
+	keep := make([]bool, len(line))
+	keep[0], keep[len(line)-1] = true, true
+
+	stack := [][2]int{{0, len(line) - 1}}
+	for len(stack) > 0 {
+		span := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		worst, worstDist := -1, tol
+		for i := span[0] + 1; i < span[1]; i++ {
+			if d := segmentDistance(line[i], line[span[0]], line[span[1]]); d > worstDist {
+				worst, worstDist = i, d
+			}
+		}
+		if worst >= 0 {
+			keep[worst] = true
+			stack = append(stack, [2]int{span[0], worst}, [2]int{worst, span[1]})
+		}
+	}
+
+	out := make([]vec, 0, len(line))
+	for i, p := range line {
+		if keep[i] {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// segmentDistance returns the distance from p to the segment ab.
+func segmentDistance(p, a, b vec) float64 {
+	dx, dy := b.x-a.x, b.y-a.y
+	t := 0.0
+	if length := dx*dx + dy*dy; length > 0 {
+		t = math.Max(0, math.Min(1, ((p.x-a.x)*dx+(p.y-a.y)*dy)/length))
+	}
+	return math.Hypot(p.x-(a.x+t*dx), p.y-(a.y+t*dy))
+}
+
+// clip cuts line to the rectangle, returning the parts inside it.
+func clip(line []vec, minX, minY, maxX, maxY float64) [][]vec {
+	var parts [][]vec
+	var current []vec
+	for i := 1; i < len(line); i++ {
+		a, b, ok := clipSegment(line[i-1], line[i], minX, minY, maxX, maxY)
+		if !ok {
+			if current != nil {
+				parts = append(parts, current)
+				current = nil
+			}
+			continue
+		}
+		if current == nil {
+			current = []vec{a}
+		}
+		current = append(current, b)
+		if b != line[i] {
+			// The segment leaves the rectangle.
+			parts = append(parts, current)
+			current = nil
+		}
+	}
+	if current != nil {
+		parts = append(parts, current)
+	}
+	return parts
+}
+
+// clipSegment clips the segment ab to the rectangle with the Liang-Barsky
+// algorithm.
+func clipSegment(a, b vec, minX, minY, maxX, maxY float64) (vec, vec, bool) {
+	dx, dy := b.x-a.x, b.y-a.y
+	t0, t1 := 0.0, 1.0
+	for _, edge := range [4][2]float64{
+		{-dx, a.x - minX},
+		{dx, maxX - a.x},
+		{-dy, a.y - minY},
+		{dy, maxY - a.y},
+	} {
+		p, q := edge[0], edge[1]
+		if p == 0 {
+			if q < 0 {
+				return a, b, false
+			}
+			continue
+		}
+		r := q / p
+		if p < 0 {
+			t0 = math.Max(t0, r)
+		} else {
+			t1 = math.Min(t1, r)
+		}
+		if t0 > t1 {
+			return a, b, false
+		}
+	}
+	return vec{a.x + t0*dx, a.y + t0*dy}, vec{a.x + t1*dx, a.y + t1*dy}, true
+}
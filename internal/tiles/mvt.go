@@ -0,0 +1,200 @@
+package tiles
+
+import (
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Extent is the size of a tile in tile coordinates.
+const Extent = 4096
+
+// Field numbers and enum values of the Mapbox Vector Tile 2.1 schema.
+const (
+	tileLayers = 3
+
+	layerVersion  = 15
+	layerName     = 1
+	layerFeatures = 2
+	layerKeys     = 3
+	layerValues   = 4
+	layerExtent   = 5
+
+	featureTags     = 2
+	featureType     = 3
+	featureGeometry = 4
+
+	valueString = 1
+	valueInt    = 4
+
+	typePoint      = 1
+	typeLineString = 2
+
+	cmdMoveTo = 1
+	cmdLineTo = 2
+)
+
+// point is a position in tile coordinates.
+type point struct {
+	x, y int
+}
+
+// property is a feature attribute; value is a string or an int.
+type property struct {
+	key   string
+	value any
+}
+
+type feature struct {
+	typ      uint64
+	tags     []uint32
+	geometry []uint32
+}
+
+// layer collects the features of one MVT layer, sharing the key and value
+// tables between them.
+type layer struct {
+	name       string
+	features   []feature
+	keys       []string
+	keyIndex   map[string]uint32
+	values     []any
+	valueIndex map[any]uint32
+}
+
+func newLayer(name string) *layer {
+	return &layer{
+		name:       name,
+		keyIndex:   make(map[string]uint32),
+		valueIndex: make(map[any]uint32),
+	}
+}
+
+func (l *layer) tags(props []property) []uint32 {
+	tags := make([]uint32, 0, 2*len(props))
+	for _, p := range props {
+		k, ok := l.keyIndex[p.key]
+		if !ok {
+			k = uint32(len(l.keys))
+			l.keyIndex[p.key] = k
+			l.keys = append(l.keys, p.key)
+		}
+		v, ok := l.valueIndex[p.value]
+		if !ok {
+			v = uint32(len(l.values))
+			l.valueIndex[p.value] = v
+			l.values = append(l.values, p.value)
+		}
+		tags = append(tags, k, v)
+	}
+	return tags
+}
+
+func (l *layer) addPoint(p point, props []property) {
+	l.features = append(l.features, feature{
+		typ:      typePoint,
+		tags:     l.tags(props),
+		geometry: []uint32{command(cmdMoveTo, 1), zigzag(p.x), zigzag(p.y)},
+	})
+}
+
+// addLines adds one feature made of the given parts. Repeated points are
+// dropped and parts left with fewer than two points are skipped.
+func (l *layer) addLines(parts [][]point, props []property) {
+	var geometry []uint32
+	var cursor point
+	for _, part := range parts {
+		part = dedupe(part)
+		if len(part) < 2 {
+			continue
+		}
+		geometry = append(geometry, command(cmdMoveTo, 1), zigzag(part[0].x-cursor.x), zigzag(part[0].y-cursor.y))
+		geometry = append(geometry, command(cmdLineTo, len(part)-1))
+		for i := 1; i < len(part); i++ {
+			geometry = append(geometry, zigzag(part[i].x-part[i-1].x), zigzag(part[i].y-part[i-1].y))
+		}
+		cursor = part[len(part)-1]
+	}
+	if geometry == nil {
+		return
+	}
+	l.features = append(l.features, feature{typ: typeLineString, tags: l.tags(props), geometry: geometry})
+}
+
+func dedupe(part []point) []point {
+	out := part[:0:0]
+	for i, p := range part {
+		if i == 0 || p != part[i-1] {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func command(id, count int) uint32 {
+	return uint32(id&0x7) | uint32(count)<<3
+}
+
+func zigzag(n int) uint32 {
+	v := int32(n)
+	return uint32((v << 1) ^ (v >> 31))
+}
+
+// encode serializes the non-empty layers as a vector tile.
+func encode(layers ...*layer) []byte {
+	var tile []byte
+	for _, l := range layers {
+		if len(l.features) == 0 {
+			continue
+		}
+		tile = protowire.AppendTag(tile, tileLayers, protowire.BytesType)
+		tile = protowire.AppendBytes(tile, l.encode())
+	}
+	return tile
+}
+
+func (l *layer) encode() []byte {
+	var b []byte
+	b = protowire.AppendTag(b, layerVersion, protowire.VarintType)
+	b = protowire.AppendVarint(b, 2)
+	b = protowire.AppendTag(b, layerName, protowire.BytesType)
+	b = protowire.AppendString(b, l.name)
+
+	for _, f := range l.features {
+		var fb []byte
+		fb = protowire.AppendTag(fb, featureTags, protowire.BytesType)
+		fb = protowire.AppendBytes(fb, packed(f.tags))
+		fb = protowire.AppendTag(fb, featureType, protowire.VarintType)
+		fb = protowire.AppendVarint(fb, f.typ)
+		fb = protowire.AppendTag(fb, featureGeometry, protowire.BytesType)
+		fb = protowire.AppendBytes(fb, packed(f.geometry))
+
+		b = protowire.AppendTag(b, layerFeatures, protowire.BytesType)
+		b = protowire.AppendBytes(b, fb)
+	}
+	for _, k := range l.keys {
+		b = protowire.AppendTag(b, layerKeys, protowire.BytesType)
+		b = protowire.AppendString(b, k)
+	}
+	for _, v := range l.values {
+		var vb []byte
+		switch v := v.(type) {
+		case string:
+			vb = protowire.AppendTag(vb, valueString, protowire.BytesType)
+			vb = protowire.AppendString(vb, v)
+		case int:
+			vb = protowire.AppendTag(vb, valueInt, protowire.VarintType)
+			vb = protowire.AppendVarint(vb, uint64(int64(v)))
+		}
+		b = protowire.AppendTag(b, layerValues, protowire.BytesType)
+		b = protowire.AppendBytes(b, vb)
+	}
+	b = protowire.AppendTag(b, layerExtent, protowire.VarintType)
+	return protowire.AppendVarint(b, Extent)
+}
+
+func packed(values []uint32) []byte {
+	var b []byte
+	for _, v := range values {
+		b = protowire.AppendVarint(b, uint64(v))
+	}
+	return b
+}
@@ -0,0 +1,327 @@
+// Package tiles renders Mapbox Vector Tiles of the stops and route shapes
+// in the store.
+package tiles
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/Hajdudev/ecoDatabase/internal/gtfs"
+	"github.com/Hajdudev/ecoDatabase/models"
+)
+
+const (
+	// MaxZoom is the deepest zoom level tiles are rendered for.
+	MaxZoom = 22
+
+	// buffer is how far in tile coordinates geometry extends past the tile
+	// edge, so lines and symbols are not cut off at tile borders.
+	buffer = 64
+
+	// Stations show up from stationZoom on and every stop from stopZoom on;
+	// below that the stops layer would be too dense to be useful.
+	stationZoom = 11
+	stopZoom    = 14
+
+	// tolerance is the Douglas-Peucker tolerance in tile coordinates.
+	tolerance = 8.0
+
+	// loadedVersions is how many feed versions keep their projected
+	// content: the active one and one being tried out.
+	loadedVersions = 2
+)
+
+// Source is the part of store.DatabaseStore tiles are built from.
+type Source interface {
+	GetAllStops(ctx context.Context) ([]models.Stop, error)
+	GetAllRoutes(ctx context.Context) ([]models.Route, error)
+	GetAllShapes(ctx context.Context) ([]models.Shape, error)
+	GetShapeRoutes(ctx context.Context) (map[string][]string, error)
+}
+
+// Tiler renders tiles on demand and keeps the most recent ones in memory.
+type Tiler struct {
+	source    Source
+	cacheSize int
+
+	// data holds the projected content of the most recently used feed
+	// versions, the oldest first.
+	loadMu sync.Mutex
+	data   []*data
+
+	mu    sync.Mutex
+	cache map[tileKey][]byte
+	order []tileKey
+	// generation counts Reset calls, so that a tile rendered from data
+	// loaded before a Reset is not cached after it.
+	generation int
+}
+
+// tileKey identifies a tile of a feed version. Version 0 stands for
+// stores without feed versions.
+type tileKey struct {
+	version, z, x, y int
+}
+
+// data is the store content of a feed version projected to web mercator,
+// where the world spans [0, 1] on both axes.
+type data struct {
+	version int
+	stops   []stop // sorted by x
+	shapes  []*shape
+}
+
+type stop struct {
+	x, y  float64
+	props []property
+	types int
+}
+
+type shape struct {
+	points                 []vec
+	minX, minY, maxX, maxY float64
+	props                  []property
+
+	mu         sync.Mutex
+	simplified map[int][]vec
+}
+
+type vec struct {
+	x, y float64
+}
+
+func New(source Source, cacheSize int) *Tiler {
+	return &Tiler{
+		source:    source,
+		cacheSize: cacheSize,
+		cache:     make(map[tileKey][]byte),
+	}
+}
+
+// Tile returns the encoded tile z/x/y of the feed version of ctx.
+func (t *Tiler) Tile(ctx context.Context, z, x, y int) ([]byte, error) {
+	if z < 0 || z > MaxZoom || x < 0 || y < 0 || x >= 1<<z || y >= 1<<z {
+		return nil, fmt.Errorf("tile %d/%d/%d out of range", z, x, y)
+	}
+	version, _ := gtfs.FeedVersion(ctx)
+	key := tileKey{version, z, x, y}
+
+	t.mu.Lock()
+	tile, ok := t.cache[key]
+	generation := t.generation
+	t.mu.Unlock()
+	if ok {
+		return tile, nil
+	}
+
+	d, err := t.load(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+	tile = d.render(z, x, y)
+
+	t.mu.Lock()
+	if _, ok := t.cache[key]; !ok && generation == t.generation {
+		t.cache[key] = tile
+		t.order = append(t.order, key)
+		if len(t.order) > t.cacheSize {
+			delete(t.cache, t.order[0])
+			t.order = t.order[1:]
+		}
+	}
+	t.mu.Unlock()
+	return tile, nil
+}
+
+// Reset drops the loaded store content and the rendered tiles, for when
+// another feed version becomes active. Both are kept per feed version, so
+// this only frees memory early.
+func (t *Tiler) Reset() {
+	t.loadMu.Lock()
+	t.data = nil
+	t.loadMu.Unlock()
+
+	t.mu.Lock()
+	t.cache = make(map[tileKey][]byte)
+	t.order = nil
+	t.generation++
+	t.mu.Unlock()
+}
+
+// load reads and projects the store content of version, the feed version
+// of ctx, on first use.
+func (t *Tiler) load(ctx context.Context, version int) (*data, error) {
+	t.loadMu.Lock()
+	defer t.loadMu.Unlock()
+
+	for i, d := range t.data {
+		if d.version == version {
+			t.data = append(slices.Delete(t.data, i, i+1), d)
+			return d, nil
+		}
+	}
+
+	stops, err := t.source.GetAllStops(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loading stops: %w", err)
+	}
+	routes, err := t.source.GetAllRoutes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loading routes: %w", err)
+	}
+	points, err := t.source.GetAllShapes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loading shapes: %w", err)
+	}
+	shapeRoutes, err := t.source.GetShapeRoutes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loading shape routes: %w", err)
+	}
+
+	d := &data{version: version}
+	for _, s := range stops {
+		if s.LocationType != gtfs.LocationStop && s.LocationType != gtfs.LocationStation {
+			continue
+		}
+		x, y := project(s.StopLat, s.StopLon)
+		d.stops = append(d.stops, stop{
+			x:     x,
+			y:     y,
+			types: s.LocationType,
+			props: []property{
+				{"stop_id", s.StopID},
+				{"stop_name", s.StopName},
+				{"location_type", s.LocationType},
+			},
+		})
+	}
+	sort.Slice(d.stops, func(a, b int) bool { return d.stops[a].x < d.stops[b].x })
+
+	routeByID := make(map[string]models.Route, len(routes))
+	for _, r := range routes {
+		routeByID[r.RouteID] = r
+	}
+
+	// points are ordered by shape and sequence; every route using a shape
+	// gets its own feature so it carries that route's colour.
+	for start := 0; start < len(points); {
+		end := start
+		for end < len(points) && points[end].ShapeID == points[start].ShapeID {
+			end++
+		}
+		line := make([]vec, end-start)
+		for i, p := range points[start:end] {
+			line[i].x, line[i].y = project(p.ShapePtLat, p.ShapePtLon)
+		}
+		for _, routeID := range shapeRoutes[points[start].ShapeID] {
+			r, ok := routeByID[routeID]
+			if !ok {
+				continue
+			}
+			d.shapes = append(d.shapes, newShape(line, []property{
+				{"shape_id", points[start].ShapeID},
+				{"route_id", r.RouteID},
+				{"route_short_name", r.RouteShortName},
+				{"route_color", r.RouteColor},
+				{"route_type", r.RouteType},
+			}))
+		}
+		start = end
+	}
+
+	if len(t.data) >= loadedVersions {
+		t.data = t.data[1:]
+	}
+	t.data = append(t.data, d)
+	return d, nil
+}
+
+func newShape(points []vec, props []property) *shape {
+	s := &shape{
+		points:     points,
+		minX:       math.Inf(1),
+		minY:       math.Inf(1),
+		maxX:       math.Inf(-1),
+		maxY:       math.Inf(-1),
+		props:      props,
+		simplified: make(map[int][]vec),
+	}
+	for _, p := range points {
+		s.minX, s.maxX = math.Min(s.minX, p.x), math.Max(s.maxX, p.x)
+		s.minY, s.maxY = math.Min(s.minY, p.y), math.Max(s.maxY, p.y)
+	}
+	return s
+}
+
+// at returns the shape simplified for zoom z.
+func (s *shape) at(z int) []vec {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	line, ok := s.simplified[z]
+	if !ok {
+		line = simplify(s.points, tolerance/(Extent*float64(int(1)<<z)))
+		s.simplified[z] = line
+	}
+	return line
+}
+
+// project converts a WGS84 coordinate to web mercator in [0, 1].
+func project(lat, lon float64) (x, y float64) {
+	lat = math.Max(-85.05112878, math.Min(85.05112878, lat))
+	phi := lat * math.Pi / 180
+	x = (lon + 180) / 360
+	y = (1 - math.Log(math.Tan(phi)+1/math.Cos(phi))/math.Pi) / 2
+	return x, y
+}
+
+// render encodes tile z/x/y.
+func (d *data) render(z, x, y int) []byte {
+	scale := float64(int(1) << z)
+	pad := float64(buffer) / Extent / scale
+	minX, minY := float64(x)/scale-pad, float64(y)/scale-pad
+	maxX, maxY := float64(x+1)/scale+pad, float64(y+1)/scale+pad
+
+	toTile := func(v vec) point {
+		return point{
+			x: int(math.Round((v.x*scale - float64(x)) * Extent)),
+			y: int(math.Round((v.y*scale - float64(y)) * Extent)),
+		}
+	}
+
+	shapes := newLayer("shapes")
+	for _, s := range d.shapes {
+		if s.maxX < minX || s.minX > maxX || s.maxY < minY || s.minY > maxY {
+			continue
+		}
+		var parts [][]point
+		for _, part := range clip(s.at(z), minX, minY, maxX, maxY) {
+			tp := make([]point, len(part))
+			for i, v := range part {
+				tp[i] = toTile(v)
+			}
+			parts = append(parts, tp)
+		}
+		shapes.addLines(parts, s.props)
+	}
+
+	stops := newLayer("stops")
+	if z >= stationZoom {
+		first := sort.Search(len(d.stops), func(i int) bool { return d.stops[i].x >= minX })
+		for _, s := range d.stops[first:] {
+			if s.x > maxX {
+				break
+			}
+			if s.y < minY || s.y > maxY || (z < stopZoom && s.types != gtfs.LocationStation) {
+				continue
+			}
+			stops.addPoint(toTile(vec{s.x, s.y}), s.props)
+		}
+	}
+
+	return encode(shapes, stops)
+}
@@ -0,0 +1,337 @@
+package tiles
+
+import (
+	"context"
+	"math"
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Hajdudev/ecoDatabase/internal/gtfs"
+	"github.com/Hajdudev/ecoDatabase/models"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type decodedFeature struct {
+	typ      uint64
+	props    map[string]any
+	geometry []uint32
+}
+
+type decodedLayer struct {
+	extent   uint64
+	features []decodedFeature
+}
+
+// decodeTile parses an encoded tile into its layers by name, resolving the
+// feature tags against the key and value tables.
+func decodeTile(t *testing.T, b []byte) map[string]decodedLayer {
+	t.Helper()
+	layers := make(map[string]decodedLayer)
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 || num != tileLayers || typ != protowire.BytesType {
+			t.Fatalf("unexpected tile field %d", num)
+		}
+		b = b[n:]
+		lb, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			t.Fatal("truncated layer")
+		}
+		b = b[n:]
+		name, l := decodeLayer(t, lb)
+		layers[name] = l
+	}
+	return layers
+}
+
+func decodeLayer(t *testing.T, b []byte) (string, decodedLayer) {
+	t.Helper()
+	var (
+		name   string
+		l      decodedLayer
+		keys   []string
+		values []any
+		tags   [][]uint32
+	)
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatal("truncated layer field")
+		}
+		b = b[n:]
+		if typ == protowire.VarintType {
+			v, n := protowire.ConsumeVarint(b)
+			b = b[n:]
+			if num == layerExtent {
+				l.extent = v
+			}
+			continue
+		}
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			t.Fatal("truncated layer field")
+		}
+		b = b[n:]
+		switch num {
+		case layerName:
+			name = string(v)
+		case layerKeys:
+			keys = append(keys, string(v))
+		case layerValues:
+			values = append(values, decodeValue(t, v))
+		case layerFeatures:
+			f, ft := decodeFeature(t, v)
+			l.features = append(l.features, f)
+			tags = append(tags, ft)
+		}
+	}
+	for i, ft := range tags {
+		l.features[i].props = make(map[string]any)
+		for j := 0; j+1 < len(ft); j += 2 {
+			l.features[i].props[keys[ft[j]]] = values[ft[j+1]]
+		}
+	}
+	return name, l
+}
+
+func decodeFeature(t *testing.T, b []byte) (decodedFeature, []uint32) {
+	t.Helper()
+	var f decodedFeature
+	var tags []uint32
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		b = b[n:]
+		if typ == protowire.VarintType {
+			v, n := protowire.ConsumeVarint(b)
+			b = b[n:]
+			if num == featureType {
+				f.typ = v
+			}
+			continue
+		}
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			t.Fatal("truncated feature field")
+		}
+		b = b[n:]
+		var unpacked []uint32
+		for len(v) > 0 {
+			x, n := protowire.ConsumeVarint(v)
+			v = v[n:]
+			unpacked = append(unpacked, uint32(x))
+		}
+		switch num {
+		case featureTags:
+			tags = unpacked
+		case featureGeometry:
+			f.geometry = unpacked
+		}
+	}
+	return f, tags
+}
+
+func decodeValue(t *testing.T, b []byte) any {
+	t.Helper()
+	num, _, n := protowire.ConsumeTag(b)
+	b = b[n:]
+	switch num {
+	case valueString:
+		s, _ := protowire.ConsumeString(b)
+		return s
+	case valueInt:
+		v, _ := protowire.ConsumeVarint(b)
+		return int(int64(v))
+	}
+	t.Fatalf("unexpected value field %d", num)
+	return nil
+}
+
+func TestZigzag(t *testing.T) {
+	for n, want := range map[int]uint32{0: 0, -1: 1, 1: 2, -2: 3, 2: 4, 4095: 8190} {
+		if got := zigzag(n); got != want {
+			t.Errorf("zigzag(%d) = %d, want %d", n, got, want)
+		}
+	}
+}
+
+func TestLayerEncode(t *testing.T) {
+	l := newLayer("test")
+	l.addPoint(point{10, 20}, []property{{"name", "a"}, {"type", 3}})
+	l.addLines([][]point{
+		{{0, 0}, {0, 0}, {5, 5}},
+		{{7, 7}}, // too short, skipped
+		{{10, 10}, {12, 8}},
+	}, []property{{"name", "a"}})
+	// Nothing is left of these parts, so no feature is added.
+	l.addLines([][]point{{{1, 1}, {1, 1}}}, nil)
+
+	layers := decodeTile(t, encode(l, newLayer("empty")))
+	if len(layers) != 1 {
+		t.Fatalf("got %d layers, want only the non-empty one", len(layers))
+	}
+	got := layers["test"]
+	if got.extent != Extent {
+		t.Errorf("extent %d, want %d", got.extent, Extent)
+	}
+	if len(got.features) != 2 {
+		t.Fatalf("got %d features, want 2", len(got.features))
+	}
+
+	p := got.features[0]
+	if p.typ != typePoint || !slices.Equal(p.geometry, []uint32{9, 20, 40}) {
+		t.Errorf("point %d %v", p.typ, p.geometry)
+	}
+	if p.props["name"] != "a" || p.props["type"] != 3 {
+		t.Errorf("point props %v", p.props)
+	}
+
+	// The second part starts relative to the end of the first.
+	line := got.features[1]
+	want := []uint32{9, 0, 0, 10, 10, 10, 9, 10, 10, 10, 4, 3}
+	if line.typ != typeLineString || !slices.Equal(line.geometry, want) {
+		t.Errorf("line %d %v, want %v", line.typ, line.geometry, want)
+	}
+	if line.props["name"] != "a" {
+		t.Errorf("line props %v", line.props)
+	}
+}
+
+// fakeSource serves a station with one platform and an entrance, and a
+// shape running past them, for feed version 1. Other versions are empty.
+type fakeSource struct {
+	loads atomic.Int32
+}
+
+func (s *fakeSource) GetAllStops(ctx context.Context) ([]models.Stop, error) {
+	s.loads.Add(1)
+	if v, _ := gtfs.FeedVersion(ctx); v != 1 {
+		return nil, nil
+	}
+	return []models.Stop{
+		{StopID: "ST", StopName: "Central", LocationType: gtfs.LocationStation, StopLat: 48.1500, StopLon: 17.1300},
+		{StopID: "P1", StopName: "Central", LocationType: gtfs.LocationStop, StopLat: 48.1501, StopLon: 17.1301},
+		{StopID: "E1", StopName: "Central", LocationType: 2, StopLat: 48.1502, StopLon: 17.1302},
+	}, nil
+}
+
+func (s *fakeSource) GetAllRoutes(ctx context.Context) ([]models.Route, error) {
+	if v, _ := gtfs.FeedVersion(ctx); v != 1 {
+		return nil, nil
+	}
+	return []models.Route{{RouteID: "R1", RouteShortName: "1", RouteColor: "FF0000", RouteType: 3}}, nil
+}
+
+func (s *fakeSource) GetAllShapes(ctx context.Context) ([]models.Shape, error) {
+	if v, _ := gtfs.FeedVersion(ctx); v != 1 {
+		return nil, nil
+	}
+	return []models.Shape{
+		{ShapeID: "S1", ShapePtLat: 48.1490, ShapePtLon: 17.1290, ShapePtSequence: 1},
+		{ShapeID: "S1", ShapePtLat: 48.1500, ShapePtLon: 17.1300, ShapePtSequence: 2},
+		{ShapeID: "S1", ShapePtLat: 48.1510, ShapePtLon: 17.1310, ShapePtSequence: 3},
+	}, nil
+}
+
+func (s *fakeSource) GetShapeRoutes(ctx context.Context) (map[string][]string, error) {
+	// Routes missing from the feed are skipped.
+	return map[string][]string{"S1": {"R1", "MISSING"}}, nil
+}
+
+// tileAt returns the tile of zoom z containing the coordinate.
+func tileAt(z int, lat, lon float64) (x, y int) {
+	px, py := project(lat, lon)
+	scale := float64(int(1) << z)
+	return int(math.Floor(px * scale)), int(math.Floor(py * scale))
+}
+
+func stopIDs(l decodedLayer) []string {
+	var ids []string
+	for _, f := range l.features {
+		ids = append(ids, f.props["stop_id"].(string))
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func TestTile(t *testing.T) {
+	ctx := gtfs.WithFeedVersion(context.Background(), 1)
+	tiler := New(&fakeSource{}, 16)
+
+	tests := []struct {
+		z      int
+		stops  []string
+		shapes int
+	}{
+		{stopZoom, []string{"P1", "ST"}, 1},
+		{stationZoom, []string{"ST"}, 1},
+		{stationZoom - 1, nil, 1},
+	}
+	for _, tc := range tests {
+		x, y := tileAt(tc.z, 48.15, 17.13)
+		b, err := tiler.Tile(ctx, tc.z, x, y)
+		if err != nil {
+			t.Fatal(err)
+		}
+		layers := decodeTile(t, b)
+		if got := stopIDs(layers["stops"]); !slices.Equal(got, tc.stops) {
+			t.Errorf("z%d: stops %v, want %v", tc.z, got, tc.stops)
+		}
+		shapes := layers["shapes"].features
+		if len(shapes) != tc.shapes {
+			t.Fatalf("z%d: %d shapes, want %d", tc.z, len(shapes), tc.shapes)
+		}
+		if s := shapes[0]; s.typ != typeLineString || s.props["route_id"] != "R1" || s.props["route_type"] != 3 {
+			t.Errorf("z%d: shape %d %v", tc.z, s.typ, s.props)
+		}
+	}
+
+	// A tile elsewhere is empty.
+	if b, err := tiler.Tile(ctx, stopZoom, 0, 0); err != nil || len(b) != 0 {
+		t.Errorf("tile away from the feed: %d bytes, err %v", len(b), err)
+	}
+}
+
+func TestTileOutOfRange(t *testing.T) {
+	tiler := New(&fakeSource{}, 16)
+	for _, c := range [][3]int{{-1, 0, 0}, {MaxZoom + 1, 0, 0}, {2, 4, 0}, {2, 0, 4}, {2, -1, 0}} {
+		if _, err := tiler.Tile(context.Background(), c[0], c[1], c[2]); err == nil {
+			t.Errorf("tile %v rendered", c)
+		}
+	}
+}
+
+func TestTilePerFeedVersion(t *testing.T) {
+	source := &fakeSource{}
+	tiler := New(source, 16)
+	x, y := tileAt(stopZoom, 48.15, 17.13)
+	tile := func(version int) map[string]decodedLayer {
+		t.Helper()
+		b, err := tiler.Tile(gtfs.WithFeedVersion(context.Background(), version), stopZoom, x, y)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return decodeTile(t, b)
+	}
+
+	if len(tile(1)["stops"].features) == 0 {
+		t.Fatal("version 1 has no stops")
+	}
+	// The same tile of another version is rendered from that version.
+	if len(tile(2)) != 0 {
+		t.Error("version 2 got the tile of version 1")
+	}
+	if len(tile(1)["stops"].features) == 0 || len(tile(2)) != 0 {
+		t.Error("cached tiles mixed up the versions")
+	}
+	if n := source.loads.Load(); n != 2 {
+		t.Errorf("loaded %d times, want once per version", n)
+	}
+
+	// After a Reset the content is loaded again.
+	tiler.Reset()
+	tile(1)
+	if n := source.loads.Load(); n != 3 {
+		t.Errorf("loaded %d times after Reset, want 3", n)
+	}
+}
@@ -1,16 +1,43 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/Hajdudev/ecoDatabase/internal/app"
+	"github.com/Hajdudev/ecoDatabase/internal/gtfs"
 	"github.com/Hajdudev/ecoDatabase/internal/routes"
+	"github.com/Hajdudev/ecoDatabase/internal/store"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		var err error
+		switch os.Args[1] {
+		case "import":
+			err = runImport(os.Args[2:])
+		case "migrate":
+			err = runMigrate(os.Args[2:])
+		case "feeds":
+			err = runFeeds(os.Args[2:])
+		default:
+			err = fmt.Errorf("unknown command %q", os.Args[1])
+		}
+		// The commands return their errors instead of exiting, so that
+		// their deferred Close calls run first.
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	log.Print("starting server...")
 
 	application, err := app.NewApplication()
@@ -41,3 +68,171 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// runImport implements `main import [-activate=false] <gtfs.zip>`. The
+// feed is stored as a new feed version, which goes live unless -activate
+// is false.
+func runImport(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	activate := flags.Bool("activate", true, "make the imported feed version the active one")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return errors.New("usage: main import [-activate=false] <gtfs.zip>")
+	}
+	path := flags.Arg(0)
+
+	feed, err := gtfs.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open feed: %w", err)
+	}
+	defer feed.Close()
+
+	db, err := store.Open()
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
+	applied, err := store.MigrateUp(context.Background(), db)
+	if err != nil {
+		return fmt.Errorf("migrate failed: %w", err)
+	}
+	for _, m := range applied {
+		logger.Printf("migrate: applied %d_%s", m.Version, m.Name)
+	}
+
+	start := time.Now()
+	version, err := db.ImportFeed(context.Background(), feed, logger)
+	if err != nil {
+		return fmt.Errorf("import failed: %w", err)
+	}
+	logger.Printf("import of %s finished in %s as feed version %d", path, time.Since(start).Round(time.Millisecond), version.ID)
+
+	if *activate {
+		if err := db.ActivateFeedVersion(context.Background(), version.ID); err != nil {
+			return fmt.Errorf("activating feed version %d failed: %w", version.ID, err)
+		}
+		logger.Printf("feed version %d is now active", version.ID)
+	}
+	return nil
+}
+
+// runMigrate implements `main migrate up|down|status`.
+func runMigrate(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: main migrate up|down|status")
+	}
+
+	db, err := store.Open()
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		applied, err := store.MigrateUp(ctx, db)
+		for _, m := range applied {
+			log.Printf("applied %d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			return fmt.Errorf("migrate up failed: %w", err)
+		}
+		if len(applied) == 0 {
+			log.Print("schema is up to date")
+		}
+	case "down":
+		m, err := store.MigrateDown(ctx, db)
+		if err != nil {
+			return fmt.Errorf("migrate down failed: %w", err)
+		}
+		if m == nil {
+			log.Print("no migration to roll back")
+			return nil
+		}
+		log.Printf("rolled back %d_%s", m.Version, m.Name)
+	case "status":
+		statuses, err := store.MigrationStatuses(ctx, db)
+		if err != nil {
+			return fmt.Errorf("migrate status failed: %w", err)
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = "applied " + s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%s\t%s\n", s.Version, s.Name, applied)
+		}
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down or status", args[0])
+	}
+	return nil
+}
+
+// runFeeds implements `main feeds list|activate <id>|rollback|delete <id>`.
+func runFeeds(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: main feeds list|activate <id>|rollback|delete <id>")
+	}
+
+	db, err := store.Open()
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	switch args[0] {
+	case "list":
+		versions, err := db.FeedVersions(ctx)
+		if err != nil {
+			return fmt.Errorf("listing feed versions failed: %w", err)
+		}
+		for _, v := range versions {
+			validity := "-"
+			if v.StartDate != nil && v.EndDate != nil {
+				validity = v.StartDate.Format("2006-01-02") + ".." + v.EndDate.Format("2006-01-02")
+			}
+			active := ""
+			if v.Active {
+				active = "active"
+			}
+			fmt.Printf("%d\t%s\t%s\t%s\t%.12s\t%s\n", v.ID, v.ImportedAt.Format(time.RFC3339), validity, v.Source, v.Hash, active)
+		}
+	case "activate":
+		if len(args) != 2 {
+			return errors.New("usage: main feeds activate <id>")
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid feed version %q", args[1])
+		}
+		if err := db.ActivateFeedVersion(ctx, id); err != nil {
+			return fmt.Errorf("activating feed version %d failed: %w", id, err)
+		}
+		log.Printf("feed version %d is now active", id)
+	case "rollback":
+		v, err := store.RollbackFeedVersion(ctx, db)
+		if err != nil {
+			return fmt.Errorf("rollback failed: %w", err)
+		}
+		log.Printf("rolled back to feed version %d", v.ID)
+	case "delete":
+		if len(args) != 2 {
+			return errors.New("usage: main feeds delete <id>")
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid feed version %q", args[1])
+		}
+		if err := db.DeleteFeedVersion(ctx, id); err != nil {
+			return fmt.Errorf("deleting feed version %d failed: %w", id, err)
+		}
+		log.Printf("feed version %d deleted", id)
+	default:
+		return fmt.Errorf("unknown feeds command %q, expected list, activate, rollback or delete", args[0])
+	}
+	return nil
+}
@@ -11,6 +11,20 @@ type Marker struct {
 	Lon  string `db:"stop_lon" json:"stop_lon"`
 }
 
+type StopSearchResult struct {
+	Marker
+	StopIDs    []string `json:"stop_ids"`
+	Departures int      `json:"departures"`
+	Score      float64  `json:"score"`
+	Alerts     []Alert  `json:"alerts,omitempty"`
+}
+
+type NearbyStop struct {
+	Stop
+	DistanceMeters float64 `json:"distance_meters"`
+	Alerts         []Alert `json:"alerts,omitempty"`
+}
+
 type Calendar struct {
 	ServiceID string    `db:"service_id" json:"service_id"`
 	Monday    bool      `db:"monday" json:"monday"`
@@ -43,6 +57,69 @@ type Route struct {
 	RouteSortOrder   int64  `db:"route_sort_order" json:"route_sort_order"`
 }
 
+// LineString is a GeoJSON LineString geometry. Coordinates are [lon, lat].
+type LineString struct {
+	Type        string       `json:"type"`
+	Coordinates [][2]float64 `json:"coordinates"`
+}
+
+type RouteInfo struct {
+	Route
+	Alerts []Alert `json:"alerts,omitempty"`
+}
+
+// RouteDetail is a route with the directions its trips run in.
+type RouteDetail struct {
+	Route
+	Directions []RouteDirection `json:"directions"`
+	Alerts     []Alert          `json:"alerts,omitempty"`
+}
+
+// RouteDirection lists the headsigns of one direction_id, the most used
+// first, and every stop served in that direction in running order.
+type RouteDirection struct {
+	DirectionID int      `json:"direction_id"`
+	Headsigns   []string `json:"headsigns"`
+	TripCount   int      `json:"trip_count"`
+	Stops       []Stop   `json:"stops"`
+}
+
+// RouteTimetable is the timetable of a route on one date, one grid per
+// direction.
+type RouteTimetable struct {
+	Route Route           `json:"route"`
+	Date  string          `json:"date"`
+	Grids []TimetableGrid `json:"grids"`
+}
+
+// TimetableGrid has a row per stop and a column per trip. Times[i] of a
+// trip is its time at Stops[i], or empty when it does not call there.
+type TimetableGrid struct {
+	DirectionID int                 `json:"direction_id"`
+	Headsign    string              `json:"headsign"`
+	Stops       []TimetableStop     `json:"stops"`
+	Trips       []TimetableTrip     `json:"trips"`
+	Footnotes   []TimetableFootnote `json:"footnotes"`
+}
+
+type TimetableStop struct {
+	StopID       string `json:"stop_id"`
+	StopName     string `json:"stop_name"`
+	PlatformCode string `json:"platform_code"`
+}
+
+type TimetableTrip struct {
+	TripID    string   `json:"trip_id"`
+	Headsign  string   `json:"headsign"`
+	Footnotes []string `json:"footnotes"`
+	Times     []string `json:"times"`
+}
+
+type TimetableFootnote struct {
+	Symbol string `json:"symbol"`
+	Text   string `json:"text"`
+}
+
 type Shape struct {
 	ShapeID           string  `db:"shape_id" json:"shape_id"`
 	ShapePtLat        float64 `db:"shape_pt_lat" json:"shape_pt_lat"`
@@ -64,13 +141,6 @@ type StopTime struct {
 	Timepoint         int     `db:"timepoint" json:"timepoint"`
 }
 
-type TempStop struct {
-	TripID            string `db:"trip_id" json:"trip_id"`
-	FromStopID        string `db:"from_stop_id" json:"from_stop_id"`
-	FromDepartureTime string `db:"from_departure_time" json:"from_departure_time"`
-	ToStopID          string `db:"to_stop_id" json:"to_stop_id"`
-	ToDepartureTime   string `db:"to_departure_time" json:"to_departure_time"`
-}
 type Stop struct {
 	StopID             string         `db:"stop_id" json:"stop_id"`
 	StopCode           string         `db:"stop_code" json:"stop_code"`
@@ -110,22 +180,216 @@ type User struct {
 	RecentRides []string  `db:"recent_rides" json:"recent_rides"`
 }
 
-type TripHash struct {
-	Headsign  string
-	ServiceID string
+// FeedVersion is one imported GTFS feed. Versions are stored side by side
+// and exactly one is active; the others can be queried with feed_version.
+type FeedVersion struct {
+	ID         int       `db:"id" json:"id"`
+	Source     string    `db:"source" json:"source"`
+	Hash       string    `db:"hash" json:"hash"`
+	ImportedAt time.Time `db:"imported_at" json:"imported_at"`
+	// StartDate and EndDate bound the service dates of calendar and
+	// calendar_dates; they are nil for a feed without either.
+	StartDate   *time.Time `db:"start_date" json:"start_date"`
+	EndDate     *time.Time `db:"end_date" json:"end_date"`
+	Active      bool       `db:"active" json:"active"`
+	ActivatedAt *time.Time `db:"activated_at" json:"activated_at"`
 }
 
 type RouteResult struct {
-	TripId             string
-	TripName           string
-	FromStopId         string
-	FromStopName       string
-	ToStopId           string
-	ToStopName         string
-	DepartureTime      string
-	ArrivalTime        string
-	ServiceId          string
-	DepartureDayOffset int
-	ArrivalDayOffset   int
-	SearchDate         string
+	TripId             string        `json:"trip_id"`
+	TripName           string        `json:"trip_name"`
+	RouteId            string        `json:"route_id"`
+	FromStopId         string        `json:"from_stop_id"`
+	FromStopName       string        `json:"from_stop_name"`
+	FromPlatformCode   string        `json:"from_platform_code,omitempty"`
+	ToStopId           string        `json:"to_stop_id"`
+	ToStopName         string        `json:"to_stop_name"`
+	ToPlatformCode     string        `json:"to_platform_code,omitempty"`
+	DepartureTime      string        `json:"departure_time"`
+	ArrivalTime        string        `json:"arrival_time"`
+	ServiceId          string        `json:"service_id"`
+	ServiceDate        string        `json:"service_date"`
+	DepartureDayOffset int           `json:"departure_day_offset"`
+	ArrivalDayOffset   int           `json:"arrival_day_offset"`
+	DepartureTimestamp time.Time     `json:"departure_timestamp"`
+	ArrivalTimestamp   time.Time     `json:"arrival_timestamp"`
+	SearchDate         string        `json:"search_date"`
+	Stops              []SegmentStop `json:"stops"`
+
+	// Realtime fields, filled from GTFS-RT TripUpdates when the trip has
+	// an update. Predicted times are nil otherwise.
+	Realtime              bool       `json:"realtime"`
+	PredictedDeparture    *time.Time `json:"predicted_departure,omitempty"`
+	PredictedArrival      *time.Time `json:"predicted_arrival,omitempty"`
+	DepartureDelaySeconds int        `json:"departure_delay_seconds,omitempty"`
+	ArrivalDelaySeconds   int        `json:"arrival_delay_seconds,omitempty"`
+	Cancelled             bool       `json:"cancelled,omitempty"`
+	DepartureSkipped      bool       `json:"departure_skipped,omitempty"`
+	ArrivalSkipped        bool       `json:"arrival_skipped,omitempty"`
+
+	// Alerts that affect the trip, its route or any stop of the leg while
+	// the leg is running.
+	Alerts []Alert `json:"alerts,omitempty"`
+
+	// Geometry is the part of the trip's shape the leg covers, included
+	// when the client asks for it.
+	Geometry *LineString `json:"geometry,omitempty"`
+}
+
+type SegmentStop struct {
+	StopId             string    `json:"stop_id"`
+	StopName           string    `json:"stop_name"`
+	ArrivalTime        string    `json:"arrival_time"`
+	DepartureTime      string    `json:"departure_time"`
+	ArrivalTimestamp   time.Time `json:"arrival_timestamp"`
+	DepartureTimestamp time.Time `json:"departure_timestamp"`
+	StopSequence       int       `json:"stop_sequence"`
+}
+
+type Transfer struct {
+	FromStopId       string `json:"from_stop_id"`
+	FromStopName     string `json:"from_stop_name"`
+	FromPlatformCode string `json:"from_platform_code,omitempty"`
+	ToStopId         string `json:"to_stop_id"`
+	ToStopName       string `json:"to_stop_name"`
+	ToPlatformCode   string `json:"to_platform_code,omitempty"`
+	ArrivalTime      string `json:"arrival_time"`
+	DepartureTime    string `json:"departure_time"`
+	WaitSeconds      int    `json:"wait_seconds"`
+}
+
+type WalkLeg struct {
+	FromStopId      string  `json:"from_stop_id"`
+	FromStopName    string  `json:"from_stop_name"`
+	FromLat         float64 `json:"from_lat"`
+	FromLon         float64 `json:"from_lon"`
+	ToStopId        string  `json:"to_stop_id"`
+	ToStopName      string  `json:"to_stop_name"`
+	ToLat           float64 `json:"to_lat"`
+	ToLon           float64 `json:"to_lon"`
+	DistanceMeters  float64 `json:"distance_meters"`
+	DurationSeconds int     `json:"duration_seconds"`
+	DepartureTime   string  `json:"departure_time"`
+	ArrivalTime     string  `json:"arrival_time"`
+}
+
+type Journey struct {
+	DepartureTime      string        `json:"departure_time"`
+	ArrivalTime        string        `json:"arrival_time"`
+	DepartureTimestamp time.Time     `json:"departure_timestamp"`
+	ArrivalTimestamp   time.Time     `json:"arrival_timestamp"`
+	DurationSeconds    int           `json:"duration_seconds"`
+	TransferCount      int           `json:"transfer_count"`
+	Access             *WalkLeg      `json:"access,omitempty"`
+	Legs               []RouteResult `json:"legs"`
+	Egress             *WalkLeg      `json:"egress,omitempty"`
+	Transfers          []Transfer    `json:"transfers,omitempty"`
+	SearchDate         string        `json:"search_date"`
+}
+
+type Vehicle struct {
+	VehicleID      string    `json:"vehicle_id"`
+	Label          string    `json:"label"`
+	TripID         string    `json:"trip_id"`
+	RouteID        string    `json:"route_id"`
+	Lat            float64   `json:"lat"`
+	Lon            float64   `json:"lon"`
+	Bearing        float32   `json:"bearing"`
+	Speed          float32   `json:"speed"`
+	StopID         string    `json:"stop_id"`
+	CurrentStatus  string    `json:"current_status"`
+	Timestamp      time.Time `json:"timestamp"`
+	Headsign       string    `json:"headsign"`
+	RouteShortName string    `json:"route_short_name"`
+	RouteColor     string    `json:"route_color"`
+	RouteTextColor string    `json:"route_text_color"`
+	RouteType      int       `json:"route_type"`
+}
+
+// Alert is a service alert, either from the GTFS-RT Alerts feed or written
+// through the admin API. It follows the GTFS-RT Alert message.
+type Alert struct {
+	ID               string          `json:"id"`
+	Source           string          `json:"source"`
+	Cause            string          `json:"cause,omitempty"`
+	Effect           string          `json:"effect,omitempty"`
+	ActivePeriods    []AlertPeriod   `json:"active_periods,omitempty"`
+	InformedEntities []AlertEntity   `json:"informed_entities"`
+	HeaderText       []LocalizedText `json:"header_text"`
+	DescriptionText  []LocalizedText `json:"description_text,omitempty"`
+	URL              []LocalizedText `json:"url,omitempty"`
+}
+
+// AlertPeriod is a time range an alert is active in. A nil bound is open.
+type AlertPeriod struct {
+	Start *time.Time `json:"start,omitempty"`
+	End   *time.Time `json:"end,omitempty"`
+}
+
+// AlertEntity selects what an alert applies to. Every field that is set
+// has to match.
+type AlertEntity struct {
+	AgencyID  string `json:"agency_id,omitempty"`
+	RouteID   string `json:"route_id,omitempty"`
+	RouteType *int   `json:"route_type,omitempty"`
+	TripID    string `json:"trip_id,omitempty"`
+	StopID    string `json:"stop_id,omitempty"`
+}
+
+type LocalizedText struct {
+	Language string `json:"language,omitempty"`
+	Text     string `json:"text"`
+}
+
+// Departure is one row of a stop's departure board.
+type Departure struct {
+	TripID             string     `json:"trip_id"`
+	RouteID            string     `json:"route_id"`
+	RouteShortName     string     `json:"route_short_name"`
+	RouteColor         string     `json:"route_color"`
+	RouteTextColor     string     `json:"route_text_color"`
+	RouteType          int        `json:"route_type"`
+	Headsign           string     `json:"headsign"`
+	StopID             string     `json:"stop_id"`
+	StopName           string     `json:"stop_name"`
+	PlatformCode       string     `json:"platform_code"`
+	PickupType         int        `json:"pickup_type"`
+	ServiceDate        string     `json:"service_date"`
+	DepartureTime      string     `json:"departure_time"`
+	DepartureTimestamp time.Time  `json:"departure_timestamp"`
+	Realtime           bool       `json:"realtime"`
+	PredictedDeparture *time.Time `json:"predicted_departure,omitempty"`
+	DelaySeconds       int        `json:"delay_seconds"`
+	Cancelled          bool       `json:"cancelled"`
+	Skipped            bool       `json:"skipped"`
+}
+
+// TripDetail is a trip with its route, every stop it calls at and the
+// dates it runs on.
+type TripDetail struct {
+	Trip
+	Route        Route      `json:"route"`
+	Stops        []TripStop `json:"stops"`
+	ServiceDates []string   `json:"service_dates"`
+	// Date, RunsOnDate and the timestamps of Stops are set when a date is
+	// asked for.
+	Date       string  `json:"date,omitempty"`
+	RunsOnDate *bool   `json:"runs_on_date,omitempty"`
+	Realtime   bool    `json:"realtime"`
+	Cancelled  bool    `json:"cancelled"`
+	Alerts     []Alert `json:"alerts,omitempty"`
+}
+
+type TripStop struct {
+	StopTime
+	StopName           string     `json:"stop_name"`
+	StopLat            float64    `json:"stop_lat"`
+	StopLon            float64    `json:"stop_lon"`
+	PlatformCode       string     `json:"platform_code"`
+	WheelchairBoarding int        `json:"wheelchair_boarding"`
+	ArrivalTimestamp   *time.Time `json:"arrival_timestamp,omitempty"`
+	DepartureTimestamp *time.Time `json:"departure_timestamp,omitempty"`
+	PredictedArrival   *time.Time `json:"predicted_arrival,omitempty"`
+	PredictedDeparture *time.Time `json:"predicted_departure,omitempty"`
+	Skipped            bool       `json:"skipped"`
 }